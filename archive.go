@@ -8,31 +8,52 @@
 package knoxite
 
 import (
+	"errors"
 	"io"
 	"os"
 )
 
 // Types of archives.
 const (
-	File      = iota // A File
-	Directory        // A Directory
-	SymLink          // A SymLink
+	File        = iota // A File
+	Directory          // A Directory
+	SymLink            // A SymLink
+	CharDevice         // A character device node
+	BlockDevice        // A block device node
+	FIFO               // A named pipe
+	Socket             // A Unix domain socket
+)
+
+// Error declarations.
+var (
+	ErrDeviceNodesRequireRoot  = errors.New("restoring device nodes requires root privileges")
+	ErrSpecialFilesUnsupported = errors.New("device nodes, FIFOs and sockets are not supported on this platform")
 )
 
 // Archive contains all metadata belonging to a file/directory.
 type Archive struct {
-	Path        string      `json:"path"`               // Where in filesystem does this belong to
-	PointsTo    string      `json:"pointsto,omitempty"` // If this is a SymLink, where does it point to
-	Mode        os.FileMode `json:"mode"`               // file mode bits
-	ModTime     int64       `json:"modtime"`            // modification time
-	Size        uint64      `json:"size"`               // size
-	StorageSize uint64      `json:"storagesize"`        // size in storage
-	UID         uint32      `json:"uid"`                // owner
-	GID         uint32      `json:"gid"`                // group
-	Chunks      []Chunk     `json:"chunks,omitempty"`   // data chunks
-	Encrypted   uint16      `json:"encrypted"`          // encryption type
-	Compressed  uint16      `json:"compressed"`         // compression type
-	Type        uint8       `json:"type"`               // Is this a File, Directory or SymLink
+	Path        string            `json:"path"`               // Where in filesystem does this belong to
+	PointsTo    string            `json:"pointsto,omitempty"` // If this is a SymLink, where does it point to
+	Mode        os.FileMode       `json:"mode"`               // file mode bits
+	ModTime     int64             `json:"modtime"`            // modification time
+	Size        uint64            `json:"size"`               // size
+	StorageSize uint64            `json:"storagesize"`        // size in storage
+	UID         uint32            `json:"uid"`                // owner
+	GID         uint32            `json:"gid"`                // group
+	User        string            `json:"user,omitempty"`     // owner's name
+	Group       string            `json:"group,omitempty"`    // group's name
+	Chunks      []Chunk           `json:"chunks,omitempty"`   // data chunks
+	Encrypted   uint16            `json:"encrypted"`          // encryption type
+	Compressed  uint16            `json:"compressed"`         // compression type
+	Type        uint8             `json:"type"`               // Is this a File, Directory, SymLink, device node, FIFO or Socket
+	DevMajor    uint32            `json:"devmajor,omitempty"` // major device number of a device node
+	DevMinor    uint32            `json:"devminor,omitempty"` // minor device number of a device node
+	Device      uint64            `json:"device,omitempty"`   // device number, identifies hard links together with the inode
+	Inode       uint64            `json:"inode,omitempty"`    // inode number, used to detect unchanged files
+	CTime       int64             `json:"ctime,omitempty"`    // inode change time in nanoseconds
+	XAttrs      map[string][]byte `json:"xattrs,omitempty"`   // extended attributes, including ACLs, SELinux labels & capabilities
+	Flags       uint32            `json:"flags,omitempty"`    // file flags, e.g. immutable (BSD & macOS only)
+	LinkTo      string            `json:"linkto,omitempty"`   // If this is a hard link, the path of the first File linking to the same inode
 }
 
 // ArchiveResult wraps Archive and an error.
@@ -42,6 +63,33 @@ type ArchiveResult struct {
 	Error   error
 }
 
+// unchanged returns true if the file described by arc has the same metadata as
+// the file described by parent, so its content can be assumed to be the same.
+func (arc *Archive) unchanged(parent *Archive) bool {
+	return arc.Type == File && parent.Type == File &&
+		arc.Path == parent.Path &&
+		arc.Size == parent.Size &&
+		arc.ModTime == parent.ModTime &&
+		arc.Inode == parent.Inode &&
+		arc.CTime == parent.CTime
+}
+
+// complete returns true if the chunks of arc cover its entire content. Chunks
+// that failed to be stored are missing from incomplete archives.
+func (arc *Archive) complete() bool {
+	var size uint64
+	nums := make([]bool, len(arc.Chunks))
+	for _, chunk := range arc.Chunks {
+		if chunk.Num >= uint(len(nums)) || nums[chunk.Num] {
+			return false
+		}
+		nums[chunk.Num] = true
+		size += uint64(chunk.OriginalSize)
+	}
+
+	return size == arc.Size
+}
+
 // IndexOfChunk returns the slice-index for a specific chunk number.
 func (arc *Archive) IndexOfChunk(chunkNum uint) (int, error) {
 	for i, chunk := range arc.Chunks {
@@ -0,0 +1,261 @@
+/*
+ * knoxite
+ *     Copyright (c) 2016-2021, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package knoxite
+
+import (
+	"errors"
+	"io"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// Const declarations.
+const (
+	// DefaultReadAhead is the number of chunks an ArchiveReader fetches in
+	// advance.
+	DefaultReadAhead = 2
+
+	// readerWindows is the number of read-ahead windows an ArchiveReader
+	// keeps chunks for, so a few concurrent readers at different offsets
+	// don't evict each other's chunks.
+	readerWindows = 4
+)
+
+// Error declarations.
+var (
+	ErrNegativeOffset = errors.New("negative offset")
+	ErrInvalidWhence  = errors.New("invalid whence")
+)
+
+// An ArchiveReader reads the content of an archive. Chunks get fetched and
+// decoded on demand. Only a bounded number of the most recently used chunks
+// is held in memory.
+type ArchiveReader struct {
+	repository Repository
+	archive    Archive
+	readAhead  int
+
+	chunks  []Chunk // ordered by chunk number
+	offsets []int64 // offset of each chunk within the archive
+	size    int64
+	pos     int64
+
+	mu      sync.Mutex
+	fetched map[int]*fetchedChunk
+	clock   uint64 // increases with every use of a fetched chunk
+}
+
+// fetchedChunk is a chunk which is being loaded or has been loaded.
+type fetchedChunk struct {
+	done chan struct{}
+	data []byte
+	err  error
+	used uint64 // when the chunk was last used
+}
+
+// NewArchiveReader returns a reader for the content of arc.
+func NewArchiveReader(repository Repository, arc Archive) (*ArchiveReader, error) {
+	r := &ArchiveReader{
+		repository: repository,
+		archive:    arc,
+		readAhead:  DefaultReadAhead,
+		fetched:    make(map[int]*fetchedChunk),
+	}
+
+	if arc.Type != File {
+		return r, nil
+	}
+	for i := uint(0); i < uint(len(arc.Chunks)); i++ {
+		idx, err := arc.IndexOfChunk(i)
+		if err != nil {
+			return nil, err
+		}
+
+		chunk := arc.Chunks[idx]
+		r.chunks = append(r.chunks, chunk)
+		r.offsets = append(r.offsets, r.size)
+		r.size += int64(chunk.OriginalSize)
+	}
+
+	return r, nil
+}
+
+// SetReadAhead changes the number of chunks, which get fetched in advance.
+func (r *ArchiveReader) SetReadAhead(chunks int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if chunks < 0 {
+		chunks = 0
+	}
+	r.readAhead = chunks
+}
+
+// Size returns the size of the archive's content.
+func (r *ArchiveReader) Size() int64 {
+	return r.size
+}
+
+// Read reads up to len(p) bytes from the current position. It never reads
+// beyond the end of the current chunk, so callers can track the progress
+// chunk by chunk.
+func (r *ArchiveReader) Read(p []byte) (int, error) {
+	if r.pos >= r.size {
+		return 0, io.EOF
+	}
+
+	i := r.chunkAt(r.pos)
+	end := r.offsets[i] + int64(r.chunks[i].OriginalSize)
+	if int64(len(p)) > end-r.pos {
+		p = p[:end-r.pos]
+	}
+
+	n, err := r.ReadAt(p, r.pos)
+	r.pos += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+// ReadAt reads len(p) bytes starting at offset off. It can safely be called
+// concurrently.
+func (r *ArchiveReader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, ErrNegativeOffset
+	}
+
+	n := 0
+	for n < len(p) {
+		if off >= r.size {
+			return n, io.EOF
+		}
+
+		i := r.chunkAt(off)
+		b, err := r.chunk(i)
+		if err != nil {
+			return n, err
+		}
+
+		c := copy(p[n:], b[off-r.offsets[i]:])
+		n += c
+		off += int64(c)
+	}
+
+	return n, nil
+}
+
+// Seek sets the position for the next Read.
+func (r *ArchiveReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.pos
+	case io.SeekEnd:
+		offset += r.size
+	default:
+		return r.pos, ErrInvalidWhence
+	}
+
+	if offset < 0 {
+		return r.pos, ErrNegativeOffset
+	}
+	r.pos = offset
+	return r.pos, nil
+}
+
+// Close releases all fetched chunks.
+func (r *ArchiveReader) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.fetched = make(map[int]*fetchedChunk)
+	return nil
+}
+
+// hole returns the number of bytes starting at the current position, which
+// belong to sparse chunks and only contain zeros.
+func (r *ArchiveReader) hole() int64 {
+	var n int64
+	for pos := r.pos; pos < r.size; {
+		i := r.chunkAt(pos)
+		if !r.chunks[i].Sparse {
+			break
+		}
+
+		end := r.offsets[i] + int64(r.chunks[i].OriginalSize)
+		n += end - pos
+		pos = end
+	}
+
+	return n
+}
+
+// chunkAt returns the index of the chunk containing offset off.
+func (r *ArchiveReader) chunkAt(off int64) int {
+	return sort.Search(len(r.offsets), func(i int) bool {
+		return r.offsets[i] > off
+	}) - 1
+}
+
+// chunk returns the decoded data of the i-th chunk. It also starts fetching
+// the following chunks and drops the least recently used chunks.
+func (r *ArchiveReader) chunk(i int) ([]byte, error) {
+	r.mu.Lock()
+	fc := r.fetch(i)
+	for j := i + 1; j <= i+r.readAhead && j < len(r.chunks); j++ {
+		r.fetch(j)
+	}
+	r.evict()
+	r.mu.Unlock()
+
+	<-fc.done
+	if fc.err == nil && len(fc.data) != r.chunks[i].OriginalSize {
+		return nil, &CheckSumError{"size", strconv.Itoa(r.chunks[i].OriginalSize), strconv.Itoa(len(fc.data))}
+	}
+	return fc.data, fc.err
+}
+
+// fetch starts loading the i-th chunk in the background, unless it's already
+// being loaded, and marks it as used. The caller must hold the lock.
+func (r *ArchiveReader) fetch(i int) *fetchedChunk {
+	r.clock++
+	if fc, ok := r.fetched[i]; ok {
+		fc.used = r.clock
+		return fc
+	}
+
+	fc := &fetchedChunk{
+		done: make(chan struct{}),
+		used: r.clock,
+	}
+	r.fetched[i] = fc
+
+	go func() {
+		defer close(fc.done)
+		fc.data, fc.err = loadChunk(r.repository, r.archive, r.chunks[i])
+	}()
+
+	return fc
+}
+
+// evict drops the least recently used chunks, until no more chunks than fit
+// into all read-ahead windows are left. Readers still waiting for a dropped
+// chunk get its data nonetheless. The caller must hold the lock.
+func (r *ArchiveReader) evict() {
+	for len(r.fetched) > readerWindows*(r.readAhead+1) {
+		oldest := -1
+		for j, fc := range r.fetched {
+			if oldest < 0 || fc.used < r.fetched[oldest].used {
+				oldest = j
+			}
+		}
+		delete(r.fetched, oldest)
+	}
+}
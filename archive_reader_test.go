@@ -0,0 +1,130 @@
+/*
+ * knoxite
+ *     Copyright (c) 2016-2021, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package knoxite
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestArchiveReader(t *testing.T) {
+	testPassword := "this_is_a_password"
+
+	dir, err := ioutil.TempDir("", "knoxite")
+	if err != nil {
+		t.Errorf("Failed creating temporary dir for repository: %s", err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	r, err := NewRepository(dir, testPassword)
+	if err != nil {
+		t.Errorf("Failed creating repository: %s", err)
+		return
+	}
+	// small chunks, so reads have to cross chunk boundaries
+	if err = r.SetChunkSizes(1<<10, 4<<10, 16<<10); err != nil {
+		t.Errorf("Failed setting chunk sizes: %s", err)
+		return
+	}
+	index, err := OpenChunkIndex(&r)
+	if err != nil {
+		t.Errorf("Failed opening chunk-index: %s", err)
+		return
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Errorf("Failed getting working dir: %s", err)
+		return
+	}
+	snapshot, _ := NewSnapshot("test_snapshot")
+	progress := snapshot.Add(r, &index, StoreOptions{
+		CWD:       wd,
+		Paths:     []string{"repository.go"},
+		Encrypt:   EncryptionAESGCM,
+		DataParts: 1,
+	})
+	for p := range progress {
+		if p.Error != nil {
+			t.Errorf("Failed adding to snapshot: %s", p.Error)
+		}
+	}
+
+	orig, _ := ioutil.ReadFile("repository.go")
+	arc := snapshot.Archives["repository.go"]
+	reader, err := NewArchiveReader(r, *arc)
+	if err != nil {
+		t.Errorf("Failed creating archive reader: %s", err)
+		return
+	}
+	defer reader.Close()
+
+	if reader.Size() != int64(len(orig)) {
+		t.Errorf("Expected size %d, got %d", len(orig), reader.Size())
+	}
+
+	b, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Errorf("Failed reading archive: %s", err)
+		return
+	}
+	if !bytes.Equal(b, orig) {
+		t.Errorf("Data mismatch after reading archive")
+	}
+
+	// random access spanning multiple chunks
+	off := int64(len(orig) / 3)
+	b = make([]byte, 10<<10)
+	n, err := reader.ReadAt(b, off)
+	if err != nil || n != len(b) {
+		t.Errorf("Failed reading %d bytes at offset %d: %d, %v", len(b), off, n, err)
+	}
+	if !bytes.Equal(b[:n], orig[off:off+int64(n)]) {
+		t.Errorf("Data mismatch reading at offset %d", off)
+	}
+
+	// the deprecated ReadArchive still works
+	rb, err := ReadArchive(r, *arc, int(off), len(b))
+	if err != nil || !bytes.Equal(*rb, orig[off:off+int64(len(b))]) {
+		t.Errorf("Data mismatch reading archive at offset %d: %v", off, err)
+	}
+
+	// reading beyond the end
+	n, err = reader.ReadAt(b, int64(len(orig))-10)
+	if err != io.EOF || n != 10 {
+		t.Errorf("Expected 10 bytes and %v, got %d and %v", io.EOF, n, err)
+	}
+
+	if _, err = reader.Seek(-100, io.SeekEnd); err != nil {
+		t.Errorf("Failed seeking: %s", err)
+	}
+	b, err = ioutil.ReadAll(reader)
+	if err != nil || !bytes.Equal(b, orig[len(orig)-100:]) {
+		t.Errorf("Data mismatch after seeking: %v", err)
+	}
+
+	// interleaved readers at different offsets keep their chunks
+	reader.SetReadAhead(0)
+	_ = reader.Close()
+	b = make([]byte, 1)
+	for _, off := range []int64{0, reader.Size() - 1, 0} {
+		if _, err = reader.ReadAt(b, off); err != nil && err != io.EOF {
+			t.Errorf("Failed reading at offset %d: %s", off, err)
+		}
+	}
+	first, last := reader.chunkAt(0), reader.chunkAt(reader.Size()-1)
+	if _, ok := reader.fetched[first]; !ok || first == last {
+		t.Errorf("Expected chunk %d to be kept while reading chunk %d", first, last)
+	}
+	if _, ok := reader.fetched[last]; !ok {
+		t.Errorf("Expected chunk %d to be kept while reading chunk %d", last, first)
+	}
+}
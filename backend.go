@@ -44,6 +44,13 @@ type Backend interface {
 	// DeleteChunk deletes a single Chunk
 	DeleteChunk(shasum string, part, totalParts uint) error
 
+	// LoadPack loads length bytes starting at offset from a pack
+	LoadPack(id string, offset, length uint64) ([]byte, error)
+	// StorePack stores a pack
+	StorePack(id string, data []byte) (uint64, error)
+	// DeletePack deletes a pack
+	DeletePack(id string) error
+
 	// LoadSnapshot loads a snapshot
 	LoadSnapshot(id string) ([]byte, error)
 	// SaveSnapshot stores a snapshot
@@ -53,6 +60,17 @@ type Backend interface {
 	LoadChunkIndex() ([]byte, error)
 	// SaveChunkIndex stores the chunk-index
 	SaveChunkIndex(data []byte) error
+	// DeleteChunkIndex deletes the chunk-index
+	DeleteChunkIndex() error
+
+	// ListIndexSegments returns the IDs of all chunk-index segments
+	ListIndexSegments() ([]string, error)
+	// LoadIndexSegment loads a chunk-index segment
+	LoadIndexSegment(id string) ([]byte, error)
+	// SaveIndexSegment stores a chunk-index segment
+	SaveIndexSegment(id string, data []byte) error
+	// DeleteIndexSegment deletes a chunk-index segment
+	DeleteIndexSegment(id string) error
 
 	// InitRepository creates a new repository
 	InitRepository() error
@@ -60,6 +78,15 @@ type Backend interface {
 	LoadRepository() ([]byte, error)
 	// SaveRepository stores the metadata for a repository
 	SaveRepository(data []byte) error
+
+	// ListLocks returns the IDs of all locks held on a repository
+	ListLocks() ([]string, error)
+	// LoadLock loads a lock
+	LoadLock(id string) ([]byte, error)
+	// SaveLock stores a lock
+	SaveLock(id string, data []byte) error
+	// DeleteLock deletes a lock
+	DeleteLock(id string) error
 }
 
 // Error declarations.
@@ -18,6 +18,7 @@ type BackendManager struct {
 	Backends []*Backend
 
 	lastUsedBackend int
+	packer          *packer // bundles chunks into packs, if set
 }
 
 // Error declarations.
@@ -31,6 +32,20 @@ var (
 	ErrStoreSnapshotFailed   = errors.New("storing snapshot failed")
 	ErrStoreChunkIndexFailed = errors.New("storing chunk-index failed")
 	ErrStoreRepositoryFailed = errors.New("storing repository failed")
+
+	ErrDeleteChunkIndexFailed = errors.New("unable to delete chunk-index from any storage backend")
+
+	ErrLoadPackFailed   = errors.New("unable to load pack from any storage backend")
+	ErrStorePackFailed  = errors.New("storing pack failed")
+	ErrDeletePackFailed = errors.New("unable to delete pack from any storage backend")
+
+	ErrLoadIndexSegmentFailed   = errors.New("unable to load chunk-index segment from any storage backend")
+	ErrStoreIndexSegmentFailed  = errors.New("storing chunk-index segment failed")
+	ErrDeleteIndexSegmentFailed = errors.New("unable to delete chunk-index segment from any storage backend")
+
+	ErrLoadLockFailed   = errors.New("unable to load lock from any storage backend")
+	ErrStoreLockFailed  = errors.New("storing lock failed")
+	ErrDeleteLockFailed = errors.New("unable to delete lock from any storage backend")
 )
 
 // AddBackend adds a backend.
@@ -48,8 +63,13 @@ func (backend *BackendManager) Locations() []string {
 	return paths
 }
 
-// LoadChunk loads a Chunk from backends.
+// LoadChunk loads a Chunk from backends. Chunks stored in a pack get read
+// from their location within the pack.
 func (backend *BackendManager) LoadChunk(chunk Chunk, part uint) ([]byte, error) {
+	if part < uint(len(chunk.Packs)) && chunk.Packs[part].Pack != "" {
+		return backend.LoadPack(chunk.Packs[part])
+	}
+
 	for _, be := range backend.Backends {
 		for i := 0; i < retries; i++ {
 			b, err := (*be).LoadChunk(chunk.Hash, part, chunk.DataParts)
@@ -62,7 +82,8 @@ func (backend *BackendManager) LoadChunk(chunk Chunk, part uint) ([]byte, error)
 	return []byte{}, ErrLoadChunkFailed
 }
 
-// StoreChunk stores a single Chunk on backends.
+// StoreChunk stores a single Chunk on backends. If a packer is set, the chunk
+// gets added to a pack instead of being stored on its own.
 func (backend *BackendManager) StoreChunk(chunk Chunk) (size uint64, err error) {
 	for i, data := range *chunk.Data {
 		// Use storage backends in a round robin fashion to store chunks
@@ -71,6 +92,17 @@ func (backend *BackendManager) StoreChunk(chunk Chunk) (size uint64, err error)
 			backend.lastUsedBackend = 0
 		}
 
+		if backend.packer != nil {
+			err := backend.packer.add(backend, backend.lastUsedBackend, chunk.Hash, uint(i), data)
+			if err != nil {
+				return 0, err
+			}
+			if n := uint64(len(data)); n > size {
+				size = n
+			}
+			continue
+		}
+
 		be := backend.Backends[backend.lastUsedBackend]
 
 		var n uint64
@@ -109,6 +141,52 @@ func (backend *BackendManager) DeleteChunk(shasum string, part, totalParts uint)
 	return ErrDeleteChunkFailed
 }
 
+// LoadPack loads a chunk part from its location within a pack.
+func (backend *BackendManager) LoadPack(loc PackLocation) ([]byte, error) {
+	for _, be := range backend.Backends {
+		for i := 0; i < retries; i++ {
+			b, err := (*be).LoadPack(loc.Pack, loc.Offset, loc.Length)
+			if err == nil {
+				return b, err
+			}
+		}
+	}
+
+	return []byte{}, ErrLoadPackFailed
+}
+
+// storePack stores a pack on a single backend.
+func (backend *BackendManager) storePack(be int, id string, data []byte) error {
+	var err error
+	for i := 0; i < retries; i++ {
+		_, err = (*backend.Backends[be]).StorePack(id, data)
+		if err == nil {
+			return nil
+		}
+	}
+
+	return err
+}
+
+// DeletePack deletes a pack from all storage backends.
+func (backend *BackendManager) DeletePack(id string) error {
+	deleted := false
+	for _, be := range backend.Backends {
+		for i := 0; i < retries; i++ {
+			err := (*be).DeletePack(id)
+			if err == nil {
+				deleted = true
+				break
+			}
+		}
+	}
+
+	if !deleted {
+		return ErrDeletePackFailed
+	}
+	return nil
+}
+
 // LoadSnapshot loads a snapshot.
 func (backend *BackendManager) LoadSnapshot(id string) ([]byte, error) {
 	for _, be := range backend.Backends {
@@ -173,6 +251,105 @@ func (backend *BackendManager) SaveChunkIndex(b []byte) error {
 	return nil
 }
 
+// DeleteChunkIndex deletes the chunk-index from all storage backends.
+func (backend *BackendManager) DeleteChunkIndex() error {
+	deleted := false
+	for _, be := range backend.Backends {
+		for i := 0; i < retries; i++ {
+			err := (*be).DeleteChunkIndex()
+			if err == nil {
+				deleted = true
+				break
+			}
+		}
+	}
+
+	if !deleted {
+		return ErrDeleteChunkIndexFailed
+	}
+	return nil
+}
+
+// ListIndexSegments returns the IDs of all chunk-index segments found on any
+// storage backend.
+func (backend *BackendManager) ListIndexSegments() ([]string, error) {
+	seen := make(map[string]bool)
+	ids := []string{}
+	for _, be := range backend.Backends {
+		var l []string
+		var err error
+		for i := 0; i < retries; i++ {
+			l, err = (*be).ListIndexSegments()
+			if err == nil {
+				break
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		for _, id := range l {
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+
+	return ids, nil
+}
+
+// LoadIndexSegment loads a chunk-index segment.
+func (backend *BackendManager) LoadIndexSegment(id string) ([]byte, error) {
+	for _, be := range backend.Backends {
+		for i := 0; i < retries; i++ {
+			b, err := (*be).LoadIndexSegment(id)
+			if err == nil {
+				return b, err
+			}
+		}
+	}
+
+	return []byte{}, ErrLoadIndexSegmentFailed
+}
+
+// SaveIndexSegment stores a chunk-index segment on all storage backends.
+func (backend *BackendManager) SaveIndexSegment(id string, b []byte) error {
+	for _, be := range backend.Backends {
+		var err error
+		for i := 0; i < retries; i++ {
+			err = (*be).SaveIndexSegment(id, b)
+			if err == nil {
+				break
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// DeleteIndexSegment deletes a chunk-index segment from all storage backends.
+func (backend *BackendManager) DeleteIndexSegment(id string) error {
+	deleted := false
+	for _, be := range backend.Backends {
+		for i := 0; i < retries; i++ {
+			err := (*be).DeleteIndexSegment(id)
+			if err == nil {
+				deleted = true
+				break
+			}
+		}
+	}
+
+	if !deleted {
+		return ErrDeleteIndexSegmentFailed
+	}
+	return nil
+}
+
 // InitRepository creates a new repository.
 func (backend *BackendManager) InitRepository() error {
 	for _, be := range backend.Backends {
@@ -216,3 +393,82 @@ func (backend *BackendManager) SaveRepository(b []byte) error {
 
 	return nil
 }
+
+// ListLocks returns the IDs of all locks found on any storage backend.
+func (backend *BackendManager) ListLocks() ([]string, error) {
+	seen := make(map[string]bool)
+	ids := []string{}
+	for _, be := range backend.Backends {
+		var l []string
+		var err error
+		for i := 0; i < retries; i++ {
+			l, err = (*be).ListLocks()
+			if err == nil {
+				break
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		for _, id := range l {
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+
+	return ids, nil
+}
+
+// LoadLock loads a lock.
+func (backend *BackendManager) LoadLock(id string) ([]byte, error) {
+	for _, be := range backend.Backends {
+		for i := 0; i < retries; i++ {
+			b, err := (*be).LoadLock(id)
+			if err == nil {
+				return b, err
+			}
+		}
+	}
+
+	return []byte{}, ErrLoadLockFailed
+}
+
+// SaveLock stores a lock on all storage backends.
+func (backend *BackendManager) SaveLock(id string, b []byte) error {
+	for _, be := range backend.Backends {
+		var err error
+		for i := 0; i < retries; i++ {
+			err = (*be).SaveLock(id, b)
+			if err == nil {
+				break
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// DeleteLock deletes a lock from all storage backends.
+func (backend *BackendManager) DeleteLock(id string) error {
+	deleted := false
+	for _, be := range backend.Backends {
+		for i := 0; i < retries; i++ {
+			err := (*be).DeleteLock(id)
+			if err == nil {
+				deleted = true
+				break
+			}
+		}
+	}
+
+	if !deleted {
+		return ErrDeleteLockFailed
+	}
+	return nil
+}
@@ -0,0 +1,307 @@
+/*
+ * knoxite
+ *     Copyright (c) 2016-2021, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package knoxite
+
+import (
+	"container/list"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Const declarations.
+const (
+	// DefaultCacheSize is the default memory budget of a Cache.
+	DefaultCacheSize = 64 * (1 << 20) // 64 MiB
+	// DefaultCacheDirSize is the default budget of a Cache's directory.
+	DefaultCacheDirSize = 1 << 30 // 1 GiB
+)
+
+// CacheStats contains statistics about the efficiency of a Cache.
+type CacheStats struct {
+	MemoryHits uint64 `json:"memory_hits"`
+	DiskHits   uint64 `json:"disk_hits"`
+	Misses     uint64 `json:"misses"`
+	Evictions  uint64 `json:"evictions"`
+	Size       uint64 `json:"size"` // bytes currently held in memory
+
+	DiskEvictions uint64 `json:"disk_evictions"`
+	DiskSize      uint64 `json:"disk_size"` // bytes currently stored in the cache dir
+}
+
+// A Cache holds decoded chunks. The least recently used chunks get evicted
+// from memory once its memory budget is exceeded. Optionally chunks also get
+// stored, encrypted, in a directory, where they survive evictions and
+// restarts, until the directory exceeds its own budget.
+type Cache struct {
+	mu      sync.Mutex
+	budget  uint64
+	lru     *list.List // most recently used chunks at the front
+	entries map[string]*list.Element
+	stats   CacheStats
+
+	dir       string
+	dirBudget uint64
+	key       string
+}
+
+type cacheEntry struct {
+	hash string
+	data []byte
+}
+
+// NewCache returns a cache holding up to budget bytes in memory. If dir isn't
+// empty, chunks also get stored in dir, encrypted with key. Once the files in
+// dir take up more than dirBudget bytes, the least recently used ones get
+// removed.
+func NewCache(budget uint64, dir string, dirBudget uint64, key string) (*Cache, error) {
+	c := &Cache{
+		budget:    budget,
+		lru:       list.New(),
+		entries:   make(map[string]*list.Element),
+		dir:       dir,
+		dirBudget: dirBudget,
+		key:       key,
+	}
+
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return nil, err
+		}
+		if _, err := NewEncryptor(EncryptionAESGCM, key); err != nil {
+			return nil, err
+		}
+
+		files, err := c.files()
+		if err != nil {
+			return nil, err
+		}
+		for _, fi := range files {
+			c.stats.DiskSize += uint64(fi.Size())
+		}
+	}
+
+	return c, nil
+}
+
+// Get returns the cached data of the chunk identified by hash.
+func (c *Cache) Get(hash string) ([]byte, bool) {
+	c.mu.Lock()
+	if e, ok := c.entries[hash]; ok {
+		c.lru.MoveToFront(e)
+		c.stats.MemoryHits++
+		c.mu.Unlock()
+		return e.Value.(*cacheEntry).data, true
+	}
+	c.mu.Unlock()
+
+	if b, err := c.loadFile(hash); err == nil {
+		c.mu.Lock()
+		c.stats.DiskHits++
+		c.add(hash, b)
+		c.mu.Unlock()
+		return b, true
+	}
+
+	c.mu.Lock()
+	c.stats.Misses++
+	c.mu.Unlock()
+	return nil, false
+}
+
+// Put adds the data of the chunk identified by hash to the cache.
+func (c *Cache) Put(hash string, data []byte) {
+	c.mu.Lock()
+	c.add(hash, data)
+	c.mu.Unlock()
+
+	// the disk cache is merely an optimization, so errors can be ignored
+	_ = c.storeFile(hash, data)
+}
+
+// Stats returns the cache's statistics.
+func (c *Cache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.stats
+}
+
+// add stores data in memory and evicts the least recently used chunks until
+// the cache fits its budget again. The caller must hold the lock.
+func (c *Cache) add(hash string, data []byte) {
+	if _, ok := c.entries[hash]; ok || uint64(len(data)) > c.budget {
+		return
+	}
+
+	c.entries[hash] = c.lru.PushFront(&cacheEntry{hash: hash, data: data})
+	c.stats.Size += uint64(len(data))
+
+	for c.stats.Size > c.budget {
+		e := c.lru.Back()
+		entry := e.Value.(*cacheEntry)
+		c.lru.Remove(e)
+		delete(c.entries, entry.hash)
+		c.stats.Size -= uint64(len(entry.data))
+		c.stats.Evictions++
+	}
+}
+
+func (c *Cache) loadFile(hash string) ([]byte, error) {
+	if c.dir == "" {
+		return nil, os.ErrNotExist
+	}
+
+	path := filepath.Join(c.dir, hash)
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	d, err := NewDecryptor(EncryptionAESGCM, c.key)
+	if err != nil {
+		return nil, err
+	}
+	data, err := d.Process(b)
+	if err != nil {
+		// the file is corrupted or was written with a different key
+		if os.Remove(path) == nil {
+			c.mu.Lock()
+			c.stats.DiskSize -= uint64(len(b))
+			c.mu.Unlock()
+		}
+		return nil, err
+	}
+
+	// the modification time tracks when a file was last used
+	now := time.Now()
+	_ = os.Chtimes(path, now, now)
+
+	return data, nil
+}
+
+func (c *Cache) storeFile(hash string, data []byte) error {
+	if c.dir == "" {
+		return nil
+	}
+
+	path := filepath.Join(c.dir, hash)
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+
+	e, err := NewEncryptor(EncryptionAESGCM, c.key)
+	if err != nil {
+		return err
+	}
+	b, err := e.Process(data)
+	if err != nil {
+		return err
+	}
+	if uint64(len(b)) > c.dirBudget {
+		return nil
+	}
+
+	// write to a temporary file first, so concurrent readers never see
+	// partially written chunks
+	f, err := ioutil.TempFile(c.dir, "."+hash)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(b); err != nil {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+		return err
+	}
+	if err = f.Close(); err != nil {
+		_ = os.Remove(f.Name())
+		return err
+	}
+
+	if err = os.Rename(f.Name(), path); err != nil {
+		_ = os.Remove(f.Name())
+		return err
+	}
+
+	c.mu.Lock()
+	c.stats.DiskSize += uint64(len(b))
+	exceeded := c.stats.DiskSize > c.dirBudget
+	c.mu.Unlock()
+
+	if exceeded {
+		return c.evictFiles()
+	}
+	return nil
+}
+
+// evictFiles removes the least recently used files from the cache dir, until
+// they take up no more than 90% of its budget, so not every following Put has
+// to evict files again.
+func (c *Cache) evictFiles() error {
+	files, err := c.files()
+	if err != nil {
+		return err
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].ModTime().Before(files[j].ModTime())
+	})
+
+	var size uint64
+	for _, fi := range files {
+		size += uint64(fi.Size())
+	}
+
+	var evictions uint64
+	for _, fi := range files {
+		if size <= c.dirBudget-c.dirBudget/10 {
+			break
+		}
+		err := os.Remove(filepath.Join(c.dir, fi.Name()))
+		if err != nil && !os.IsNotExist(err) {
+			continue
+		}
+		size -= uint64(fi.Size())
+		evictions++
+	}
+
+	c.mu.Lock()
+	c.stats.DiskSize = size
+	c.stats.DiskEvictions += evictions
+	c.mu.Unlock()
+	return nil
+}
+
+// files returns all chunks stored in the cache dir, skipping temporary files.
+func (c *Cache) files() ([]os.FileInfo, error) {
+	infos, err := ioutil.ReadDir(c.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	files := []os.FileInfo{}
+	for _, fi := range infos {
+		if fi.Mode().IsRegular() && !strings.HasPrefix(fi.Name(), ".") {
+			files = append(files, fi)
+		}
+	}
+	return files, nil
+}
+
+// SetCache makes the repository cache decoded chunks in c. A nil cache
+// disables caching.
+func (r *Repository) SetCache(c *Cache) {
+	r.cache = c
+}
+
+// Cache returns the repository's chunk cache, which might be nil.
+func (r *Repository) Cache() *Cache {
+	return r.cache
+}
@@ -0,0 +1,137 @@
+/*
+ * knoxite
+ *     Copyright (c) 2016-2021, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package knoxite
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCacheEviction(t *testing.T) {
+	c, err := NewCache(10, "", 0, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.Put("a", []byte("aaaa"))
+	c.Put("b", []byte("bbbb"))
+	if _, ok := c.Get("a"); !ok {
+		t.Errorf("Expected a to be cached")
+	}
+	// b is the least recently used chunk now
+	c.Put("c", []byte("cccc"))
+	if _, ok := c.Get("b"); ok {
+		t.Errorf("Expected b to be evicted")
+	}
+	if b, ok := c.Get("c"); !ok || !bytes.Equal(b, []byte("cccc")) {
+		t.Errorf("Expected c to be cached, got %q", b)
+	}
+	// chunks exceeding the budget don't get cached at all
+	c.Put("d", make([]byte, 11))
+	if _, ok := c.Get("d"); ok {
+		t.Errorf("Expected d not to be cached")
+	}
+
+	stats := c.Stats()
+	if stats.MemoryHits != 2 || stats.Misses != 2 || stats.Evictions != 1 || stats.Size != 8 {
+		t.Errorf("Unexpected cache stats: %+v", stats)
+	}
+}
+
+func TestCacheDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "knoxite")
+	if err != nil {
+		t.Errorf("Failed creating temporary dir for cache: %s", err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	c, err := NewCache(0, dir, DefaultCacheDirSize, "this_is_a_key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := []byte("this_is_some_data")
+	c.Put("a", data)
+
+	b, err := ioutil.ReadFile(dir + "/a")
+	if err != nil {
+		t.Errorf("Expected chunk to be stored in cache dir: %s", err)
+	}
+	if bytes.Contains(b, data) {
+		t.Errorf("Expected chunk to be stored encrypted")
+	}
+
+	// a new cache finds the chunk on disk
+	c, _ = NewCache(DefaultCacheSize, dir, DefaultCacheDirSize, "this_is_a_key")
+	if b, ok := c.Get("a"); !ok || !bytes.Equal(b, data) {
+		t.Errorf("Expected chunk to be found in cache dir, got %q", b)
+	}
+	if stats := c.Stats(); stats.DiskHits != 1 {
+		t.Errorf("Expected 1 disk hit, got %+v", stats)
+	}
+
+	// chunks stored with another key get ignored
+	c, _ = NewCache(DefaultCacheSize, dir, DefaultCacheDirSize, "this_is_another_key")
+	if _, ok := c.Get("a"); ok {
+		t.Errorf("Expected chunk encrypted with another key to be ignored")
+	}
+}
+
+func TestCacheDirEviction(t *testing.T) {
+	dir, err := ioutil.TempDir("", "knoxite")
+	if err != nil {
+		t.Errorf("Failed creating temporary dir for cache: %s", err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	data := []byte("this_is_some_data")
+	c, err := NewCache(0, dir, DefaultCacheDirSize, "this_is_a_key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Put("a", data)
+	size := c.Stats().DiskSize
+	if size == 0 {
+		t.Fatalf("Expected chunk to be stored in cache dir")
+	}
+
+	// room for three and a half chunks
+	c, err = NewCache(0, dir, size*7/2, "this_is_a_key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats := c.Stats(); stats.DiskSize != size {
+		t.Errorf("Expected existing chunks to be accounted for, got %+v", stats)
+	}
+	c.Put("b", data)
+	c.Put("c", data)
+
+	// b is the least recently used chunk, a was just read
+	now := time.Now()
+	_ = os.Chtimes(filepath.Join(dir, "a"), now.Add(-3*time.Hour), now.Add(-3*time.Hour))
+	_ = os.Chtimes(filepath.Join(dir, "b"), now.Add(-2*time.Hour), now.Add(-2*time.Hour))
+	_ = os.Chtimes(filepath.Join(dir, "c"), now.Add(-1*time.Hour), now.Add(-1*time.Hour))
+	if _, ok := c.Get("a"); !ok {
+		t.Errorf("Expected chunk to be found in cache dir")
+	}
+
+	c.Put("d", data)
+	for hash, kept := range map[string]bool{"a": true, "b": false, "c": true, "d": true} {
+		if _, err := os.Stat(filepath.Join(dir, hash)); (err == nil) != kept {
+			t.Errorf("Expected chunk %s to be kept: %t, got %v", hash, kept, err)
+		}
+	}
+	if stats := c.Stats(); stats.DiskEvictions != 1 || stats.DiskSize != 3*size {
+		t.Errorf("Unexpected cache stats: %+v", stats)
+	}
+}
@@ -8,17 +8,78 @@
 package knoxite
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"io"
+	"math/bits"
 	"os"
+	"strconv"
 	"sync"
 
 	"github.com/restic/chunker"
 )
 
+// Default chunk sizes for new repositories.
 const (
-	preferredChunkSize = 1 * (1 << 20) // 1 MiB
+	DefaultMinChunkSize = 512 * (1 << 10) // 512 KiB
+	DefaultAvgChunkSize = 1 * (1 << 20)   // 1 MiB
+	DefaultMaxChunkSize = 8 * (1 << 20)   // 8 MiB
 )
 
+// legacyChunkerPolynomial was used by all repositories, before every
+// repository got its own secret polynomial.
+const legacyChunkerPolynomial = 0x3DA3358B4DC173
+
+// Error declarations.
+var (
+	ErrInvalidChunkSizes = errors.New("invalid chunk sizes: min <= avg <= max is required and avg must be a power of two")
+)
+
+// ChunkerConfig holds the parameters used to split files into chunks. The
+// polynomial is kept secret, so the chunk boundaries don't allow to draw
+// conclusions about the content of a repository.
+type ChunkerConfig struct {
+	Polynomial uint64 `json:"polynomial"`
+	MinSize    uint   `json:"min_size"`
+	AvgSize    uint   `json:"avg_size"`
+	MaxSize    uint   `json:"max_size"`
+}
+
+// legacyChunkerConfig returns the parameters used for repositories created
+// before they got their own chunker config.
+func legacyChunkerConfig() ChunkerConfig {
+	return ChunkerConfig{
+		Polynomial: legacyChunkerPolynomial,
+		MinSize:    chunker.MinSize,
+		AvgSize:    1 * (1 << 20),
+		MaxSize:    1 * (1 << 20),
+	}
+}
+
+// newChunkerConfig returns a config with a new random polynomial and the
+// default chunk sizes.
+func newChunkerConfig() (ChunkerConfig, error) {
+	pol, err := chunker.RandomPolynomial()
+	if err != nil {
+		return ChunkerConfig{}, err
+	}
+
+	return ChunkerConfig{
+		Polynomial: uint64(pol),
+		MinSize:    DefaultMinChunkSize,
+		AvgSize:    DefaultAvgChunkSize,
+		MaxSize:    DefaultMaxChunkSize,
+	}, nil
+}
+
+// validChunkSizes returns true if the chunker can work with the given sizes.
+func validChunkSizes(min, avg, max uint) bool {
+	// the chunker's rolling hash window needs to fit into the smallest chunk
+	return min >= 64 && min <= avg && avg <= max && avg&(avg-1) == 0
+}
+
 // Chunk stores an encrypted chunk alongside with its metadata.
 type Chunk struct {
 	Data          *[][]byte `json:"-"`
@@ -29,6 +90,12 @@ type Chunk struct {
 	DecryptedHash string    `json:"decrypted_hash"`
 	Hash          string    `json:"hash"`
 	Num           uint      `json:"num"`
+	Sparse        bool      `json:"sparse,omitempty"` // only contains zeros, which don't get stored
+	Packed        bool      `json:"packed,omitempty"` // stored in packs, see Packs
+
+	// Packs holds the location of each part within its pack. It is only
+	// recorded in the chunk-index, as packs change when being repacked.
+	Packs []PackLocation `json:"-"`
 }
 
 // ChunkResult is used to transfer either a chunk or an error down the channel.
@@ -42,72 +109,127 @@ type inputChunk struct {
 	Num  uint
 }
 
-func processChunk(password string, opts StoreOptions, jobs <-chan inputChunk, chunks chan<- ChunkResult, wg *sync.WaitGroup) {
-	pipe, _ := NewEncodingPipeline(opts.Compress, opts.Encrypt, password)
+func processChunk(repository *Repository, opts StoreOptions, jobs <-chan inputChunk, chunks chan<- ChunkResult, wg *sync.WaitGroup) {
+	pipe, _ := NewEncodingPipeline(opts.Compress, opts.Encrypt, repository.encryptionKey(opts.Encrypt))
 
 	for j := range jobs {
 		// fmt.Println("\tWorker", id, "processing job", j.Num, len(j.Data))
 
-		b, err := pipe.Process(j.Data)
+		if isZero(j.Data) {
+			chunks <- ChunkResult{Chunk: Chunk{
+				OriginalSize:  len(j.Data),
+				DecryptedHash: HashWithKey(j.Data, HashHighway256, repository.HashKey),
+				Num:           j.Num,
+				Sparse:        true,
+			}}
+			wg.Done()
+			continue
+		}
+
+		c, err := encodeChunk(repository, &pipe, opts, j.Data, j.Num)
 		if err != nil {
 			chunks <- ChunkResult{Error: err}
 			wg.Done()
 			continue
 		}
 
-		hashsum := Hash(b, HashHighway256)
-		orighashsum := Hash(j.Data, HashHighway256)
-
-		c := Chunk{
-			DataParts:     opts.DataParts,
-			ParityParts:   opts.ParityParts,
-			OriginalSize:  len(j.Data),
-			Size:          len(b),
-			DecryptedHash: orighashsum,
-			Hash:          hashsum,
-			Num:           j.Num,
-		}
+		chunks <- ChunkResult{Chunk: c}
+		wg.Done()
+	}
+}
 
-		if opts.ParityParts > 0 {
-			pars, err := redundantData(b, int(opts.DataParts), int(opts.ParityParts))
-			if err != nil {
-				chunks <- ChunkResult{Error: err}
-				wg.Done()
-				continue
-			}
-			c.Data = &pars
-		} else {
-			c.DataParts = 1
-			c.Data = &[][]byte{b}
+// encodeChunk encodes data with pipe and splits the result into the data and
+// parity parts requested by opts.
+func encodeChunk(repository *Repository, pipe *Pipeline, opts StoreOptions, data []byte, num uint) (Chunk, error) {
+	b, err := pipe.Process(data)
+	if err != nil {
+		return Chunk{}, err
+	}
+
+	hashsum := HashWithKey(b, HashHighway256, repository.HashKey)
+	orighashsum := HashWithKey(data, HashHighway256, repository.HashKey)
+	if !isDeterministicEncryption(opts.Encrypt) {
+		// the same data never results in the same ciphertext twice, so
+		// we need to derive the chunk's ID from its content instead
+		hashsum = chunkID(repository.Key, orighashsum, opts)
+	}
+
+	c := Chunk{
+		DataParts:     opts.DataParts,
+		ParityParts:   opts.ParityParts,
+		OriginalSize:  len(data),
+		Size:          len(b),
+		DecryptedHash: orighashsum,
+		Hash:          hashsum,
+		Num:           num,
+	}
+
+	if opts.ParityParts > 0 {
+		pars, err := redundantData(b, int(opts.DataParts), int(opts.ParityParts))
+		if err != nil {
+			return Chunk{}, err
 		}
+		c.Data = &pars
+	} else {
+		c.DataParts = 1
+		c.Data = &[][]byte{b}
+	}
 
-		chunks <- ChunkResult{Chunk: c}
-		wg.Done()
+	return c, nil
+}
+
+// isZero returns true if b only contains zeros.
+func isZero(b []byte) bool {
+	for _, v := range b {
+		if v != 0 {
+			return false
+		}
 	}
+	return true
 }
 
-// chunkFile divides filename into chunks of 1MiB each.
-func chunkFile(filename string, password string, opts StoreOptions) (<-chan ChunkResult, error) {
-	c := make(chan ChunkResult)
+// chunkID returns a keyed ID for a chunk with the given content hash, which
+// stays the same as long as the chunk gets encoded the same way.
+func chunkID(key, hashsum string, opts StoreOptions) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	_, _ = mac.Write([]byte(hashsum + ":" +
+		strconv.FormatUint(uint64(opts.Compress), 10) + ":" +
+		strconv.FormatUint(uint64(opts.Encrypt), 10)))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
 
+// chunkFile divides filename into chunks, according to the repository's
+// chunker config.
+func chunkFile(filename string, repository *Repository, opts StoreOptions) (<-chan ChunkResult, error) {
 	file, err := os.Open(filename)
 	if err != nil {
-		return c, err
+		return make(chan ChunkResult), err
 	}
 
+	return chunkReader(file, repository, opts), nil
+}
+
+// chunkReader splits the content of r into chunks and processes them. r gets
+// closed once it has been read entirely.
+func chunkReader(r io.ReadCloser, repository *Repository, opts StoreOptions) <-chan ChunkResult {
+	c := make(chan ChunkResult)
+
 	wg := &sync.WaitGroup{}
 	jobs := make(chan inputChunk)
 	for w := 1; w <= 4; w++ {
-		go processChunk(password, opts, jobs, c, wg)
+		go processChunk(repository, opts, jobs, c, wg)
 	}
 
 	wg.Add(1)
 	go func() {
-		chunker := chunker.NewWithBoundaries(file, chunker.Pol(0x3DA3358B4DC173), chunker.MinSize, preferredChunkSize)
+		cfg := repository.Chunker
+		chunker := chunker.NewWithBoundaries(r, chunker.Pol(cfg.Polynomial), cfg.MinSize, cfg.MaxSize)
+		chunker.SetAverageBits(bits.Len(cfg.AvgSize) - 1)
 
 		i := uint(0)
 		for {
-			buf := make([]byte, preferredChunkSize)
+			buf := make([]byte, cfg.MaxSize)
 			chunk, err := chunker.Next(buf)
 			if err == io.EOF {
 				wg.Done()
@@ -128,7 +250,7 @@ func chunkFile(filename string, password string, opts StoreOptions) (<-chan Chun
 			i++
 			jobs <- j
 		}
-		_ = file.Close()
+		_ = r.Close()
 	}()
 
 	go func() {
@@ -137,5 +259,5 @@ func chunkFile(filename string, password string, opts StoreOptions) (<-chan Chun
 		close(c)
 	}()
 
-	return c, nil
+	return c
 }
@@ -8,74 +8,168 @@
 package knoxite
 
 import (
+	"errors"
 	"fmt"
+	"time"
+)
+
+// Error declarations.
+var (
+	ErrReindexPacked = errors.New("can't re-index snapshots with chunks stored in packs")
 )
 
 // A ChunkIndexItem links a chunk with one or many snapshots.
 type ChunkIndexItem struct {
-	Hash        string   `json:"hash"`
-	DataParts   uint     `json:"data_parts"`
-	ParityParts uint     `json:"parity_parts"`
-	Size        int      `json:"size"`
-	Snapshots   []string `json:"snapshots"`
+	Hash        string         `json:"hash"`
+	DataParts   uint           `json:"data_parts"`
+	ParityParts uint           `json:"parity_parts"`
+	Size        int            `json:"size"`
+	Snapshots   []string       `json:"snapshots"`
+	Packs       []PackLocation `json:"packs,omitempty"` // location of each part
 }
 
-// A ChunkIndex links chunks with snapshots.
+// A ChunkIndex links chunks with snapshots. It is stored as a set of
+// immutable, content-addressed index segments, which get merged when the
+// index is opened. Every Save appends a new segment containing only the
+// changes made since the index was opened, while Pack compacts all segments
+// into a single one.
 type ChunkIndex struct {
-	Chunks map[string]*ChunkIndexItem `json:"chunks"`
+	Chunks    map[string]*ChunkIndexItem `json:"chunks"`
+	PackSizes map[string]uint64          `json:"pack_sizes"`
+
+	segments   []string                   // IDs of the segments merged into Chunks
+	added      map[string]*ChunkIndexItem // references added since the last save
+	addedPacks map[string]uint64          // packs stored since the last save
+	removed    []string                   // snapshots removed since the last save
+}
+
+// An indexSegment holds the changes made to a chunk-index in one session.
+type indexSegment struct {
+	Chunks           map[string]*ChunkIndexItem `json:"chunks"`
+	PackSizes        map[string]uint64          `json:"pack_sizes"`
+	RemovedSnapshots []string                   `json:"removed_snapshots"`
 }
 
-// OpenChunkIndex opens an existing chunkindex.
+// newChunkIndex returns an empty chunk-index.
+func newChunkIndex() ChunkIndex {
+	return ChunkIndex{
+		Chunks:     make(map[string]*ChunkIndexItem),
+		PackSizes:  make(map[string]uint64),
+		added:      make(map[string]*ChunkIndexItem),
+		addedPacks: make(map[string]uint64),
+	}
+}
+
+// OpenChunkIndex opens an existing chunkindex. Hosts without the private key
+// of a write-only repository can't read its sealed segments and get an empty
+// index, which only collects the chunks they store themselves.
 func OpenChunkIndex(repository *Repository) (ChunkIndex, error) {
-	index := ChunkIndex{
-		Chunks: make(map[string]*ChunkIndexItem),
+	index := newChunkIndex()
+	if repository.sealed() {
+		return index, nil
 	}
 
-	b, err := repository.backend.LoadChunkIndex()
+	ids, err := repository.backend.ListIndexSegments()
 	if err != nil {
+		return index, err
+	}
+	if len(ids) == 0 {
+		// the monolithic chunk-index might not have been readable while the
+		// repository got migrated
+		err = repository.migrateChunkIndex()
+		if err != nil {
+			return index, err
+		}
+		ids, err = repository.backend.ListIndexSegments()
+		if err != nil {
+			return index, err
+		}
+	}
+
+	if len(ids) == 0 {
 		if !repository.IsEmpty() {
-			fmt.Println("Chunk-Index is empty, re-indexing all snapshots...")
+			log.Info("Chunk-Index is empty, re-indexing all snapshots...")
 			err = index.reindex(repository)
 			if err != nil {
 				return index, err
 			}
-			fmt.Println("Successfully re-indexed snapshots.")
+			log.Info("Successfully re-indexed snapshots.")
 		}
 
 		err = index.Save(repository)
 		return index, err
 	}
 
-	pipe, err := NewDecodingPipeline(CompressionLZMA, EncryptionAES, repository.Key)
-	if err != nil {
-		return index, err
+	// removals get applied after all segments have been merged, as segments
+	// aren't ordered and a snapshot never gets re-added once it was removed
+	removed := []string{}
+	for _, id := range ids {
+		segment, err := loadIndexSegment(repository, id)
+		if err != nil {
+			return index, err
+		}
+
+		index.merge(segment)
+		removed = append(removed, segment.RemovedSnapshots...)
+		index.segments = append(index.segments, id)
 	}
-	err = pipe.Decode(b, &index)
-	return index, err
+	for _, snapshot := range removed {
+		index.removeSnapshot(snapshot)
+	}
+
+	return index, nil
 }
 
-// Save writes a chunk-index.
+// Save writes all changes made to the chunk-index since it was opened or last
+// saved as a new index segment.
 func (index *ChunkIndex) Save(repository *Repository) error {
-	pipe, err := NewEncodingPipeline(CompressionLZMA, EncryptionAES, repository.Key)
-	if err != nil {
-		return err
+	if len(index.added) == 0 && len(index.addedPacks) == 0 && len(index.removed) == 0 {
+		return nil
 	}
-	b, err := pipe.Encode(index)
+
+	id, err := saveIndexSegment(repository, indexSegment{
+		Chunks:           index.added,
+		PackSizes:        index.addedPacks,
+		RemovedSnapshots: index.removed,
+	})
 	if err != nil {
 		return err
 	}
-	return repository.backend.SaveChunkIndex(b)
+
+	index.segments = append(index.segments, id)
+	index.resetPending()
+	return nil
+}
+
+// Pack deletes unreferenced chunks and removes them from the index. Packs
+// which only contain unreferenced chunks get deleted, while the chunks still
+// referenced in partially unused packs get repacked. All index segments get
+// compacted into a single one.
+func (index *ChunkIndex) Pack(repository *Repository) (uint64, error) {
+	return index.PackWithProgress(repository, nil)
 }
 
-// Pack deletes unreferenced chunks and removes them from the index.
-func (index *ChunkIndex) Pack(repository *Repository) (freedSize uint64, err error) {
+// PackWithProgress packs the repository like Pack and reports every repacked
+// chunk to reporter, which may be nil. Packing a write-only repository
+// requires its private key, as it needs to know the entire chunk-index.
+func (index *ChunkIndex) PackWithProgress(repository *Repository, reporter ProgressReporter) (freedSize uint64, err error) {
+	if repository.sealed() {
+		return 0, ErrPrivateKeyRequired
+	}
+	if reporter == nil {
+		reporter = nopProgressReporter{}
+	}
 	chunks := make(map[string]*ChunkIndexItem)
 
 	for _, chunk := range index.Chunks {
 		// fmt.Printf("Chunk %s referenced in Snapshots %+v\n", chunk.Hash, chunk.Snapshots)
 		if len(chunk.Snapshots) == 0 {
-			fmt.Printf("Chunk %s is no longer referenced by any snapshot. Deleting!\n", chunk.Hash)
+			if len(chunk.Packs) > 0 {
+				// packed chunks get freed when their pack is deleted
+				continue
+			}
 
+			log.Infof("Chunk %s is no longer referenced by any snapshot. Deleting!", chunk.Hash)
 			for i := uint(0); i < chunk.DataParts+chunk.ParityParts; i++ {
 				err = repository.backend.DeleteChunk(chunk.Hash, i, chunk.DataParts)
 				if err != nil {
@@ -89,9 +183,176 @@ func (index *ChunkIndex) Pack(repository *Repository) (freedSize uint64, err err
 	}
 
 	index.Chunks = chunks
+	packSizes, unpacked, err := index.repack(repository, NewProgressTracker(reporter))
+	if err != nil {
+		return
+	}
+
+	// write the compacted segment before deleting the old ones, so an
+	// interruption never leaves us without an index
+	id, err := saveIndexSegment(repository, indexSegment{
+		Chunks:           chunks,
+		PackSizes:        packSizes,
+		RemovedSnapshots: []string{},
+	})
+	if err != nil {
+		return
+	}
+	for _, sid := range index.segments {
+		if sid == id {
+			continue
+		}
+		err = repository.backend.DeleteIndexSegment(sid)
+		if err != nil {
+			return
+		}
+	}
+
+	// the chunks moved into packs are only referenced by their packs now
+	for hash, parts := range unpacked {
+		chunk := chunks[hash]
+		for _, part := range parts {
+			err = repository.backend.DeleteChunk(hash, part, chunk.DataParts)
+			if err != nil {
+				return
+			}
+			freedSize += chunk.Packs[part].Length
+		}
+	}
+
+	for pid, size := range index.PackSizes {
+		if _, ok := packSizes[pid]; ok {
+			continue
+		}
+		err = repository.backend.DeletePack(pid)
+		if err != nil {
+			return
+		}
+		freedSize += size
+	}
+	for pid, size := range packSizes {
+		if _, ok := index.PackSizes[pid]; !ok {
+			freedSize -= size
+		}
+	}
+
+	index.PackSizes = packSizes
+	index.segments = []string{id}
+	index.resetPending()
 	return
 }
 
+// repack moves all chunk parts stored in partially unused packs into new
+// packs, along with the parts of chunks stored before packs were introduced.
+// It returns the sizes of all packs still in use afterwards and the parts,
+// which were stored on their own and can be deleted once the chunk-index has
+// been saved.
+func (index *ChunkIndex) repack(repository *Repository, tracker *ProgressTracker) (map[string]uint64, map[string][]uint, error) {
+	used := make(map[string]uint64)
+	for _, chunk := range index.Chunks {
+		for _, loc := range chunk.Packs {
+			used[loc.Pack] += loc.Length
+		}
+	}
+
+	packSizes := make(map[string]uint64)
+	for pid, size := range index.PackSizes {
+		if used[pid] == size {
+			packSizes[pid] = size
+		}
+	}
+
+	backend := repository.backend
+	backend.packer = newPacker(DefaultPackSize)
+
+	// the size of all chunk parts which need to be moved
+	sizes := make(map[string]uint64)
+	total := Stats{}
+	unpacked := make(map[string][]uint)
+	for _, chunk := range index.Chunks {
+		for _, loc := range chunk.Packs {
+			if _, ok := packSizes[loc.Pack]; !ok && loc.Pack != "" {
+				sizes[chunk.Hash] += loc.Length
+				total.Size += loc.Length
+			}
+		}
+		for part := uint(0); part < chunk.DataParts+chunk.ParityParts; part++ {
+			if part < uint(len(chunk.Packs)) && chunk.Packs[part].Pack != "" {
+				continue
+			}
+			// the exact size of a part isn't known before it's loaded
+			unpacked[chunk.Hash] = append(unpacked[chunk.Hash], part)
+			sizes[chunk.Hash] += uint64(chunk.Size) / uint64(chunk.DataParts)
+			total.Size += uint64(chunk.Size) / uint64(chunk.DataParts)
+		}
+	}
+
+	for _, chunk := range index.Chunks {
+		if sizes[chunk.Hash] == 0 && len(unpacked[chunk.Hash]) == 0 {
+			continue
+		}
+		p := Progress{
+			Path:             chunk.Hash,
+			Timer:            time.Now(),
+			CurrentItemStats: Stats{Size: sizes[chunk.Hash]},
+			TotalStatistics:  total,
+		}
+		tracker.Update(p)
+
+		for part, loc := range chunk.Packs {
+			if _, ok := packSizes[loc.Pack]; ok || loc.Pack == "" {
+				continue
+			}
+
+			b, err := backend.LoadPack(loc)
+			if err != nil {
+				return nil, nil, err
+			}
+			// parts of the same chunk still end up on different backends
+			err = backend.packer.add(&backend, part%len(backend.Backends), chunk.Hash, uint(part), b)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			p.CurrentItemStats.Transferred += loc.Length
+			total.Transferred += loc.Length
+			p.TotalStatistics = total
+			tracker.Update(p)
+		}
+		for _, part := range unpacked[chunk.Hash] {
+			b, err := backend.LoadChunk(Chunk{Hash: chunk.Hash, DataParts: chunk.DataParts}, part)
+			if err != nil {
+				return nil, nil, err
+			}
+			err = backend.packer.add(&backend, int(part)%len(backend.Backends), chunk.Hash, part, b)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			p.CurrentItemStats.Transferred += uint64(len(b))
+			total.Transferred += uint64(len(b))
+			p.TotalStatistics = total
+			tracker.Update(p)
+		}
+	}
+	tracker.Close()
+
+	parts, packs, err := backend.packer.flush(&backend)
+	if err != nil {
+		return nil, nil, err
+	}
+	index.addPacked(parts, packs)
+	repository.packs.add(parts)
+
+	for pid, size := range packs {
+		packSizes[pid] = size
+	}
+	return packSizes, unpacked, nil
+}
+
+// reindex rebuilds the chunk-index from all snapshots. The locations of
+// chunks stored in packs are only recorded in the chunk-index, so snapshots
+// containing packed chunks can't be re-indexed.
 func (index *ChunkIndex) reindex(repository *Repository) error {
 	for _, vol := range repository.Volumes {
 		for _, snapshotID := range vol.Snapshots {
@@ -100,6 +361,13 @@ func (index *ChunkIndex) reindex(repository *Repository) error {
 				return err
 			}
 
+			for _, archive := range snapshot.Archives {
+				for _, chunk := range archive.Chunks {
+					if chunk.Packed {
+						return fmt.Errorf("%w: snapshot %s", ErrReindexPacked, snapshot.ID)
+					}
+				}
+			}
 			for _, archive := range snapshot.Archives {
 				index.AddArchive(archive, snapshot.ID)
 			}
@@ -112,24 +380,22 @@ func (index *ChunkIndex) reindex(repository *Repository) error {
 // AddArchive updates chunk-index with the new chunks.
 func (index *ChunkIndex) AddArchive(archive *Archive, snapshot string) {
 	for _, chunk := range archive.Chunks {
-		c, ok := index.Chunks[chunk.Hash]
-		if ok {
-			c.Snapshots = append(c.Snapshots, snapshot)
-		} else {
-			chunkItem := ChunkIndexItem{
-				Hash:        chunk.Hash,
-				DataParts:   chunk.DataParts,
-				ParityParts: chunk.ParityParts,
-				Size:        chunk.Size,
-				Snapshots:   []string{snapshot},
-			}
-			index.Chunks[chunk.Hash] = &chunkItem
+		if chunk.Sparse {
+			// sparse chunks aren't stored anywhere
+			continue
 		}
+		addChunkReference(index.Chunks, chunk, snapshot)
+		addChunkReference(index.added, chunk, snapshot)
 	}
 }
 
 // RemoveSnapshot removes all references to snapshot from the chunk-index.
 func (index *ChunkIndex) RemoveSnapshot(snapshot string) {
+	index.removeSnapshot(snapshot)
+	index.removed = append(index.removed, snapshot)
+}
+
+func (index *ChunkIndex) removeSnapshot(snapshot string) {
 	for _, chunk := range index.Chunks {
 		snapshots := []string{}
 		for _, s := range chunk.Snapshots {
@@ -141,3 +407,123 @@ func (index *ChunkIndex) RemoveSnapshot(snapshot string) {
 		chunk.Snapshots = snapshots
 	}
 }
+
+// merge adds the chunk references of an index segment to the chunk-index.
+func (index *ChunkIndex) merge(segment indexSegment) {
+	for hash, chunk := range segment.Chunks {
+		c, ok := index.Chunks[hash]
+		if !ok {
+			index.Chunks[hash] = chunk
+			continue
+		}
+
+		for _, s := range chunk.Snapshots {
+			if !containsString(c.Snapshots, s) {
+				c.Snapshots = append(c.Snapshots, s)
+			}
+		}
+		if len(c.Packs) == 0 {
+			c.Packs = chunk.Packs
+		}
+	}
+
+	for pid, size := range segment.PackSizes {
+		index.PackSizes[pid] = size
+	}
+}
+
+// addPacked records the locations of chunk parts, which have just been
+// stored in packs.
+func (index *ChunkIndex) addPacked(parts []packedPart, packs map[string]uint64) {
+	for _, part := range parts {
+		c, ok := index.Chunks[part.Hash]
+		if !ok {
+			// the chunk's archive never made it into the index
+			continue
+		}
+		c.Packs = setPackLocation(c.Packs, part.Part, part.Location)
+
+		a, ok := index.added[part.Hash]
+		if !ok {
+			a = &ChunkIndexItem{
+				Hash:        c.Hash,
+				DataParts:   c.DataParts,
+				ParityParts: c.ParityParts,
+				Size:        c.Size,
+			}
+			index.added[part.Hash] = a
+		}
+		a.Packs = setPackLocation(a.Packs, part.Part, part.Location)
+	}
+
+	for pid, size := range packs {
+		index.PackSizes[pid] = size
+		index.addedPacks[pid] = size
+	}
+}
+
+// resetPending forgets about all changes since the last save.
+func (index *ChunkIndex) resetPending() {
+	index.added = make(map[string]*ChunkIndexItem)
+	index.addedPacks = make(map[string]uint64)
+	index.removed = []string{}
+}
+
+func addChunkReference(chunks map[string]*ChunkIndexItem, chunk Chunk, snapshot string) {
+	c, ok := chunks[chunk.Hash]
+	if ok {
+		c.Snapshots = append(c.Snapshots, snapshot)
+	} else {
+		chunkItem := ChunkIndexItem{
+			Hash:        chunk.Hash,
+			DataParts:   chunk.DataParts,
+			ParityParts: chunk.ParityParts,
+			Size:        chunk.Size,
+			Snapshots:   []string{snapshot},
+		}
+		chunks[chunk.Hash] = &chunkItem
+	}
+}
+
+func containsString(l []string, s string) bool {
+	for _, v := range l {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// loadIndexSegment loads and decodes an index segment.
+func loadIndexSegment(repository *Repository, id string) (indexSegment, error) {
+	var segment indexSegment
+
+	b, err := repository.backend.LoadIndexSegment(id)
+	if err != nil {
+		return segment, err
+	}
+	encryption := repository.sealedEncryption()
+	pipe, err := NewDecodingPipeline(CompressionLZMA, encryption, repository.decryptionKey(encryption))
+	if err != nil {
+		return segment, err
+	}
+	err = pipe.Decode(b, &segment)
+	return segment, err
+}
+
+// saveIndexSegment encodes and stores an index segment. Its ID is derived
+// from its encoded content, so segments never get overwritten.
+func saveIndexSegment(repository *Repository, segment indexSegment) (string, error) {
+	encryption := repository.sealedEncryption()
+	pipe, err := NewEncodingPipeline(CompressionLZMA, encryption, repository.encryptionKey(encryption))
+	if err != nil {
+		return "", err
+	}
+	b, err := pipe.Encode(segment)
+	if err != nil {
+		return "", err
+	}
+
+	id := Hash(b, HashSha256)
+	return id, repository.backend.SaveIndexSegment(id, b)
+}
@@ -8,8 +8,11 @@
 package knoxite
 
 import (
+	"bytes"
+	"errors"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -58,10 +61,30 @@ func TestChunkIndexReindex(t *testing.T) {
 	if err != nil {
 		t.Errorf("Failed reopening chunk-index: %s", err)
 	}
+	// the locations of packed chunks can't be recovered from snapshots
+	err = newindex.reindex(&r)
+	if !errors.Is(err, ErrReindexPacked) {
+		t.Errorf("Expected %v, got %v", ErrReindexPacked, err)
+	}
+
+	// pretend the snapshot was stored before packs were introduced
+	for _, archive := range snapshot.Archives {
+		for i := range archive.Chunks {
+			archive.Chunks[i].Packed = false
+		}
+	}
+	_ = snapshot.Save(&r)
+
+	newindex, _ = OpenChunkIndex(&r)
 	err = newindex.reindex(&r)
 	if err != nil {
 		t.Errorf("Failed reindexing chunk-index: %s", err)
 	}
+	for hash, c := range index.Chunks {
+		if nc, ok := newindex.Chunks[hash]; !ok || !containsString(nc.Snapshots, snapshot.ID) {
+			t.Errorf("Expected chunk %s %v to be re-indexed, got %v", hash, c, nc)
+		}
+	}
 }
 
 func TestChunkIndexPack(t *testing.T) {
@@ -123,3 +146,370 @@ func TestChunkIndexPack(t *testing.T) {
 		t.Errorf("Packing chunk index failed: %s", err)
 	}
 }
+
+func TestChunkIndexSegments(t *testing.T) {
+	testPassword := "this_is_a_password"
+
+	dir, err := ioutil.TempDir("", "knoxite")
+	if err != nil {
+		t.Errorf("Failed creating temporary dir for repository: %s", err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	r, _ := NewRepository(dir, testPassword)
+	vol, _ := NewVolume("test", "")
+	_ = r.AddVolume(vol)
+	wd, _ := os.Getwd()
+
+	// every backup appends its own segment
+	var snapshots []*Snapshot
+	for _, path := range []string{"snapshot.go", "chunkindex.go"} {
+		index, err := OpenChunkIndex(&r)
+		if err != nil {
+			t.Errorf("Failed opening chunk-index: %s", err)
+			return
+		}
+
+		snapshot, _ := NewSnapshot("test_snapshot")
+		opts := StoreOptions{
+			CWD:         wd,
+			Paths:       []string{path},
+			Excludes:    []string{},
+			Compress:    CompressionNone,
+			Encrypt:     EncryptionAESGCM,
+			DataParts:   1,
+			ParityParts: 0,
+		}
+		progress := snapshot.Add(r, &index, opts)
+		for p := range progress {
+			if p.Error != nil {
+				t.Errorf("Failed adding to snapshot: %s", p.Error)
+			}
+		}
+
+		_ = snapshot.Save(&r)
+		_ = vol.AddSnapshot(snapshot.ID)
+		if err = index.Save(&r); err != nil {
+			t.Errorf("Failed saving chunk-index: %s", err)
+			return
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+
+	segments, _ := r.backend.ListIndexSegments()
+	if len(segments) != 2 {
+		t.Errorf("Expected 2 index segments, got %d", len(segments))
+	}
+
+	index, err := OpenChunkIndex(&r)
+	if err != nil {
+		t.Errorf("Failed opening chunk-index: %s", err)
+		return
+	}
+	for _, snapshot := range snapshots {
+		for _, archive := range snapshot.Archives {
+			for _, chunk := range archive.Chunks {
+				c, ok := index.Chunks[chunk.Hash]
+				if !ok || !containsString(c.Snapshots, snapshot.ID) {
+					t.Errorf("Chunk %s of snapshot %s is missing in the merged chunk-index", chunk.Hash, snapshot.ID)
+				}
+			}
+		}
+	}
+
+	// removals get stored as a segment of their own
+	_ = vol.RemoveSnapshot(snapshots[0].ID)
+	index.RemoveSnapshot(snapshots[0].ID)
+	if err = index.Save(&r); err != nil {
+		t.Errorf("Failed saving chunk-index: %s", err)
+		return
+	}
+	index, _ = OpenChunkIndex(&r)
+	for _, c := range index.Chunks {
+		if containsString(c.Snapshots, snapshots[0].ID) {
+			t.Errorf("Chunk %s still references removed snapshot %s", c.Hash, snapshots[0].ID)
+		}
+	}
+
+	// packing compacts all segments into a single one
+	if _, err = index.Pack(&r); err != nil {
+		t.Errorf("Packing chunk index failed: %s", err)
+	}
+	segments, _ = r.backend.ListIndexSegments()
+	if len(segments) != 1 {
+		t.Errorf("Expected 1 index segment after packing, got %d", len(segments))
+	}
+	packed, _ := OpenChunkIndex(&r)
+	if len(packed.Chunks) != len(index.Chunks) {
+		t.Errorf("Expected %d chunks after packing, got %d", len(index.Chunks), len(packed.Chunks))
+	}
+}
+
+func TestChunkIndexMigrate(t *testing.T) {
+	testPassword := "this_is_a_password"
+
+	dir, err := ioutil.TempDir("", "knoxite")
+	if err != nil {
+		t.Errorf("Failed creating temporary dir for repository: %s", err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	r, _ := NewRepository(dir, testPassword)
+	vol, _ := NewVolume("test", "")
+	_ = r.AddVolume(vol)
+	wd, _ := os.Getwd()
+
+	// pretend this is a version 6 repository with a monolithic chunk-index
+	r.Version = 6
+	r.HashKey = nil
+	index, _ := OpenChunkIndex(&r)
+	snapshot, _ := NewSnapshot("test_snapshot")
+	opts := StoreOptions{
+		CWD:         wd,
+		Paths:       []string{"chunkindex.go"},
+		Excludes:    []string{},
+		Compress:    CompressionNone,
+		Encrypt:     EncryptionAESGCM,
+		DataParts:   1,
+		ParityParts: 0,
+	}
+	for p := range snapshot.Add(r, &index, opts) {
+		if p.Error != nil {
+			t.Errorf("Failed adding to snapshot: %s", p.Error)
+		}
+	}
+	_ = snapshot.Save(&r)
+	_ = vol.AddSnapshot(snapshot.ID)
+
+	legacy := ChunkIndex{Chunks: index.Chunks}
+	pipe, _ := NewEncodingPipeline(CompressionLZMA, r.metadataEncryption(), r.Key)
+	b, _ := pipe.Encode(legacy)
+	if err = r.backend.SaveChunkIndex(b); err != nil {
+		t.Errorf("Failed saving chunk-index: %s", err)
+		return
+	}
+	_ = r.Save()
+
+	r, err = OpenRepository(dir, testPassword)
+	if err != nil {
+		t.Errorf("Failed opening repository: %s", err)
+		return
+	}
+	_, snapshot, err = r.FindSnapshot(snapshot.ID)
+	if err != nil {
+		t.Errorf("Failed finding snapshot after migration: %s", err)
+		return
+	}
+	index, err = OpenChunkIndex(&r)
+	if err != nil {
+		t.Errorf("Failed opening chunk-index: %s", err)
+		return
+	}
+	for _, chunk := range snapshot.Archives["chunkindex.go"].Chunks {
+		c, ok := index.Chunks[chunk.Hash]
+		if !ok || c.Size != chunk.Size || !containsString(c.Snapshots, snapshot.ID) {
+			t.Errorf("Chunk-index has not been migrated, got %+v", index.Chunks)
+		}
+	}
+	if _, err = r.backend.LoadChunkIndex(); err == nil {
+		t.Errorf("Expected the monolithic chunk-index to be deleted")
+	}
+
+	// a chunk-index, which couldn't be migrated along with its repository,
+	// gets imported as soon as it's available
+	_ = os.RemoveAll(filepath.Join(dir, "index"))
+	if err = r.backend.SaveChunkIndex(b); err != nil {
+		t.Errorf("Failed saving chunk-index: %s", err)
+		return
+	}
+	index, err = OpenChunkIndex(&r)
+	if err != nil {
+		t.Errorf("Failed opening chunk-index: %s", err)
+		return
+	}
+	for hash := range legacy.Chunks {
+		if _, ok := index.Chunks[hash]; !ok {
+			t.Errorf("Chunk-index has not been imported, got %+v", index.Chunks)
+		}
+	}
+	if _, err = r.backend.LoadChunkIndex(); err == nil {
+		t.Errorf("Expected the monolithic chunk-index to be deleted")
+	}
+}
+
+func TestChunkIndexRepack(t *testing.T) {
+	testPassword := "this_is_a_password"
+
+	dir, err := ioutil.TempDir("", "knoxite")
+	if err != nil {
+		t.Errorf("Failed creating temporary dir for repository: %s", err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	r, _ := NewRepository(dir, testPassword)
+	vol, _ := NewVolume("test", "")
+	_ = r.AddVolume(vol)
+	wd, _ := os.Getwd()
+
+	// both snapshots contain snapshot.go, which only gets stored once. Its pack
+	// stays partially used once the first snapshot gets removed
+	var snapshots []*Snapshot
+	for _, paths := range [][]string{{"snapshot.go", "chunkindex.go"}, {"snapshot.go", "pack.go"}} {
+		index, _ := OpenChunkIndex(&r)
+		snapshot, _ := NewSnapshot("test_snapshot")
+		opts := StoreOptions{
+			CWD:         wd,
+			Paths:       paths,
+			Excludes:    []string{},
+			Compress:    CompressionNone,
+			Encrypt:     EncryptionAESGCM,
+			DataParts:   1,
+			ParityParts: 0,
+		}
+		progress := snapshot.Add(r, &index, opts)
+		for p := range progress {
+			if p.Error != nil {
+				t.Errorf("Failed adding to snapshot: %s", p.Error)
+			}
+		}
+
+		_ = snapshot.Save(&r)
+		_ = vol.AddSnapshot(snapshot.ID)
+		_ = index.Save(&r)
+		snapshots = append(snapshots, snapshot)
+	}
+	if n := countFiles(filepath.Join(dir, "packs")); n != 2 {
+		t.Errorf("Expected 2 packs, got %d", n)
+	}
+	size := dirSize(filepath.Join(dir, "packs"))
+
+	index, _ := OpenChunkIndex(&r)
+	_ = vol.RemoveSnapshot(snapshots[0].ID)
+	index.RemoveSnapshot(snapshots[0].ID)
+	_ = r.Save()
+	if _, err = index.Pack(&r); err != nil {
+		t.Errorf("Packing chunk index failed: %s", err)
+		return
+	}
+	if n := countFiles(filepath.Join(dir, "packs")); n != 2 {
+		t.Errorf("Expected 2 packs after packing, got %d", n)
+	}
+	if dirSize(filepath.Join(dir, "packs")) >= size {
+		t.Errorf("Expected the partially used pack to be repacked")
+	}
+
+	// the remaining snapshot must still be restorable from the new pack
+	r, err = OpenRepository(dir, testPassword)
+	if err != nil {
+		t.Errorf("Failed opening repository: %s", err)
+		return
+	}
+	targetdir, _ := ioutil.TempDir("", "knoxite.target")
+	defer os.RemoveAll(targetdir)
+
+	progress, err := DecodeSnapshot(r, snapshots[1], targetdir, []string{}, false)
+	if err != nil {
+		t.Errorf("Failed restoring snapshot: %s", err)
+		return
+	}
+	for p := range progress {
+		if p.Error != nil {
+			t.Errorf("Failed restoring snapshot: %s", p.Error)
+		}
+	}
+
+	b1, _ := ioutil.ReadFile("snapshot.go")
+	b2, err := ioutil.ReadFile(filepath.Join(targetdir, "snapshot.go"))
+	if err != nil || !bytes.Equal(b1, b2) {
+		t.Errorf("Restored file differs from original: %v", err)
+	}
+}
+
+func TestChunkIndexPackLegacy(t *testing.T) {
+	testPassword := "this_is_a_password"
+
+	dir, err := ioutil.TempDir("", "knoxite")
+	if err != nil {
+		t.Errorf("Failed creating temporary dir for repository: %s", err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	r, _ := NewRepository(dir, testPassword)
+	index, _ := OpenChunkIndex(&r)
+
+	// chunks stored before packs were introduced are stored on their own
+	data := []byte("this_is_some_legacy_data")
+	hash := HashWithKey(data, HashHighway256, r.HashKey)
+	chunk := Chunk{
+		Data:          &[][]byte{data},
+		DataParts:     1,
+		OriginalSize:  len(data),
+		Size:          len(data),
+		DecryptedHash: hash,
+		Hash:          hash,
+	}
+	if _, err = r.backend.StoreChunk(chunk); err != nil {
+		t.Errorf("Failed storing chunk: %s", err)
+		return
+	}
+	archive := &Archive{
+		Path:       "legacy",
+		Type:       File,
+		Size:       uint64(len(data)),
+		Chunks:     []Chunk{chunk},
+		Compressed: CompressionNone,
+		Encrypted:  EncryptionNone,
+	}
+	index.AddArchive(archive, "s1")
+	_ = index.Save(&r)
+	if n := countFiles(filepath.Join(dir, "chunks")); n != 1 {
+		t.Errorf("Expected 1 legacy chunk, got %d", n)
+	}
+
+	if _, err = index.Pack(&r); err != nil {
+		t.Errorf("Packing chunk index failed: %s", err)
+		return
+	}
+	if n := countFiles(filepath.Join(dir, "chunks")); n != 0 {
+		t.Errorf("Expected legacy chunks to be deleted, got %d", n)
+	}
+	if n := countFiles(filepath.Join(dir, "packs")); n != 1 {
+		t.Errorf("Expected legacy chunks to be moved into 1 pack, got %d", n)
+	}
+
+	r, err = OpenRepository(dir, testPassword)
+	if err != nil {
+		t.Errorf("Failed opening repository: %s", err)
+		return
+	}
+	b, _, err := DecodeArchiveData(r, *archive)
+	if err != nil || !bytes.Equal(b, data) {
+		t.Errorf("Expected data to be restored from its pack, got %q: %v", b, err)
+	}
+}
+
+func dirSize(dir string) int64 {
+	var size int64
+	_ = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
+
+func countFiles(dir string) int {
+	n := 0
+	_ = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			n++
+		}
+		return nil
+	})
+	return n
+}
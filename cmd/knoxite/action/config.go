@@ -37,8 +37,9 @@ func ActionConfigKeys(cmd *cobra.Command) carapace.Action {
 				"url", "Repository directory to backup to/restore from",
 				"compression", "Compression algo to use: none (default), flate, gzip, lzma, zlib, zstd",
 				"tolerance", "Failure tolerance against n backend failures",
-				"encryption", "Encryption algo to use: aes (default), none",
+				"encryption", "Encryption algo to use: aes (default, AES-GCM), aes-cfb (legacy), none",
 				"pedantic", "Stop backup operation after the first error occurred",
+				"pack_size", "Target size of pack files, e.g. 16MiB (default)",
 				"store_excludes", "Specify excludes for the store operation",
 				"restore_excludes", "Specify excludes for the restore operation",
 			)
@@ -56,7 +57,7 @@ func ActionConfigValues(key string) carapace.Action {
 		case "compression":
 			return carapace.ActionValues("none", "flate", "gzip", "lzma", "zlib", "zstd")
 		case "encryption":
-			return carapace.ActionValues("aes", "none")
+			return carapace.ActionValues("aes", "aes-cfb", "none")
 		case "pedantic":
 			return carapace.ActionValues("true", "false")
 		default:
@@ -57,3 +57,13 @@ func actionRepository(cmd *cobra.Command, f func(repository knoxite.Repository)
 		return f(repository)
 	})
 }
+
+func ActionKeySlots(cmd *cobra.Command) carapace.Action {
+	return actionRepository(cmd, func(repository knoxite.Repository) carapace.Action {
+		vals := make([]string, 0)
+		for _, slot := range repository.KeySlots() {
+			vals = append(vals, slot.ID, slot.Label)
+		}
+		return carapace.ActionValuesDescribed(vals...)
+	})
+}
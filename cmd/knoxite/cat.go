@@ -9,6 +9,7 @@ package main
 
 import (
 	"fmt"
+	"io"
 	"os"
 
 	"github.com/knoxite/knoxite"
@@ -54,12 +55,13 @@ func executeCat(snapshotID string, file string) error {
 	}
 
 	if archive, ok := snapshot.Archives[file]; ok {
-		b, _, err := knoxite.DecodeArchiveData(repository, *archive)
+		r, err := knoxite.NewArchiveReader(repository, *archive)
 		if err != nil {
 			return err
 		}
+		defer r.Close()
 
-		_, err = os.Stdout.Write(b)
+		_, err = io.Copy(os.Stdout, r)
 		return err
 	}
 
@@ -31,8 +31,8 @@ var (
 			if len(args) < 1 {
 				return fmt.Errorf("clone needs to know which snapshot to clone")
 			}
-			if len(args) < 2 {
-				return fmt.Errorf("clone needs to know which files and/or directories to work on")
+			if err := checkStoreTargets(args[1:], cloneOpts); err != nil {
+				return err
 			}
 
 			configureStoreOpts(cmd, &cloneOpts)
@@ -72,6 +72,11 @@ func executeClone(snapshotID string, args []string, opts StoreOptions) error {
 	if err != nil {
 		return err
 	}
+	unlock, err := lockRepository(&repository, true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
 	volume, s, err := repository.FindSnapshot(snapshotID)
 	if err != nil {
 		return err
@@ -87,7 +92,7 @@ func executeClone(snapshotID string, args []string, opts StoreOptions) error {
 	// release the shutdown lock
 	lock()
 
-	err = store(&repository, &chunkIndex, snapshot, targets, opts)
+	errs, err := store(&repository, &chunkIndex, snapshot, s, targets, opts)
 	if err != nil {
 		return err
 	}
@@ -111,5 +116,9 @@ func executeClone(snapshotID string, args []string, opts StoreOptions) error {
 	if err != nil {
 		return err
 	}
-	return repository.Save()
+	err = repository.Save()
+	if err != nil {
+		return err
+	}
+	return printStoreSummary(snapshot, errs)
 }
@@ -12,6 +12,7 @@ import (
 	"strconv"
 	"strings"
 
+	humanize "github.com/dustin/go-humanize"
 	"github.com/knoxite/knoxite"
 	"github.com/knoxite/knoxite/cmd/knoxite/action"
 	"github.com/knoxite/knoxite/cmd/knoxite/config"
@@ -133,7 +134,7 @@ func executeConfigAlias(alias string) error {
 		Url:         globalOpts.Repo,
 		Compression: utils.CompressionText(knoxite.CompressionNone),
 		// Tolerance:   0,
-		Encryption: utils.EncryptionText(knoxite.EncryptionAES),
+		Encryption: utils.EncryptionText(knoxite.EncryptionAESGCM),
 	}
 
 	return cfg.Save()
@@ -177,6 +178,11 @@ func executeConfigSet(option string, values []string) error {
 			return err
 		}
 		repo.Pedantic = b
+	case "pack_size":
+		if _, err := humanize.ParseBytes(values[0]); err != nil {
+			return fmt.Errorf("failed to parse %s as a size for the pack size option: %v", values[0], err)
+		}
+		repo.PackSize = values[0]
 
 	default:
 		return fmt.Errorf("unknown configuration option: %s", opt)
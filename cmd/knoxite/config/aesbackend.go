@@ -18,9 +18,9 @@ import (
 	"os"
 	"path/filepath"
 
+	"github.com/knoxite/knoxite"
 	"github.com/knoxite/knoxite/cmd/knoxite/utils"
 	"github.com/pelletier/go-toml"
-	"golang.org/x/crypto/scrypt"
 )
 
 // EncryptedHeaderPrefix is added to the encrypted configuration to make it
@@ -221,7 +221,14 @@ func deriveKey(password, salt []byte) ([]byte, []byte, error) {
 		}
 	}
 
-	key, err := scrypt.Key(password, salt, 32768, 8, 1, 32)
+	params := knoxite.KDFParams{
+		Method: knoxite.KDFScrypt,
+		Salt:   salt,
+		N:      32768,
+		R:      8,
+		P:      1,
+	}
+	key, err := params.DeriveKey(string(password))
 	if err != nil {
 		return nil, nil, err
 	}
@@ -33,8 +33,9 @@ type RepoConfig struct {
 	Url             string   `toml:"url" comment:"Repository directory to backup to/restore from"`
 	Compression     string   `toml:"compression" comment:"Compression algo to use: none (default), flate, gzip, lzma, zlib, zstd"`
 	Tolerance       uint     `toml:"tolerance" comment:"Failure tolerance against n backend failures"`
-	Encryption      string   `toml:"encryption" comment:"Encryption algo to use: aes (default), none"`
+	Encryption      string   `toml:"encryption" comment:"Encryption algo to use: aes (default, AES-GCM), aes-cfb (legacy), none"`
 	Pedantic        bool     `toml:"pedantic" comment:"Stop backup operation after the first error occurred"`
+	PackSize        string   `toml:"pack_size" comment:"Target size of pack files, e.g. 16MiB (default)"`
 	StoreExcludes   []string `toml:"store_excludes" comment:"Specify excludes for the store operation"`
 	RestoreExcludes []string `toml:"restore_excludes" comment:"Specify excludes for the restore operation"`
 }
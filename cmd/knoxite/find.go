@@ -0,0 +1,151 @@
+/*
+ * knoxite
+ *     Copyright (c) 2016-2021, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package main
+
+import (
+	"fmt"
+	"time"
+
+	humanize "github.com/dustin/go-humanize"
+	"github.com/muesli/gotable"
+	"github.com/rsteube/carapace"
+	"github.com/spf13/cobra"
+
+	"github.com/knoxite/knoxite"
+	"github.com/knoxite/knoxite/cmd/knoxite/action"
+	"github.com/knoxite/knoxite/cmd/knoxite/utils"
+)
+
+// FindOptions holds all the options that can be set for the 'find' command.
+type FindOptions struct {
+	Regexp    bool
+	MinSize   string
+	MaxSize   string
+	NewerThan string
+	OlderThan string
+	Volume    string
+	Snapshot  string
+}
+
+var (
+	findOpts = FindOptions{}
+
+	findCmd = &cobra.Command{
+		Use:   "find [pattern]",
+		Short: "find files in all snapshots",
+		Long: `The find command searches all snapshots for files matching a glob pattern,
+which is matched against the path and the filename`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) > 1 {
+				return fmt.Errorf("find expects at most one pattern")
+			}
+			pattern := ""
+			if len(args) == 1 {
+				pattern = args[0]
+			}
+			return executeFind(pattern, findOpts)
+		},
+	}
+)
+
+func init() {
+	findCmd.Flags().BoolVarP(&findOpts.Regexp, "regexp", "E", false, "treat the pattern as a regular expression")
+	findCmd.Flags().StringVar(&findOpts.MinSize, "min-size", "", "only find files of at least this size, e.g. 10MiB")
+	findCmd.Flags().StringVar(&findOpts.MaxSize, "max-size", "", "only find files of at most this size, e.g. 10MiB")
+	findCmd.Flags().StringVar(&findOpts.NewerThan, "newer-than", "", "only find files modified after this date (2006-01-02) or within this duration, e.g. 2w")
+	findCmd.Flags().StringVar(&findOpts.OlderThan, "older-than", "", "only find files modified before this date (2006-01-02) or longer ago than this duration, e.g. 1y")
+	findCmd.Flags().StringVar(&findOpts.Volume, "volume", "", "only search this volume")
+	findCmd.Flags().StringVar(&findOpts.Snapshot, "snapshot", "", "only search this snapshot")
+	RootCmd.AddCommand(findCmd)
+
+	carapace.Gen(findCmd).FlagCompletion(carapace.ActionMap{
+		"volume":   action.ActionVolumes(findCmd),
+		"snapshot": action.ActionSnapshots(findCmd, ""),
+	})
+}
+
+func executeFind(pattern string, opts FindOptions) error {
+	fo := knoxite.FindOptions{
+		Pattern:  pattern,
+		Regexp:   opts.Regexp,
+		Volume:   opts.Volume,
+		Snapshot: opts.Snapshot,
+	}
+
+	var err error
+	if opts.MinSize != "" {
+		if fo.MinSize, err = humanize.ParseBytes(opts.MinSize); err != nil {
+			return err
+		}
+	}
+	if opts.MaxSize != "" {
+		if fo.MaxSize, err = humanize.ParseBytes(opts.MaxSize); err != nil {
+			return err
+		}
+	}
+	if opts.NewerThan != "" {
+		if fo.NewerThan, err = parseTimeFilter(opts.NewerThan); err != nil {
+			return err
+		}
+	}
+	if opts.OlderThan != "" {
+		if fo.OlderThan, err = parseTimeFilter(opts.OlderThan); err != nil {
+			return err
+		}
+	}
+
+	repository, err := openRepository(globalOpts.Repo, globalOpts.Password)
+	if err != nil {
+		return err
+	}
+
+	results, err := repository.Find(fo)
+	if err != nil {
+		return err
+	}
+	if globalOpts.JSON {
+		out := []FindOutput{}
+		for _, result := range results {
+			out = append(out, FindOutput{
+				Volume:   result.Volume.ID,
+				Snapshot: result.Snapshot.ID,
+				Date:     result.Snapshot.Date,
+				Archive:  archiveOutput(result.Archive),
+			})
+		}
+		return printJSON(out)
+	}
+
+	tab := gotable.NewTable([]string{"Snapshot", "Date", "Perms", "Size", "Path"},
+		[]int64{-8, -19, -10, 12, -48}, "No files found.")
+	for _, result := range results {
+		tab.AppendRow([]interface{}{
+			result.Snapshot.ID,
+			result.Snapshot.Date.Format(timeFormat),
+			result.Archive.Mode,
+			knoxite.SizeToString(result.Archive.Size),
+			result.Archive.Path})
+	}
+
+	_ = tab.Print()
+	return nil
+}
+
+// parseTimeFilter parses either a date or a duration, which gets subtracted
+// from the current time.
+func parseTimeFilter(s string) (time.Time, error) {
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t, nil
+	}
+
+	d, err := utils.DurationFromString(s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date or duration %s", s)
+	}
+	return time.Now().Add(-d), nil
+}
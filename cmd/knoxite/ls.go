@@ -56,6 +56,9 @@ func executeLs(snapshotID string) error {
 		if err != nil {
 			return err
 		}
+		if globalOpts.JSON {
+			return printJSON(archiveOutputs(snapshot.Archives))
+		}
 
 		for _, archive := range snapshot.Archives {
 			username := strconv.FormatInt(int64(archive.UID), 10)
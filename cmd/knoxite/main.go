@@ -37,12 +37,18 @@ import (
 
 // GlobalOptions holds all those options that can be set for every command.
 type GlobalOptions struct {
-	Repo      string
-	Alias     string
-	Password  string
-	ConfigURL string
-	Verbose   int
-	LogLevel  string
+	Repo         string
+	Alias        string
+	Password     string
+	Identity     string
+	ConfigURL    string
+	Verbose      int
+	LogLevel     string
+	CacheSize    string
+	CacheDir     string
+	CacheDirSize string
+	JSON         bool
+	Progress     string
 }
 
 var (
@@ -75,19 +81,30 @@ func main() {
 	RootCmd.PersistentFlags().StringVarP(&globalOpts.Repo, "repo", "r", "", "Repository directory to backup to/restore from (default: current working dir)")
 	RootCmd.PersistentFlags().StringVarP(&globalOpts.Alias, "alias", "R", "", "Repository alias to backup to/restore from")
 	RootCmd.PersistentFlags().StringVar(&globalOpts.Password, "password", "", "Password to use for data encryption")
+	RootCmd.PersistentFlags().StringVar(&globalOpts.Identity, "identity", "", "File containing the private key to decrypt write-only repositories with")
 	RootCmd.PersistentFlags().StringVarP(&globalOpts.ConfigURL, "configURL", "C", config.DefaultPath(), "Path to the configuration file")
 	RootCmd.PersistentFlags().StringVar(&globalOpts.LogLevel, "loglevel", "Print", "Verbose output. Possible levels are Debug, Info, Warning and Fatal")
+	RootCmd.PersistentFlags().StringVar(&globalOpts.CacheSize, "cache-size", "64MiB", "Memory budget for caching decoded chunks")
+	RootCmd.PersistentFlags().StringVar(&globalOpts.CacheDir, "cache-dir", "", "Directory to additionally cache decoded chunks in, encrypted with the repository's key")
+	RootCmd.PersistentFlags().StringVar(&globalOpts.CacheDirSize, "cache-dir-size", "1GiB", "Storage budget of the cache directory")
+	RootCmd.PersistentFlags().BoolVar(&globalOpts.JSON, "json", false, "Print machine-readable JSON output")
+	RootCmd.PersistentFlags().StringVar(&globalOpts.Progress, "progress", progressBar, "Progress output: bar, json (newline-delimited JSON events on stderr) or none")
 	RootCmd.PersistentFlags().CountVarP(&globalOpts.Verbose, "verbose", "v", "Verbose output on log level Info (-v) or Debug (-vv). Use --loglevel to choose between Debug, Info, Warning and Fatal")
 
 	globalOpts.Repo = os.Getenv("KNOXITE_REPOSITORY")
 	globalOpts.Password = os.Getenv("KNOXITE_PASSWORD")
+	globalOpts.Identity = os.Getenv("KNOXITE_IDENTITY")
+	globalOpts.CacheDir = os.Getenv("KNOXITE_CACHE_DIR")
 
 	// add the `completion` command via carapace
 	carapace.Gen(RootCmd).FlagCompletion(carapace.ActionMap{
 		"alias":     action.ActionAliases(RootCmd),
 		"repo":      action.ActionRepo(),
+		"identity":  carapace.ActionFiles(),
 		"configURL": carapace.ActionFiles(),
+		"cache-dir": carapace.ActionDirectories(),
 		"loglevel":  carapace.ActionValues("Debug", "Info", "Warning", "Fatal"),
+		"progress":  carapace.ActionValues(progressBar, progressJSON, progressNone),
 	})
 
 	carapace.Override(carapace.Opts{
@@ -95,7 +112,11 @@ func main() {
 	})
 
 	if err := RootCmd.Execute(); err != nil {
-		fmt.Println(err)
+		if globalOpts.JSON {
+			_ = printJSON(ErrorOutput{Error: err.Error()})
+		} else {
+			fmt.Println(err)
+		}
 		os.Exit(-1)
 	}
 }
@@ -103,6 +124,7 @@ func main() {
 func init() {
 	cobra.OnInitialize(initLogger)
 	cobra.OnInitialize(initConfig)
+	cobra.OnInitialize(initProgress)
 	if CommitSHA != "" {
 		vt := RootCmd.VersionTemplate()
 		RootCmd.SetVersionTemplate(vt[:len(vt)-1] + " (" + CommitSHA + ")\n")
@@ -124,8 +146,13 @@ func initLogger() {
 
 	logLevel, err := utils.LogLevelFromString(globalOpts.LogLevel)
 
+	// keep stdout clean for machine-readable output
+	w := os.Stdout
+	if globalOpts.JSON {
+		w = os.Stderr
+	}
 	log = *NewLogger(logLevel).
-		WithWriter(os.Stdout)
+		WithWriter(w)
 
 	if err != nil {
 		log.Warnf("Error setting log level \"%s\": %s. Using default log level Info instead.", globalOpts.LogLevel, err)
@@ -135,6 +162,15 @@ func initLogger() {
 	knoxite.SetLogger(log)
 }
 
+// initProgress validates the requested progress output.
+func initProgress() {
+	switch globalOpts.Progress {
+	case progressBar, progressJSON, progressNone:
+	default:
+		log.Fatalf("Unknown progress output '%s', use bar, json or none", globalOpts.Progress)
+	}
+}
+
 // initConfig initializes the configuration for knoxite.
 // It'll use the the default config url unless specified otherwise via the
 // ConfigURL flag.
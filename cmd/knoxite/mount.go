@@ -16,6 +16,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"syscall"
 
 	"bazil.org/fuse"
@@ -59,6 +60,12 @@ func executeMount(snapshotID, mountpoint string) error {
 	if err != nil {
 		return err
 	}
+	unlock, err := lockRepository(&repository, false)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	defer logCacheStats(repository)
 	_, snapshot, err := repository.FindSnapshot(snapshotID)
 	if err != nil {
 		return err
@@ -121,7 +128,10 @@ type Node struct {
 	Items      map[string]*Node
 	Archive    knoxite.Archive
 	Repository *knoxite.Repository
-	//	sync.RWMutex
+
+	reader  *knoxite.ArchiveReader
+	handles int // number of open handles sharing the reader
+	sync.Mutex
 }
 
 var (
@@ -226,6 +236,14 @@ func (node *Node) ReadDirAll(_ context.Context) ([]fuse.Dirent, error) {
 			ent.Type = fuse.DT_Dir
 		case knoxite.SymLink:
 			ent.Type = fuse.DT_Link
+		case knoxite.CharDevice:
+			ent.Type = fuse.DT_Char
+		case knoxite.BlockDevice:
+			ent.Type = fuse.DT_Block
+		case knoxite.FIFO:
+			ent.Type = fuse.DT_FIFO
+		case knoxite.Socket:
+			ent.Type = fuse.DT_Socket
 		}
 
 		entries = append(entries, ent)
@@ -240,24 +258,65 @@ func (node *Node) Open(_ context.Context, req *fuse.OpenRequest, resp *fuse.Open
 		return nil, fuse.Errno(syscall.EACCES)
 	}
 	resp.Flags |= fuse.OpenKeepCache
+
+	node.Lock()
+	node.handles++
+	node.Unlock()
 	return node, nil
 }
 
+// Release closes a file. The reader gets closed and dropped along with the
+// last handle, so closed files don't keep their chunks in memory.
+func (node *Node) Release(_ context.Context, _ *fuse.ReleaseRequest) error {
+	node.Lock()
+	defer node.Unlock()
+
+	if node.handles > 0 {
+		node.handles--
+	}
+	if node.handles > 0 || node.reader == nil {
+		return nil
+	}
+
+	err := node.reader.Close()
+	node.reader = nil
+	return err
+}
+
 // Read reads from a file.
 func (node *Node) Read(_ context.Context, req *fuse.ReadRequest, resp *fuse.ReadResponse) error {
-	d, err := knoxite.ReadArchive(*node.Repository, node.Archive, int(req.Offset), req.Size)
+	r, err := node.archiveReader()
 	if err != nil {
-		if err != io.EOF {
-			return err
-		}
-		resp.Data = nil
-	} else {
-		resp.Data = *d
+		return err
+	}
+
+	b := make([]byte, req.Size)
+	n, err := r.ReadAt(b, req.Offset)
+	if err != nil && err != io.EOF {
+		return err
 	}
+	resp.Data = b[:n]
 
 	return nil
 }
 
+// archiveReader returns the reader for this node's content. All reads of a
+// file share the same reader, so sequential reads benefit from its prefetching.
+func (node *Node) archiveReader() (*knoxite.ArchiveReader, error) {
+	node.Lock()
+	defer node.Unlock()
+
+	if node.reader == nil {
+		r, err := knoxite.NewArchiveReader(*node.Repository, node.Archive)
+		if err != nil {
+			return nil, err
+		}
+		node.reader = r
+	}
+
+	return node.reader, nil
+}
+
 // Readlink returns the target a symlink is pointing to.
 func (node *Node) Readlink(_ context.Context, _ *fuse.ReadlinkRequest) (string, error) {
 	return node.Archive.PointsTo, nil
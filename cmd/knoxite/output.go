@@ -0,0 +1,218 @@
+/*
+ * knoxite
+ *     Copyright (c) 2016-2021, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"os/user"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/knoxite/knoxite"
+)
+
+// SnapshotOutput describes a snapshot in JSON output.
+type SnapshotOutput struct {
+	ID          string        `json:"id"`
+	Date        time.Time     `json:"date"`
+	Description string        `json:"description"`
+	Tags        []string      `json:"tags"`
+	Hostname    string        `json:"hostname"`
+	Username    string        `json:"username"`
+	Paths       []string      `json:"paths"`
+	Version     string        `json:"version"`
+	Stats       knoxite.Stats `json:"stats"`
+}
+
+// VolumeOutput describes a volume in JSON output.
+type VolumeOutput struct {
+	ID          string   `json:"id"`
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Snapshots   []string `json:"snapshots"` // IDs of the volume's snapshots
+}
+
+// ArchiveOutput describes a file, directory, symlink or special file in JSON
+// output.
+type ArchiveOutput struct {
+	Path        string    `json:"path"`
+	Type        string    `json:"type"` // file, dir, symlink, chardev, blockdev, fifo or socket
+	Mode        string    `json:"mode"`
+	User        string    `json:"user"`
+	Group       string    `json:"group"`
+	UID         uint32    `json:"uid"`
+	GID         uint32    `json:"gid"`
+	Size        uint64    `json:"size"`
+	StorageSize uint64    `json:"storage_size"`
+	ModTime     time.Time `json:"modtime"`
+	PointsTo    string    `json:"points_to,omitempty"`
+}
+
+// ErrorOutput describes an error which occurred while processing a path.
+type ErrorOutput struct {
+	Path  string `json:"path,omitempty"`
+	Error string `json:"error"`
+}
+
+// StoreOutput is the JSON output of the store and clone commands.
+type StoreOutput struct {
+	Snapshot SnapshotOutput `json:"snapshot"`
+	Errors   []ErrorOutput  `json:"errors"`
+}
+
+// RestoreOutput is the JSON output of the restore command.
+type RestoreOutput struct {
+	Snapshot string        `json:"snapshot"`
+	Stats    knoxite.Stats `json:"stats"`
+	Errors   []ErrorOutput `json:"errors"`
+}
+
+// VerifyOutput is the JSON output of the verify command.
+type VerifyOutput struct {
+	Errors []ErrorOutput `json:"errors"`
+}
+
+// BackendOutput describes a storage backend in JSON output.
+type BackendOutput struct {
+	Location       string `json:"location"`
+	AvailableSpace uint64 `json:"available_space"`
+}
+
+// RepositoryOutput is the JSON output of the repo info command.
+type RepositoryOutput struct {
+	Version  uint                  `json:"version"`
+	Backends []BackendOutput       `json:"backends"`
+	Chunker  knoxite.ChunkerConfig `json:"chunker"`
+}
+
+// FindOutput describes a search result in JSON output.
+type FindOutput struct {
+	Volume   string        `json:"volume"`
+	Snapshot string        `json:"snapshot"`
+	Date     time.Time     `json:"date"`
+	Archive  ArchiveOutput `json:"archive"`
+}
+
+// ForgetOutput describes the retention decision for a snapshot in JSON
+// output.
+type ForgetOutput struct {
+	Snapshot SnapshotOutput `json:"snapshot"`
+	Keep     bool           `json:"keep"`
+	Reasons  []string       `json:"reasons"`
+}
+
+// printJSON writes v as indented JSON to stdout.
+func printJSON(v interface{}) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func snapshotOutput(snapshot *knoxite.Snapshot) SnapshotOutput {
+	return SnapshotOutput{
+		ID:          snapshot.ID,
+		Date:        snapshot.Date,
+		Description: snapshot.Description,
+		Tags:        nonNilStrings(snapshot.Tags),
+		Hostname:    snapshot.Hostname,
+		Username:    snapshot.Username,
+		Paths:       nonNilStrings(snapshot.Paths),
+		Version:     snapshot.Version,
+		Stats:       snapshot.Stats,
+	}
+}
+
+func volumeOutput(volume *knoxite.Volume) VolumeOutput {
+	return VolumeOutput{
+		ID:          volume.ID,
+		Name:        volume.Name,
+		Description: volume.Description,
+		Snapshots:   nonNilStrings(volume.Snapshots),
+	}
+}
+
+func archiveOutput(archive *knoxite.Archive) ArchiveOutput {
+	username := strconv.FormatInt(int64(archive.UID), 10)
+	if u, err := user.LookupId(username); err == nil {
+		username = u.Username
+	}
+	groupname := strconv.FormatInt(int64(archive.GID), 10)
+	if g, err := user.LookupGroupId(groupname); err == nil {
+		groupname = g.Name
+	}
+
+	return ArchiveOutput{
+		Path:        archive.Path,
+		Type:        archiveTypeText(archive.Type),
+		Mode:        archive.Mode.String(),
+		User:        username,
+		Group:       groupname,
+		UID:         archive.UID,
+		GID:         archive.GID,
+		Size:        archive.Size,
+		StorageSize: archive.StorageSize,
+		ModTime:     time.Unix(archive.ModTime, 0),
+		PointsTo:    archive.PointsTo,
+	}
+}
+
+// archiveOutputs returns the JSON representation of all archives, sorted by
+// path.
+func archiveOutputs(archives map[string]*knoxite.Archive) []ArchiveOutput {
+	out := []ArchiveOutput{}
+	for _, archive := range archives {
+		out = append(out, archiveOutput(archive))
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Path < out[j].Path
+	})
+	return out
+}
+
+// errorOutputs returns the JSON representation of per-path errors, sorted by
+// path.
+func errorOutputs(errs map[string]error) []ErrorOutput {
+	out := []ErrorOutput{}
+	for path, err := range errs {
+		out = append(out, ErrorOutput{Path: path, Error: err.Error()})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Path < out[j].Path
+	})
+	return out
+}
+
+// archiveTypeText returns a user-friendly string indicating the archive type.
+func archiveTypeText(t uint8) string {
+	switch t {
+	case knoxite.File:
+		return "file"
+	case knoxite.Directory:
+		return "dir"
+	case knoxite.SymLink:
+		return "symlink"
+	case knoxite.CharDevice:
+		return "chardev"
+	case knoxite.BlockDevice:
+		return "blockdev"
+	case knoxite.FIFO:
+		return "fifo"
+	case knoxite.Socket:
+		return "socket"
+	}
+	return "unknown"
+}
+
+func nonNilStrings(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
@@ -0,0 +1,195 @@
+/*
+ * knoxite
+ *     Copyright (c) 2016-2021, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/knoxite/knoxite"
+)
+
+// Progress modes.
+const (
+	progressBar  = "bar"
+	progressJSON = "json"
+	progressNone = "none"
+)
+
+// ProgressEvent is a single line of newline-delimited JSON progress output.
+type ProgressEvent struct {
+	// Event is one of start, progress, end, error or done
+	Event string    `json:"event"`
+	Time  time.Time `json:"time"`
+	Path  string    `json:"path,omitempty"`
+	Error string    `json:"error,omitempty"`
+
+	Item  *ItemProgress  `json:"item,omitempty"`
+	Total ProgressTotals `json:"total"`
+}
+
+// ItemProgress describes the progress of the current item.
+type ItemProgress struct {
+	Size      uint64 `json:"size"`
+	Processed uint64 `json:"processed"`
+}
+
+// ProgressTotals describes the progress of the whole operation.
+type ProgressTotals struct {
+	Items          uint64 `json:"items"` // finished items
+	Errors         uint64 `json:"errors"`
+	Size           uint64 `json:"size"` // zero if unknown
+	Processed      uint64 `json:"processed"`
+	BytesPerSecond uint64 `json:"bytes_per_second"`
+	ETA            int64  `json:"eta_seconds,omitempty"` // zero if unknown
+}
+
+// jsonProgress writes newline-delimited JSON progress events to stderr.
+// Progress events get emitted at most once per second, all others right
+// away.
+type jsonProgress struct {
+	tracker *knoxite.ProgressTracker
+	enc     *json.Encoder
+	start   time.Time
+	last    time.Time
+
+	// size of all items, taken from the updates' total statistics if
+	// sizeFromTotals is true
+	size           uint64
+	sizeFromTotals bool
+	// processed returns how much of an item has been handled
+	processed func(stats knoxite.Stats) uint64
+
+	done    uint64 // processed bytes of all finished items
+	current uint64 // processed bytes of the current item
+	items   uint64
+	errors  uint64
+}
+
+// newJSONProgress returns a progress reporter if JSON progress output has
+// been requested, otherwise nil.
+func newJSONProgress(size uint64, sizeFromTotals bool, processed func(stats knoxite.Stats) uint64) *jsonProgress {
+	if globalOpts.Progress != progressJSON {
+		return nil
+	}
+
+	jp := &jsonProgress{
+		enc:            json.NewEncoder(os.Stderr),
+		start:          time.Now(),
+		size:           size,
+		sizeFromTotals: sizeFromTotals,
+		processed:      processed,
+	}
+	jp.tracker = knoxite.NewProgressTracker(jp)
+	return jp
+}
+
+// showProgressBars returns true if progress bars should be printed.
+func showProgressBars() bool {
+	return !globalOpts.JSON && globalOpts.Progress == progressBar
+}
+
+// transferredSize returns how much of an item has been transferred.
+func transferredSize(stats knoxite.Stats) uint64 {
+	return stats.Transferred
+}
+
+// Update processes a single progress update.
+func (jp *jsonProgress) Update(p knoxite.Progress) {
+	jp.tracker.Update(p)
+}
+
+// Close finishes the current item and emits the done event.
+func (jp *jsonProgress) Close() {
+	jp.tracker.Close()
+	jp.emit(ProgressEvent{Event: "done"})
+}
+
+// ItemStarted is part of the knoxite.ProgressReporter interface.
+func (jp *jsonProgress) ItemStarted(p knoxite.Progress) {
+	jp.updateSize(p)
+	jp.current = 0
+	jp.emit(ProgressEvent{
+		Event: "start",
+		Path:  p.Path,
+		Item:  &ItemProgress{Size: p.CurrentItemStats.Size},
+	})
+}
+
+// ItemProgress is part of the knoxite.ProgressReporter interface.
+func (jp *jsonProgress) ItemProgress(p knoxite.Progress) {
+	jp.updateSize(p)
+	jp.current = jp.processed(p.CurrentItemStats)
+	if time.Since(jp.last) < time.Second {
+		return
+	}
+
+	jp.emit(ProgressEvent{
+		Event: "progress",
+		Path:  p.Path,
+		Item: &ItemProgress{
+			Size:      p.CurrentItemStats.Size,
+			Processed: jp.current,
+		},
+	})
+}
+
+// ItemFinished is part of the knoxite.ProgressReporter interface.
+func (jp *jsonProgress) ItemFinished(p knoxite.Progress) {
+	jp.done += jp.processed(p.CurrentItemStats)
+	jp.current = 0
+	jp.items++
+	jp.emit(ProgressEvent{
+		Event: "end",
+		Path:  p.Path,
+		Item: &ItemProgress{
+			Size:      p.CurrentItemStats.Size,
+			Processed: jp.processed(p.CurrentItemStats),
+		},
+	})
+}
+
+// Error is part of the knoxite.ProgressReporter interface.
+func (jp *jsonProgress) Error(p knoxite.Progress) {
+	jp.errors++
+	jp.emit(ProgressEvent{
+		Event: "error",
+		Path:  p.Path,
+		Error: p.Error.Error(),
+	})
+}
+
+// updateSize takes the size of all items from the update, if requested.
+func (jp *jsonProgress) updateSize(p knoxite.Progress) {
+	if jp.sizeFromTotals && p.TotalStatistics.Size > jp.size {
+		jp.size = p.TotalStatistics.Size
+	}
+}
+
+func (jp *jsonProgress) emit(e ProgressEvent) {
+	now := time.Now()
+	jp.last = now
+
+	e.Time = now
+	e.Total = ProgressTotals{
+		Items:     jp.items,
+		Errors:    jp.errors,
+		Size:      jp.size,
+		Processed: jp.done + jp.current,
+	}
+	if elapsed := now.Sub(jp.start).Seconds(); elapsed > 0 {
+		e.Total.BytesPerSecond = uint64(float64(e.Total.Processed) / elapsed)
+	}
+	if e.Total.BytesPerSecond > 0 && e.Total.Size > e.Total.Processed {
+		e.Total.ETA = int64((e.Total.Size - e.Total.Processed) / e.Total.BytesPerSecond)
+	}
+
+	// progress output is best effort, there's nothing to do about errors
+	_ = jp.enc.Encode(e)
+}
@@ -11,7 +11,11 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
 
+	humanize "github.com/dustin/go-humanize"
 	shutdown "github.com/klauspost/shutdown2"
 	"github.com/muesli/gotable"
 	"github.com/rsteube/carapace"
@@ -22,7 +26,29 @@ import (
 	"github.com/knoxite/knoxite/cmd/knoxite/utils"
 )
 
+// RepoInitOptions holds all the options that can be set for the 'repo init' command.
+type RepoInitOptions struct {
+	PublicKey    string
+	MinChunkSize string
+	AvgChunkSize string
+	MaxChunkSize string
+}
+
+// RepoKeyAddOptions holds all the options that can be set for the 'repo key add' command.
+type RepoKeyAddOptions struct {
+	Label string
+}
+
+// RepoUnlockOptions holds all the options that can be set for the 'repo unlock' command.
+type RepoUnlockOptions struct {
+	All bool
+}
+
 var (
+	repoInitOpts   = RepoInitOptions{}
+	repoKeyAddOpts = RepoKeyAddOptions{}
+	repoUnlockOpts = RepoUnlockOptions{}
+
 	repoCmd = &cobra.Command{
 		Use:   "repo",
 		Short: "manage repository",
@@ -34,7 +60,20 @@ var (
 		Short: "initialize a new repository",
 		Long:  `The init command initializes a new repository`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return executeRepoInit()
+			return executeRepoInit(repoInitOpts)
+		},
+	}
+	repoKeygenCmd = &cobra.Command{
+		Use:   "keygen [identity-file]",
+		Short: "generate a key pair for write-only repositories",
+		Long: "The keygen command generates a key pair for write-only repositories.\n" +
+			"The private key gets written to the identity file, the public key can be\n" +
+			"passed to 'repo init --public-key'",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return fmt.Errorf("keygen needs a file to write the private key to")
+			}
+			return executeRepoKeygen(args[0])
 		},
 	}
 	repoChangePasswordCmd = &cobra.Command{
@@ -45,6 +84,40 @@ var (
 			return executeRepoChangePassword()
 		},
 	}
+	repoKeyCmd = &cobra.Command{
+		Use:   "key",
+		Short: "manage key slots",
+		Long:  `The key command manages the key slots, which each allow opening a repository with their own password`,
+		RunE:  nil,
+	}
+	repoKeyAddCmd = &cobra.Command{
+		Use:   "add",
+		Short: "add a key slot with a new password",
+		Long:  `The add command adds a key slot, which allows opening the repository with another password`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return executeRepoKeyAdd(repoKeyAddOpts)
+		},
+	}
+	repoKeyListCmd = &cobra.Command{
+		Use:   "list",
+		Short: "list all key slots of a repository",
+		Long:  `The list command lists all key slots of a repository`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return executeRepoKeyList()
+		},
+	}
+	repoKeyRemoveCmd = &cobra.Command{
+		Use:   "remove [id]",
+		Short: "remove a key slot",
+		Long: "The remove command removes a key slot, so its password can no longer open the repository.\n" +
+			"The key slot matching the password in use can't be removed",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return fmt.Errorf("remove needs a key slot ID to work on")
+			}
+			return executeRepoKeyRemove(args[0])
+		},
+	}
 	repoCatCmd = &cobra.Command{
 		Use:   "cat",
 		Short: "display repository information as JSON",
@@ -80,6 +153,15 @@ var (
 			return executeRepoPack()
 		},
 	}
+	repoUnlockCmd = &cobra.Command{
+		Use:   "unlock",
+		Short: "remove stale locks from a repository",
+		Long: "The unlock command removes locks left behind by knoxite processes,\n" +
+			"which crashed or got killed while using the repository",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return executeRepoUnlock(repoUnlockOpts)
+		},
+	}
 	setURLCmd = &cobra.Command{
 		Use:   "set-url <new-url>",
 		Short: "set a new URL for the repository",
@@ -93,21 +175,39 @@ var (
 )
 
 func init() {
+	repoInitCmd.Flags().StringVar(&repoInitOpts.PublicKey, "public-key", "", "create a write-only repository, whose snapshots, chunk-index and data can only be read with the matching private key")
+	repoInitCmd.Flags().StringVar(&repoInitOpts.MinChunkSize, "min-chunk-size", "", "minimum size of chunks (default 512KiB)")
+	repoInitCmd.Flags().StringVar(&repoInitOpts.AvgChunkSize, "avg-chunk-size", "", "average size of chunks, must be a power of two (default 1MiB)")
+	repoInitCmd.Flags().StringVar(&repoInitOpts.MaxChunkSize, "max-chunk-size", "", "maximum size of chunks (default 8MiB)")
+	repoKeyAddCmd.Flags().StringVarP(&repoKeyAddOpts.Label, "label", "l", "", "a label for this key slot, e.g. the name of its owner")
+	repoUnlockCmd.Flags().BoolVar(&repoUnlockOpts.All, "all", false, "remove all locks, even those of processes which still seem to be running")
+
+	repoKeyCmd.AddCommand(repoKeyAddCmd)
+	repoKeyCmd.AddCommand(repoKeyListCmd)
+	repoKeyCmd.AddCommand(repoKeyRemoveCmd)
+
 	repoCmd.AddCommand(repoInitCmd)
+	repoCmd.AddCommand(repoKeygenCmd)
 	repoCmd.AddCommand(repoChangePasswordCmd)
+	repoCmd.AddCommand(repoKeyCmd)
 	repoCmd.AddCommand(repoCatCmd)
 	repoCmd.AddCommand(repoInfoCmd)
 	repoCmd.AddCommand(repoAddCmd)
 	repoCmd.AddCommand(repoPackCmd)
+	repoCmd.AddCommand(repoUnlockCmd)
 	repoCmd.AddCommand(setURLCmd)
 	RootCmd.AddCommand(repoCmd)
 
 	carapace.Gen(repoAddCmd).PositionalCompletion(
 		action.ActionRepo(),
 	)
+
+	carapace.Gen(repoKeyRemoveCmd).PositionalCompletion(
+		action.ActionKeySlots(repoKeyRemoveCmd),
+	)
 }
 
-func executeRepoInit() error {
+func executeRepoInit(opts RepoInitOptions) error {
 	// acquire a shutdown lock. we don't want these next calls to be interrupted
 	lock := shutdown.Lock()
 	if lock == nil {
@@ -120,16 +220,96 @@ func executeRepoInit() error {
 		return fmt.Errorf("creating repository at %s failed: %v", globalOpts.Repo, err)
 	}
 
+	save := false
+	if opts.PublicKey != "" {
+		err = r.SetPublicKey(opts.PublicKey)
+		if err != nil {
+			return err
+		}
+		save = true
+	}
+	if opts.MinChunkSize != "" || opts.AvgChunkSize != "" || opts.MaxChunkSize != "" {
+		min, err := parseChunkSize(opts.MinChunkSize, r.Chunker.MinSize)
+		if err != nil {
+			return err
+		}
+		avg, err := parseChunkSize(opts.AvgChunkSize, r.Chunker.AvgSize)
+		if err != nil {
+			return err
+		}
+		max, err := parseChunkSize(opts.MaxChunkSize, r.Chunker.MaxSize)
+		if err != nil {
+			return err
+		}
+
+		err = r.SetChunkSizes(min, avg, max)
+		if err != nil {
+			return err
+		}
+		save = true
+	}
+	if save {
+		err = r.Save()
+		if err != nil {
+			return err
+		}
+	}
+
 	fmt.Printf("Created new repository at %s\n", (*r.BackendManager().Backends[0]).Location())
 	return nil
 }
 
+// parseChunkSize parses a human-readable size, falling back to def if s is
+// empty.
+func parseChunkSize(s string, def uint) (uint, error) {
+	if s == "" {
+		return def, nil
+	}
+
+	size, err := humanize.ParseBytes(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid chunk size %s: %v", s, err)
+	}
+	return uint(size), nil
+}
+
+func executeRepoKeygen(identity string) error {
+	pub, priv, err := knoxite.GenerateX25519KeyPair()
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(identity, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(f, priv)
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	err = f.Close()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Wrote private key to %s\n", identity)
+	fmt.Printf("Public key: %s\n", pub)
+	return nil
+}
+
 func executeRepoChangePassword() error {
 	r, err := openRepository(globalOpts.Repo, globalOpts.Password)
 	if err != nil {
 		return err
 	}
 
+	unlock, err := lockRepository(&r, true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
 	password, err := utils.ReadPasswordTwice("Enter new password:", "Confirm password:")
 	if err != nil {
 		return err
@@ -144,6 +324,101 @@ func executeRepoChangePassword() error {
 	return nil
 }
 
+func executeRepoKeyAdd(opts RepoKeyAddOptions) error {
+	// acquire a shutdown lock. we don't want these next calls to be interrupted
+	lock := shutdown.Lock()
+	if lock == nil {
+		return nil
+	}
+	defer lock()
+
+	r, err := openRepository(globalOpts.Repo, globalOpts.Password)
+	if err != nil {
+		return err
+	}
+
+	unlock, err := lockRepository(&r, true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	password, err := utils.ReadPasswordTwice("Enter password for the new key slot:", "Confirm password:")
+	if err != nil {
+		return err
+	}
+
+	slot, err := r.AddKeySlot(opts.Label, password)
+	if err != nil {
+		return err
+	}
+
+	err = r.Save()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Added key slot %s\n", slot.ID)
+	return nil
+}
+
+func executeRepoKeyList() error {
+	r, err := openRepository(globalOpts.Repo, globalOpts.Password)
+	if err != nil {
+		return err
+	}
+
+	tab := gotable.NewTable([]string{"ID", "Label", "Created", "Current"},
+		[]int64{-8, -32, -19, -7},
+		"No key slots found.")
+
+	for _, slot := range r.KeySlots() {
+		current := ""
+		if slot.ID == r.CurrentKeySlot() {
+			current = "*"
+		}
+		tab.AppendRow([]interface{}{
+			slot.ID,
+			slot.Label,
+			slot.Created.Format(timeFormat),
+			current})
+	}
+
+	_ = tab.Print()
+	return nil
+}
+
+func executeRepoKeyRemove(id string) error {
+	// acquire a shutdown lock. we don't want these next calls to be interrupted
+	lock := shutdown.Lock()
+	if lock == nil {
+		return nil
+	}
+	defer lock()
+
+	r, err := openRepository(globalOpts.Repo, globalOpts.Password)
+	if err != nil {
+		return err
+	}
+
+	unlock, err := lockRepository(&r, true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	err = r.RemoveKeySlot(id)
+	if err != nil {
+		return err
+	}
+
+	err = r.Save()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Removed key slot %s\n", id)
+	return nil
+}
+
 func executeRepoAdd(url string) error {
 	// acquire a shutdown lock. we don't want these next calls to be interrupted
 	lock := shutdown.Lock()
@@ -157,6 +432,12 @@ func executeRepoAdd(url string) error {
 		return err
 	}
 
+	unlock, err := lockRepository(&r, true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
 	backend, err := knoxite.BackendFromURL(url)
 	if err != nil {
 		return err
@@ -196,12 +477,18 @@ func executeRepoPack() error {
 	if err != nil {
 		return err
 	}
+
+	unlock, err := lockRepository(&r, true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
 	index, err := knoxite.OpenChunkIndex(&r)
 	if err != nil {
 		return err
 	}
 
-	freedSize, err := index.Pack(&r)
+	freedSize, err := packRepository(&index, &r)
 	if err != nil {
 		return err
 	}
@@ -215,11 +502,44 @@ func executeRepoPack() error {
 	return nil
 }
 
+func executeRepoUnlock(opts RepoUnlockOptions) error {
+	r, err := openRepository(globalOpts.Repo, globalOpts.Password)
+	if err != nil {
+		return err
+	}
+
+	locks, err := r.RemoveLocks(opts.All)
+	if err != nil {
+		return err
+	}
+
+	for _, l := range locks {
+		fmt.Printf("Removed %s\n", l)
+	}
+	fmt.Printf("Removed %d lock(s)\n", len(locks))
+	return nil
+}
+
 func executeRepoInfo() error {
 	r, err := openRepository(globalOpts.Repo, globalOpts.Password)
 	if err != nil {
 		return err
 	}
+	if globalOpts.JSON {
+		out := RepositoryOutput{
+			Version:  r.Version,
+			Backends: []BackendOutput{},
+			Chunker:  r.Chunker,
+		}
+		for _, be := range r.BackendManager().Backends {
+			space, _ := (*be).AvailableSpace()
+			out.Backends = append(out.Backends, BackendOutput{
+				Location:       (*be).Location(),
+				AvailableSpace: space,
+			})
+		}
+		return printJSON(out)
+	}
 
 	tab := gotable.NewTable([]string{"Storage URL", "Available Space"},
 		[]int64{-48, 15},
@@ -233,6 +553,10 @@ func executeRepoInfo() error {
 	}
 
 	_ = tab.Print()
+	fmt.Printf("\nChunk sizes: %s min, %s avg, %s max\n",
+		knoxite.SizeToString(uint64(r.Chunker.MinSize)),
+		knoxite.SizeToString(uint64(r.Chunker.AvgSize)),
+		knoxite.SizeToString(uint64(r.Chunker.MaxSize)))
 	return nil
 }
 
@@ -242,6 +566,12 @@ func executeRepoChangeLocation(newLocation string) error {
 		return err
 	}
 
+	unlock, err := lockRepository(&r, true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
 	err = r.ChangeLocation(globalOpts.Repo, newLocation)
 	if err != nil {
 		return err
@@ -260,7 +590,74 @@ func openRepository(path, password string) (knoxite.Repository, error) {
 		}
 	}
 
-	return knoxite.OpenRepository(path, password)
+	r, err := knoxite.OpenRepository(path, password)
+	if err != nil {
+		return r, err
+	}
+
+	if globalOpts.Identity != "" {
+		b, err := ioutil.ReadFile(globalOpts.Identity)
+		if err != nil {
+			return r, err
+		}
+		err = r.SetPrivateKey(strings.TrimSpace(string(b)))
+		if err != nil {
+			return r, err
+		}
+	}
+
+	cacheSize, err := humanize.ParseBytes(globalOpts.CacheSize)
+	if err != nil {
+		return r, fmt.Errorf("invalid cache size %s: %v", globalOpts.CacheSize, err)
+	}
+	cacheDirSize, err := humanize.ParseBytes(globalOpts.CacheDirSize)
+	if err != nil {
+		return r, fmt.Errorf("invalid cache dir size %s: %v", globalOpts.CacheDirSize, err)
+	}
+	cache, err := knoxite.NewCache(cacheSize, globalOpts.CacheDir, cacheDirSize, r.Key)
+	if err != nil {
+		return r, err
+	}
+	r.SetCache(cache)
+
+	return r, nil
+}
+
+// packRepository packs a repository and reports the progress, if requested.
+func packRepository(index *knoxite.ChunkIndex, r *knoxite.Repository) (uint64, error) {
+	jp := newJSONProgress(0, true, transferredSize)
+	if jp == nil {
+		return index.Pack(r)
+	}
+	defer jp.Close()
+
+	return index.PackWithProgress(r, jp)
+}
+
+// logCacheStats logs how efficiently the repository's chunk cache was used.
+func logCacheStats(r knoxite.Repository) {
+	if r.Cache() == nil {
+		return
+	}
+
+	stats := r.Cache().Stats()
+	log.Infof("Chunk cache: %d memory hits, %d disk hits, %d misses, %d evictions, %s in memory",
+		stats.MemoryHits, stats.DiskHits, stats.Misses, stats.Evictions, knoxite.SizeToString(stats.Size))
+}
+
+// lockRepository acquires a lock on a repository. The returned func releases
+// the lock again.
+func lockRepository(r *knoxite.Repository, exclusive bool) (func(), error) {
+	l, err := r.Lock(exclusive)
+	if err != nil {
+		return nil, err
+	}
+
+	return func() {
+		if err := l.Unlock(); err != nil {
+			log.Warnf("Failed to release %s: %v", l, err)
+		}
+	}, nil
 }
 
 func newRepository(path, password string) (knoxite.Repository, error) {
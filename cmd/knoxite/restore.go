@@ -27,8 +27,11 @@ var (
 )
 
 type RestoreOptions struct {
-	Excludes []string
-	Pedantic bool
+	Excludes     []string
+	Pedantic     bool
+	NoXAttrs     bool
+	NoOwner      bool
+	NumericOwner bool
 }
 
 var (
@@ -70,6 +73,9 @@ func configureRestoreOpts(cmd *cobra.Command, opts *RestoreOptions) {
 func initRestoreFlags(f func() *pflag.FlagSet) {
 	f().StringArrayVarP(&restoreOpts.Excludes, "excludes", "x", []string{}, "list of excludes")
 	f().BoolVar(&restoreOpts.Pedantic, "pedantic", false, "exit on first error")
+	f().BoolVar(&restoreOpts.NoXAttrs, "no-xattrs", false, "don't restore extended attributes, ACLs & file capabilities")
+	f().BoolVar(&restoreOpts.NoOwner, "no-owner", false, "don't restore ownerships")
+	f().BoolVar(&restoreOpts.NumericOwner, "numeric-owner", false, "restore the stored user & group ids instead of looking up their names")
 }
 
 func init() {
@@ -87,13 +93,25 @@ func executeRestore(snapshotID, target string, opts RestoreOptions) error {
 	if err != nil {
 		return err
 	}
+	unlock, err := lockRepository(&repository, false)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	defer logCacheStats(repository)
 
 	_, snapshot, err := repository.FindSnapshot(snapshotID)
 	if err != nil {
 		return err
 	}
 
-	progress, err := knoxite.DecodeSnapshot(repository, snapshot, target, opts.Excludes, opts.Pedantic)
+	progress, err := knoxite.DecodeSnapshotWithOptions(repository, snapshot, target, knoxite.RestoreOptions{
+		Excludes:     opts.Excludes,
+		Pedantic:     opts.Pedantic,
+		NoXAttrs:     opts.NoXAttrs,
+		NoOwner:      opts.NoOwner,
+		NumericOwner: opts.NumericOwner,
+	})
 	if err != nil {
 		return err
 	}
@@ -102,16 +120,34 @@ func executeRestore(snapshotID, target string, opts RestoreOptions) error {
 	stats := knoxite.Stats{}
 	lastPath := ""
 
+	jp := newJSONProgress(snapshot.Stats.Size, false, transferredSize)
+	if jp != nil {
+		defer jp.Close()
+	}
+
 	errs := make(map[string]error)
 	for p := range progress {
+		if jp != nil {
+			jp.Update(p)
+		}
+
 		if p.Error != nil {
 			if restoreOpts.Pedantic {
-				fmt.Println()
+				if showProgressBars() {
+					fmt.Println()
+				}
 				return p.Error
 			}
 			errs[p.Path] = p.Error
 			stats.Errors++
 		}
+		if p.CurrentItemStats.Size == p.CurrentItemStats.Transferred {
+			// We have just finished restoring an item
+			stats.Add(p.TotalStatistics)
+		}
+		if !showProgressBars() {
+			continue
+		}
 
 		pb.Total = int64(p.CurrentItemStats.Size)
 		pb.Current = int64(p.CurrentItemStats.Transferred)
@@ -128,14 +164,20 @@ func executeRestore(snapshotID, target string, opts RestoreOptions) error {
 			lastPath = p.Path
 			pb.Text = p.Path
 		}
-		if p.CurrentItemStats.Size == p.CurrentItemStats.Transferred {
-			// We have just finished restoring an item
-			stats.Add(p.TotalStatistics)
-		}
 
 		pb.LazyPrint()
 	}
-	fmt.Println()
+	if globalOpts.JSON {
+		return printJSON(RestoreOutput{
+			Snapshot: snapshot.ID,
+			Stats:    stats,
+			Errors:   errorOutputs(errs),
+		})
+	}
+
+	if showProgressBars() {
+		fmt.Println()
+	}
 	fmt.Println("Restore done:", stats.String())
 	for file, err := range errs {
 		fmt.Printf("'%s' failed to restore: %v\n", file, err)
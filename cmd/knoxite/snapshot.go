@@ -9,6 +9,8 @@ package main
 
 import (
 	"fmt"
+	"path/filepath"
+	"strings"
 
 	"github.com/muesli/gotable"
 	"github.com/rsteube/carapace"
@@ -16,9 +18,35 @@ import (
 
 	"github.com/knoxite/knoxite"
 	"github.com/knoxite/knoxite/cmd/knoxite/action"
+	"github.com/knoxite/knoxite/cmd/knoxite/utils"
 )
 
+// SnapshotForgetOptions holds all the options that can be set for the 'snapshot forget' command.
+type SnapshotForgetOptions struct {
+	KeepLast    int
+	KeepHourly  int
+	KeepDaily   int
+	KeepWeekly  int
+	KeepMonthly int
+	KeepYearly  int
+	KeepWithin  string
+	KeepTags    []string
+	DryRun      bool
+	Pack        bool
+}
+
+// SnapshotListOptions holds all the options that can be set for the 'snapshot list' command.
+type SnapshotListOptions struct {
+	Hostname string
+	Username string
+	Path     string
+	Tags     []string
+}
+
 var (
+	snapshotListOpts   = SnapshotListOptions{}
+	snapshotForgetOpts = SnapshotForgetOptions{}
+
 	snapshotCmd = &cobra.Command{
 		Use:   "snapshot",
 		Short: "manage snapshots",
@@ -33,7 +61,7 @@ var (
 			if len(args) != 1 {
 				return fmt.Errorf("list needs a volume ID to work on")
 			}
-			return executeSnapshotList(args[0])
+			return executeSnapshotList(args[0], snapshotListOpts)
 		},
 	}
 	snapshotRemoveCmd = &cobra.Command{
@@ -47,11 +75,86 @@ var (
 			return executeSnapshotRemove(args[0])
 		},
 	}
+	snapshotForgetCmd = &cobra.Command{
+		Use:   "forget [volume]",
+		Short: "remove snapshots according to a retention policy",
+		Long: `The forget command removes all snapshots from a volume, which aren't kept
+by any of the given rules`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return fmt.Errorf("forget needs a volume ID to work on")
+			}
+			return executeSnapshotForget(args[0], snapshotForgetOpts)
+		},
+	}
+	snapshotDiffCmd = &cobra.Command{
+		Use:   "diff [snapshot] [snapshot] [path]",
+		Short: "show changes between two snapshots",
+		Long:  `The diff command lists all files which have been added, removed or modified between two snapshots`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) < 2 || len(args) > 3 {
+				return fmt.Errorf("diff needs two snapshot IDs and optionally a path")
+			}
+			path := ""
+			if len(args) == 3 {
+				path = args[2]
+			}
+			return executeSnapshotDiff(args[0], args[1], path)
+		},
+	}
+	snapshotTagCmd = &cobra.Command{
+		Use:   "tag",
+		Short: "manage snapshot tags",
+		Long:  `The tag command manages the tags of a snapshot`,
+		RunE:  nil,
+	}
+	snapshotTagAddCmd = &cobra.Command{
+		Use:   "add [snapshot] [tag] [...]",
+		Short: "add tags to a snapshot",
+		Long:  `The add command adds one or more tags to a snapshot`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) < 2 {
+				return fmt.Errorf("add needs a snapshot ID and at least one tag")
+			}
+			return executeSnapshotTag(args[0], args[1:], nil)
+		},
+	}
+	snapshotTagRemoveCmd = &cobra.Command{
+		Use:   "remove [snapshot] [tag] [...]",
+		Short: "remove tags from a snapshot",
+		Long:  `The remove command removes one or more tags from a snapshot`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) < 2 {
+				return fmt.Errorf("remove needs a snapshot ID and at least one tag")
+			}
+			return executeSnapshotTag(args[0], nil, args[1:])
+		},
+	}
 )
 
 func init() {
+	snapshotListCmd.Flags().StringVar(&snapshotListOpts.Hostname, "host", "", "only list snapshots created on this host")
+	snapshotListCmd.Flags().StringVar(&snapshotListOpts.Username, "user", "", "only list snapshots created by this user")
+	snapshotListCmd.Flags().StringVar(&snapshotListOpts.Path, "path", "", "only list snapshots containing this source path")
+	snapshotListCmd.Flags().StringSliceVar(&snapshotListOpts.Tags, "tag", []string{}, "only list snapshots with this tag, can be given multiple times")
 	snapshotCmd.AddCommand(snapshotListCmd)
+	snapshotForgetCmd.Flags().IntVar(&snapshotForgetOpts.KeepLast, "keep-last", 0, "keep the n most recent snapshots")
+	snapshotForgetCmd.Flags().IntVar(&snapshotForgetOpts.KeepHourly, "keep-hourly", 0, "keep the most recent snapshot of each of the last n hours")
+	snapshotForgetCmd.Flags().IntVar(&snapshotForgetOpts.KeepDaily, "keep-daily", 0, "keep the most recent snapshot of each of the last n days")
+	snapshotForgetCmd.Flags().IntVar(&snapshotForgetOpts.KeepWeekly, "keep-weekly", 0, "keep the most recent snapshot of each of the last n weeks")
+	snapshotForgetCmd.Flags().IntVar(&snapshotForgetOpts.KeepMonthly, "keep-monthly", 0, "keep the most recent snapshot of each of the last n months")
+	snapshotForgetCmd.Flags().IntVar(&snapshotForgetOpts.KeepYearly, "keep-yearly", 0, "keep the most recent snapshot of each of the last n years")
+	snapshotForgetCmd.Flags().StringVar(&snapshotForgetOpts.KeepWithin, "keep-within", "", "keep all snapshots taken within this duration before the most recent snapshot, e.g. 1y6m, 2w or 36h")
+	snapshotForgetCmd.Flags().StringSliceVar(&snapshotForgetOpts.KeepTags, "keep-tag", []string{}, "keep all snapshots with this tag")
+	snapshotForgetCmd.Flags().BoolVarP(&snapshotForgetOpts.DryRun, "dry-run", "n", false, "only show which snapshots would be removed")
+	snapshotForgetCmd.Flags().BoolVar(&snapshotForgetOpts.Pack, "pack", false, "pack the repository afterwards to free up storage space")
+
 	snapshotCmd.AddCommand(snapshotRemoveCmd)
+	snapshotCmd.AddCommand(snapshotForgetCmd)
+	snapshotCmd.AddCommand(snapshotDiffCmd)
+	snapshotTagCmd.AddCommand(snapshotTagAddCmd)
+	snapshotTagCmd.AddCommand(snapshotTagRemoveCmd)
+	snapshotCmd.AddCommand(snapshotTagCmd)
 	RootCmd.AddCommand(snapshotCmd)
 
 	carapace.Gen(snapshotListCmd).PositionalCompletion(
@@ -61,6 +164,202 @@ func init() {
 	carapace.Gen(snapshotRemoveCmd).PositionalCompletion(
 		action.ActionSnapshots(snapshotRemoveCmd, ""),
 	)
+
+	carapace.Gen(snapshotForgetCmd).PositionalCompletion(
+		action.ActionVolumes(snapshotForgetCmd),
+	)
+
+	carapace.Gen(snapshotTagAddCmd).PositionalCompletion(
+		action.ActionSnapshots(snapshotTagAddCmd, ""),
+	)
+
+	carapace.Gen(snapshotTagRemoveCmd).PositionalCompletion(
+		action.ActionSnapshots(snapshotTagRemoveCmd, ""),
+	)
+
+	carapace.Gen(snapshotDiffCmd).PositionalCompletion(
+		action.ActionSnapshots(snapshotDiffCmd, ""),
+		action.ActionSnapshots(snapshotDiffCmd, ""),
+		carapace.ActionCallback(func(c carapace.Context) carapace.Action {
+			return action.ActionSnapshotPaths(snapshotDiffCmd, c.Args[1]).Invoke(c).ToMultiPartsA("/")
+		}),
+	)
+}
+
+func executeSnapshotDiff(snapshotA, snapshotB, path string) error {
+	repository, err := openRepository(globalOpts.Repo, globalOpts.Password)
+	if err != nil {
+		return err
+	}
+
+	_, a, err := repository.FindSnapshot(snapshotA)
+	if err != nil {
+		return err
+	}
+	_, b, err := repository.FindSnapshot(snapshotB)
+	if err != nil {
+		return err
+	}
+
+	diff := knoxite.DiffSnapshots(a, b, path)
+	if globalOpts.JSON {
+		return printJSON(diff)
+	}
+
+	tab := gotable.NewTable([]string{"Change", "Size Delta", "Path"},
+		[]int64{-24, 12, -48}, "No changes found.")
+	for _, change := range diff.Changes {
+		tab.AppendRow([]interface{}{
+			diffChangeText(change),
+			sizeDeltaToString(change.SizeDelta),
+			change.Path})
+	}
+	_ = tab.Print()
+
+	fmt.Printf("\n%d added (%s), %d removed (%s), %d modified, %d mode changes, %d ownership changes, %s total\n",
+		diff.Added, knoxite.SizeToString(diff.AddedSize),
+		diff.Removed, knoxite.SizeToString(diff.RemovedSize),
+		diff.Modified, diff.ModeChanged, diff.OwnerChanged,
+		sizeDeltaToString(diff.SizeDelta))
+	return nil
+}
+
+// diffChangeText returns a user-friendly description of a change.
+func diffChangeText(d knoxite.ArchiveDiff) string {
+	switch {
+	case d.Added:
+		return "added"
+	case d.Removed:
+		return "removed"
+	}
+
+	changes := []string{}
+	if d.Modified {
+		changes = append(changes, "modified")
+	}
+	if d.ModeChanged {
+		changes = append(changes, "mode")
+	}
+	if d.OwnerChanged {
+		changes = append(changes, "owner")
+	}
+	return strings.Join(changes, ", ")
+}
+
+// sizeDeltaToString prettifies a size difference.
+func sizeDeltaToString(delta int64) string {
+	if delta < 0 {
+		return "-" + knoxite.SizeToString(uint64(-delta))
+	}
+	return "+" + knoxite.SizeToString(uint64(delta))
+}
+
+func executeSnapshotForget(volID string, opts SnapshotForgetOptions) error {
+	policy := knoxite.RetentionPolicy{
+		Last:    opts.KeepLast,
+		Hourly:  opts.KeepHourly,
+		Daily:   opts.KeepDaily,
+		Weekly:  opts.KeepWeekly,
+		Monthly: opts.KeepMonthly,
+		Yearly:  opts.KeepYearly,
+		Tags:    opts.KeepTags,
+	}
+	if opts.KeepWithin != "" {
+		var err error
+		policy.Within, err = utils.DurationFromString(opts.KeepWithin)
+		if err != nil {
+			return err
+		}
+	}
+
+	repository, err := openRepository(globalOpts.Repo, globalOpts.Password)
+	if err != nil {
+		return err
+	}
+	unlock, err := lockRepository(&repository, !opts.DryRun)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	chunkIndex, err := knoxite.OpenChunkIndex(&repository)
+	if err != nil {
+		return err
+	}
+
+	volume, err := repository.FindVolume(volID)
+	if err != nil {
+		return err
+	}
+
+	results, err := volume.Forget(&repository, &chunkIndex, policy, opts.DryRun)
+	if err != nil {
+		return err
+	}
+
+	var freedSize uint64
+	if !opts.DryRun {
+		err = chunkIndex.Save(&repository)
+		if err != nil {
+			return err
+		}
+		err = repository.Save()
+		if err != nil {
+			return err
+		}
+
+		if opts.Pack {
+			freedSize, err = packRepository(&chunkIndex, &repository)
+			if err != nil {
+				return err
+			}
+			err = chunkIndex.Save(&repository)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if globalOpts.JSON {
+		out := []ForgetOutput{}
+		for _, result := range results {
+			out = append(out, ForgetOutput{
+				Snapshot: snapshotOutput(result.Snapshot),
+				Keep:     result.Keep,
+				Reasons:  nonNilStrings(result.Reasons),
+			})
+		}
+		return printJSON(out)
+	}
+
+	tab := gotable.NewTable([]string{"ID", "Date", "Action", "Reasons"},
+		[]int64{-8, -19, -6, -48}, "No snapshots found. This volume is empty.")
+	forgotten := 0
+	for _, result := range results {
+		decision := "keep"
+		if !result.Keep {
+			decision = "forget"
+			forgotten++
+		}
+		tab.AppendRow([]interface{}{
+			result.Snapshot.ID,
+			result.Snapshot.Date.Format(timeFormat),
+			decision,
+			strings.Join(result.Reasons, ", ")})
+	}
+	_ = tab.Print()
+
+	if opts.DryRun {
+		fmt.Printf("Would remove %d of %d snapshots\n", forgotten, len(results))
+		return nil
+	}
+	fmt.Printf("Removed %d of %d snapshots\n", forgotten, len(results))
+
+	if !opts.Pack {
+		fmt.Println("Do not forget to run 'repo pack' to delete un-referenced chunks and free up storage space!")
+		return nil
+	}
+	fmt.Printf("Freed storage space: %s\n", knoxite.SizeToString(freedSize))
+	return nil
 }
 
 func executeSnapshotRemove(snapshotID string) error {
@@ -68,6 +367,11 @@ func executeSnapshotRemove(snapshotID string) error {
 	if err != nil {
 		return err
 	}
+	unlock, err := lockRepository(&repository, true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
 	chunkIndex, err := knoxite.OpenChunkIndex(&repository)
 	if err != nil {
 		return err
@@ -99,7 +403,47 @@ func executeSnapshotRemove(snapshotID string) error {
 	return nil
 }
 
-func executeSnapshotList(volID string) error {
+func executeSnapshotTag(snapshotID string, add, remove []string) error {
+	repository, err := openRepository(globalOpts.Repo, globalOpts.Password)
+	if err != nil {
+		return err
+	}
+	unlock, err := lockRepository(&repository, true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	_, snapshot, err := repository.FindSnapshot(snapshotID)
+	if err != nil {
+		return err
+	}
+
+	snapshot.AddTags(add...)
+	snapshot.RemoveTags(remove...)
+	err = snapshot.Save(&repository)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Snapshot %s tags: %s\n", snapshot.ID, strings.Join(snapshot.Tags, ", "))
+	return nil
+}
+
+func executeSnapshotList(volID string, opts SnapshotListOptions) error {
+	filter := knoxite.SnapshotFilter{
+		Hostname: opts.Hostname,
+		Username: opts.Username,
+		Path:     opts.Path,
+		Tags:     opts.Tags,
+	}
+	if filter.Path != "" {
+		// source paths are stored as absolute paths
+		if absPath, err := filepath.Abs(filter.Path); err == nil {
+			filter.Path = absPath
+		}
+	}
+
 	repository, err := openRepository(globalOpts.Repo, globalOpts.Password)
 	if err != nil {
 		return err
@@ -110,27 +454,38 @@ func executeSnapshotList(volID string) error {
 		return err
 	}
 
-	tab := gotable.NewTable([]string{"ID", "Date", "Original Size", "Storage Size", "Description"},
-		[]int64{-8, -19, 13, 12, -48}, "No snapshots found. This volume is empty.")
+	tab := gotable.NewTable([]string{"ID", "Date", "Host", "Original Size", "Storage Size", "Tags", "Description"},
+		[]int64{-8, -19, -16, 13, 12, -16, -32}, "No snapshots found.")
 	totalSize := uint64(0)
 	totalStorageSize := uint64(0)
+	out := []SnapshotOutput{}
 
 	for _, snapshotID := range volume.Snapshots {
 		snapshot, err := volume.LoadSnapshot(snapshotID, &repository)
 		if err != nil {
 			return err
 		}
+		if !filter.Matches(snapshot) {
+			continue
+		}
+		out = append(out, snapshotOutput(snapshot))
 		tab.AppendRow([]interface{}{
 			snapshot.ID,
 			snapshot.Date.Format(timeFormat),
+			snapshot.Hostname,
 			knoxite.SizeToString(snapshot.Stats.Size),
 			knoxite.SizeToString(snapshot.Stats.StorageSize),
+			strings.Join(snapshot.Tags, ","),
 			snapshot.Description})
 		totalSize += snapshot.Stats.Size
 		totalStorageSize += snapshot.Stats.StorageSize
 	}
 
-	tab.SetSummary([]interface{}{"", "", knoxite.SizeToString(totalSize), knoxite.SizeToString(totalStorageSize), ""})
+	if globalOpts.JSON {
+		return printJSON(out)
+	}
+
+	tab.SetSummary([]interface{}{"", "", "", knoxite.SizeToString(totalSize), knoxite.SizeToString(totalStorageSize), "", ""})
 	_ = tab.Print()
 	return nil
 }
@@ -28,6 +28,8 @@ import (
 // Error declarations.
 var (
 	ErrRedundancyAmount = errors.New("failure tolerance can't be equal or higher as the number of storage backends")
+	ErrStdinWithTargets = errors.New("files and/or directories can't be stored together with stdin")
+	ErrNoStoreTargets   = errors.New("store needs to know which files and/or directories to work on")
 )
 
 // StoreOptions holds all the options that can be set for the 'store' command.
@@ -38,6 +40,12 @@ type StoreOptions struct {
 	FailureTolerance uint
 	Excludes         []string
 	Pedantic         bool
+	PackSize         string
+	Parent           string
+	ForceRehash      bool
+	Tags             []string
+	Stdin            bool
+	StdinFilename    string
 }
 
 var (
@@ -51,8 +59,8 @@ var (
 			if len(args) < 1 {
 				return fmt.Errorf("store needs to know which volume to create a snapshot in")
 			}
-			if len(args) < 2 {
-				return fmt.Errorf("store needs to know which files and/or directories to work on")
+			if err := checkStoreTargets(args[1:], storeOpts); err != nil {
+				return err
 			}
 
 			configureStoreOpts(cmd, &storeOpts)
@@ -82,20 +90,30 @@ func configureStoreOpts(cmd *cobra.Command, opts *StoreOptions) {
 		if !cmd.Flags().Changed("pedantic") {
 			opts.Pedantic = rep.Pedantic
 		}
+		if !cmd.Flags().Changed("pack-size") {
+			opts.PackSize = rep.PackSize
+		}
 	}
 }
 
 func initStoreFlags(cmd *cobra.Command, opts *StoreOptions) {
 	cmd.Flags().StringVarP(&opts.Description, "desc", "d", "", "a description or comment for this volume")
 	cmd.Flags().StringVarP(&opts.Compression, "compression", "c", "", "compression algo to use: none (default), flate, gzip, lzma, zlib, zstd")
-	cmd.Flags().StringVarP(&opts.Encryption, "encryption", "e", "", "encryption algo to use: aes (default), none")
+	cmd.Flags().StringVarP(&opts.Encryption, "encryption", "e", "", "encryption algo to use: aes (default, AES-GCM), aes-cfb (legacy), none")
 	cmd.Flags().UintVarP(&opts.FailureTolerance, "tolerance", "t", 0, "failure tolerance against n backend failures")
 	cmd.Flags().StringArrayVarP(&opts.Excludes, "excludes", "x", []string{}, "list of excludes")
 	cmd.Flags().BoolVar(&opts.Pedantic, "pedantic", false, "exit on first error")
+	cmd.Flags().StringVar(&opts.PackSize, "pack-size", "", "target size of pack files, e.g. 16MiB (default)")
+	cmd.Flags().StringVar(&opts.Parent, "parent", "", "snapshot to reuse unchanged files from (default: the latest snapshot in the volume)")
+	cmd.Flags().BoolVar(&opts.ForceRehash, "force-rehash", false, "read all files, even if they seem to be unchanged since the parent snapshot")
+	cmd.Flags().StringSliceVar(&opts.Tags, "tag", []string{}, "tag the snapshot, can be given multiple times")
+	cmd.Flags().BoolVar(&opts.Stdin, "stdin", false, "store the data read from stdin as a file")
+	cmd.Flags().StringVar(&opts.StdinFilename, "stdin-filename", "stdin", "path of the file created from stdin")
 
 	carapace.Gen(cmd).FlagCompletion(carapace.ActionMap{
 		"compression": carapace.ActionValues("none", "flate", "gzip", "lzma", "zlib", "zstd"),
-		"encryption":  carapace.ActionValues("aes", "none"),
+		"encryption":  carapace.ActionValues("aes", "aes-cfb", "none"),
+		"parent":      action.ActionSnapshots(cmd, ""),
 	})
 }
 
@@ -112,25 +130,34 @@ func init() {
 	)
 }
 
-func store(repository *knoxite.Repository, chunkIndex *knoxite.ChunkIndex, snapshot *knoxite.Snapshot, targets []string, opts StoreOptions) error {
+// store adds targets to a snapshot. It returns the errors which occurred for
+// individual files.
+func store(repository *knoxite.Repository, chunkIndex *knoxite.ChunkIndex, snapshot, parent *knoxite.Snapshot, targets []string, opts StoreOptions) (map[string]error, error) {
 	// we want to be notified during the first phase of a shutdown
 	cancel := shutdown.First()
 
 	wd, err := os.Getwd()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	if len(repository.BackendManager().Backends)-int(opts.FailureTolerance) <= 0 {
-		return ErrRedundancyAmount
+		return nil, ErrRedundancyAmount
 	}
 	compression, err := utils.CompressionTypeFromString(opts.Compression)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	encryption, err := utils.EncryptionTypeFromString(opts.Encryption)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	var packSize uint64
+	if opts.PackSize != "" {
+		packSize, err = humanize.ParseBytes(opts.PackSize)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	so := knoxite.StoreOptions{
@@ -142,10 +169,24 @@ func store(repository *knoxite.Repository, chunkIndex *knoxite.ChunkIndex, snaps
 		Pedantic:    opts.Pedantic,
 		DataParts:   uint(len(repository.BackendManager().Backends) - int(opts.FailureTolerance)),
 		ParityParts: opts.FailureTolerance,
+		PackSize:    packSize,
 	}
+	if !opts.ForceRehash {
+		so.Parent = parent
+	}
+
+	snapshot.Version = Version
+	snapshot.AddTags(opts.Tags...)
 
 	startTime := time.Now()
-	progress := snapshot.Add(*repository, chunkIndex, so)
+	var progress <-chan knoxite.Progress
+	if opts.Stdin {
+		progress = snapshot.AddReader(*repository, chunkIndex, os.Stdin, knoxite.ReaderOptions{
+			Path: opts.StdinFilename,
+		}, so)
+	} else {
+		progress = snapshot.Add(*repository, chunkIndex, so)
+	}
 
 	fileProgressBar := &goprogressbar.ProgressBar{Width: 40}
 	overallProgressBar := &goprogressbar.ProgressBar{
@@ -158,40 +199,59 @@ func store(repository *knoxite.Repository, chunkIndex *knoxite.ChunkIndex, snaps
 	}
 
 	pb := goprogressbar.MultiProgressBar{}
-	pb.AddProgressBar(fileProgressBar)
-	pb.AddProgressBar(overallProgressBar)
+	if showProgressBars() {
+		// adding progress bars already prints them
+		pb.AddProgressBar(fileProgressBar)
+		pb.AddProgressBar(overallProgressBar)
+	}
 	lastPath := ""
 
+	jp := newJSONProgress(0, true, processedSize)
+	if jp != nil {
+		defer jp.Close()
+	}
+
 	items := int64(1)
 	errs := make(map[string]error)
 	for p := range progress {
+		if jp != nil {
+			jp.Update(p)
+		}
+
 		select {
 		case n := <-cancel:
-			fmt.Println("Aborting...")
+			if showProgressBars() {
+				fmt.Println("Aborting...")
+			}
 			close(n)
-			return nil
+			return errs, nil
 
 		default:
 			if p.Error != nil {
 				if storeOpts.Pedantic {
-					fmt.Println()
-					return p.Error
+					if showProgressBars() {
+						fmt.Println()
+					}
+					return errs, p.Error
 				}
 				errs[p.Path] = p.Error
 				snapshot.Stats.Errors++
 			}
+			if !showProgressBars() {
+				continue
+			}
 			if p.Path != lastPath && lastPath != "" {
 				items++
 				fmt.Println()
 			}
 			fileProgressBar.Total = int64(p.CurrentItemStats.Size)
-			fileProgressBar.Current = int64(p.CurrentItemStats.Transferred)
+			fileProgressBar.Current = int64(processedSize(p.CurrentItemStats))
 			fileProgressBar.PrependText = fmt.Sprintf("%s  %s/s",
 				knoxite.SizeToString(uint64(fileProgressBar.Current)),
 				knoxite.SizeToString(p.TransferSpeed()))
 
 			overallProgressBar.Total = int64(p.TotalStatistics.Size)
-			overallProgressBar.Current = int64(p.TotalStatistics.Transferred)
+			overallProgressBar.Current = int64(processedSize(p.TotalStatistics))
 			overallProgressBar.Text = fmt.Sprintf("%s / %s (%s of %s)",
 				knoxite.SizeToString(uint64(overallProgressBar.Current)),
 				knoxite.SizeToString(uint64(overallProgressBar.Total)),
@@ -207,13 +267,70 @@ func store(repository *knoxite.Repository, chunkIndex *knoxite.ChunkIndex, snaps
 		}
 	}
 
-	fmt.Printf("\nSnapshot %s created: %s\n", snapshot.ID, snapshot.Stats.String())
+	if showProgressBars() {
+		fmt.Println()
+	}
+	return errs, nil
+}
+
+// printStoreSummary prints the statistics of a newly created snapshot and the
+// errors which occurred for individual files.
+func printStoreSummary(snapshot *knoxite.Snapshot, errs map[string]error) error {
+	if globalOpts.JSON {
+		return printJSON(StoreOutput{
+			Snapshot: snapshotOutput(snapshot),
+			Errors:   errorOutputs(errs),
+		})
+	}
+
+	fmt.Printf("Snapshot %s created: %s\n", snapshot.ID, snapshot.Stats.String())
+	fmt.Printf("New data: %s, deduplicated: %s, unchanged: %s, sparse: %s, uploaded: %s\n",
+		knoxite.SizeToString(snapshot.Stats.New),
+		knoxite.SizeToString(snapshot.Stats.Deduplicated),
+		knoxite.SizeToString(snapshot.Stats.Reused),
+		knoxite.SizeToString(snapshot.Stats.Sparse),
+		knoxite.SizeToString(snapshot.Stats.Uploaded))
 	for file, err := range errs {
 		fmt.Printf("'%s': failed to store: %v\n", file, err)
 	}
 	return nil
 }
 
+// checkStoreTargets makes sure there's something to store.
+func checkStoreTargets(targets []string, opts StoreOptions) error {
+	if opts.Stdin && len(targets) > 0 {
+		return ErrStdinWithTargets
+	}
+	if !opts.Stdin && len(targets) == 0 {
+		return ErrNoStoreTargets
+	}
+	return nil
+}
+
+// processedSize returns the size of all data which has been handled so far.
+func processedSize(stats knoxite.Stats) uint64 {
+	return stats.New + stats.Deduplicated + stats.Reused + stats.Sparse
+}
+
+// findParentSnapshot returns the snapshot to reuse unchanged files from, or
+// nil if there is none.
+func findParentSnapshot(repository *knoxite.Repository, volume *knoxite.Volume, opts StoreOptions) (*knoxite.Snapshot, error) {
+	if opts.ForceRehash {
+		return nil, nil
+	}
+	if opts.Parent != "" {
+		_, parent, err := repository.FindSnapshot(opts.Parent)
+		return parent, err
+	}
+
+	parent, err := volume.LatestSnapshot(repository)
+	if errors.Is(err, knoxite.ErrSnapshotNotFound) || errors.Is(err, knoxite.ErrPrivateKeyRequired) {
+		// there's no parent yet, or it can't be read in a write-only repository
+		return nil, nil
+	}
+	return parent, err
+}
+
 func executeStore(volumeID string, args []string, opts StoreOptions) error {
 	targets := []string{}
 	for _, target := range args {
@@ -232,6 +349,11 @@ func executeStore(volumeID string, args []string, opts StoreOptions) error {
 	if err != nil {
 		return err
 	}
+	unlock, err := lockRepository(&repository, true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
 	volume, err := repository.FindVolume(volumeID)
 	if err != nil {
 		return err
@@ -244,10 +366,14 @@ func executeStore(volumeID string, args []string, opts StoreOptions) error {
 	if err != nil {
 		return err
 	}
+	parent, err := findParentSnapshot(&repository, volume, opts)
+	if err != nil {
+		return err
+	}
 	// release the shutdown lock
 	lock()
 
-	err = store(&repository, &chunkIndex, snapshot, targets, opts)
+	errs, err := store(&repository, &chunkIndex, snapshot, parent, targets, opts)
 	if err != nil {
 		return err
 	}
@@ -271,5 +397,9 @@ func executeStore(volumeID string, args []string, opts StoreOptions) error {
 	if err != nil {
 		return err
 	}
-	return repository.Save()
+	err = repository.Save()
+	if err != nil {
+		return err
+	}
+	return printStoreSummary(snapshot, errs)
 }
@@ -14,8 +14,11 @@ import (
 	"io"
 	"net/url"
 	"os"
+	"regexp"
+	"strconv"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/knoxite/knoxite"
 	"github.com/mitchellh/go-homedir"
@@ -28,6 +31,16 @@ var (
 	ErrEncryptionUnknown  = errors.New("unknown encryption format")
 	ErrCompressionUnknown = errors.New("unknown compression format")
 	ErrLogLevelUnknown    = errors.New("unknown log level")
+	ErrInvalidDuration    = errors.New("invalid duration, expected e.g. 1y6m, 2w or 36h")
+
+	durationPattern = regexp.MustCompile(`^(\d+)([ymwdh])`)
+	durationUnits   = map[string]time.Duration{
+		"y": 365 * 24 * time.Hour,
+		"m": 30 * 24 * time.Hour,
+		"w": 7 * 24 * time.Hour,
+		"d": 24 * time.Hour,
+		"h": time.Hour,
+	}
 )
 
 func ReadPassword(prompt string) (string, error) {
@@ -128,9 +141,11 @@ func CompressionText(enum int) string {
 func EncryptionTypeFromString(s string) (uint16, error) {
 	switch strings.ToLower(s) {
 	case "":
-		// default is AES
+		// default is AES-GCM
 		fallthrough
-	case "aes":
+	case "aes", "aes-gcm":
+		return knoxite.EncryptionAESGCM, nil
+	case "aes-cfb":
 		return knoxite.EncryptionAES, nil
 	case "none":
 		return knoxite.EncryptionNone, nil
@@ -145,12 +160,39 @@ func EncryptionText(enum int) string {
 	case knoxite.EncryptionNone:
 		return "none"
 	case knoxite.EncryptionAES:
-		return "AES"
+		return "AES-CFB"
+	case knoxite.EncryptionAESGCM:
+		return "AES-GCM"
 	}
 
 	return "unknown"
 }
 
+// DurationFromString parses a duration like 1y6m, 2w3d or 36h. Years are
+// counted as 365 days, months as 30 days.
+func DurationFromString(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, ErrInvalidDuration
+	}
+
+	var d time.Duration
+	for len(s) > 0 {
+		m := durationPattern.FindStringSubmatch(s)
+		if m == nil {
+			return 0, ErrInvalidDuration
+		}
+		n, err := strconv.Atoi(m[1])
+		if err != nil {
+			return 0, ErrInvalidDuration
+		}
+
+		d += time.Duration(n) * durationUnits[m[2]]
+		s = s[len(m[0]):]
+	}
+
+	return d, nil
+}
+
 func isUrl(str string) bool {
 	if _, err := url.Parse(str); err != nil {
 		return false
@@ -63,16 +63,26 @@ func executeVerifyRepo(opts VerifyOptions) error {
 	if err != nil {
 		return err
 	}
+	unlock, err := lockRepository(&repository, false)
+	if err != nil {
+		return err
+	}
+	defer unlock()
 
 	progress, err := knoxite.VerifyRepo(repository, opts.Percentage)
 	if err != nil {
 		return err
 	}
 
-	errors := verify(progress)
+	errs := verify(progress)
+	if globalOpts.JSON {
+		return printJSON(VerifyOutput{Errors: errs})
+	}
 
-	fmt.Println()
-	fmt.Printf("Verify repository done: %d errors\n", len(errors))
+	if showProgressBars() {
+		fmt.Println()
+	}
+	fmt.Printf("Verify repository done: %d errors\n", len(errs))
 	return nil
 }
 
@@ -81,16 +91,26 @@ func executeVerifyVolume(volumeId string, opts VerifyOptions) error {
 	if err != nil {
 		return err
 	}
+	unlock, err := lockRepository(&repository, false)
+	if err != nil {
+		return err
+	}
+	defer unlock()
 
 	progress, err := knoxite.VerifyVolume(repository, volumeId, opts.Percentage)
 	if err != nil {
 		return err
 	}
 
-	errors := verify(progress)
+	errs := verify(progress)
+	if globalOpts.JSON {
+		return printJSON(VerifyOutput{Errors: errs})
+	}
 
-	fmt.Println()
-	fmt.Printf("Verify volume done: %d errors\n", len(errors))
+	if showProgressBars() {
+		fmt.Println()
+	}
+	fmt.Printf("Verify volume done: %d errors\n", len(errs))
 	return nil
 }
 
@@ -99,29 +119,55 @@ func executeVerifySnapshot(snapshotId string, opts VerifyOptions) error {
 	if err != nil {
 		return err
 	}
+	unlock, err := lockRepository(&repository, false)
+	if err != nil {
+		return err
+	}
+	defer unlock()
 
 	progress, err := knoxite.VerifySnapshot(repository, snapshotId, opts.Percentage)
 	if err != nil {
 		return err
 	}
 
-	errors := verify(progress)
+	errs := verify(progress)
+	if globalOpts.JSON {
+		return printJSON(VerifyOutput{Errors: errs})
+	}
 
-	fmt.Println()
-	fmt.Printf("Verify snapshot done: %d errors\n", len(errors))
+	if showProgressBars() {
+		fmt.Println()
+	}
+	fmt.Printf("Verify snapshot done: %d errors\n", len(errs))
 	return nil
 }
 
-func verify(progress <-chan knoxite.Progress) []error {
-	var errors []error
+// verify consumes the progress of a verification and returns the errors it
+// encountered.
+func verify(progress <-chan knoxite.Progress) []ErrorOutput {
+	errs := []ErrorOutput{}
 
 	pb := &goprogressbar.ProgressBar{Total: 1000, Width: 40}
 	lastPath := ""
 
+	jp := newJSONProgress(0, false, transferredSize)
+	if jp != nil {
+		defer jp.Close()
+	}
+
 	for p := range progress {
+		if jp != nil {
+			jp.Update(p)
+		}
+
+		if p.Error != nil {
+			errs = append(errs, ErrorOutput{Path: p.Path, Error: p.Error.Error()})
+		}
+		if !showProgressBars() {
+			continue
+		}
 		if p.Error != nil {
 			fmt.Println()
-			errors = append(errors, p.Error)
 		}
 
 		pb.Total = int64(p.CurrentItemStats.Size)
@@ -142,5 +188,5 @@ func verify(progress <-chan knoxite.Progress) []error {
 		pb.LazyPrint()
 	}
 
-	return errors
+	return errs
 }
@@ -91,6 +91,11 @@ func executeVolumeInit(name, description string) error {
 	if err != nil {
 		return err
 	}
+	unlock, err := lockRepository(&repository, true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
 
 	vol, err := knoxite.NewVolume(name, description)
 	if err != nil {
@@ -115,6 +120,11 @@ func executeVolumeRemove(volumeID string) error {
 	if err != nil {
 		return err
 	}
+	unlock, err := lockRepository(&repo, true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
 
 	chunkIndex, err := knoxite.OpenChunkIndex(&repo)
 	if err != nil {
@@ -156,6 +166,13 @@ func executeVolumeList() error {
 	if err != nil {
 		return err
 	}
+	if globalOpts.JSON {
+		out := []VolumeOutput{}
+		for _, volume := range repository.Volumes {
+			out = append(out, volumeOutput(volume))
+		}
+		return printJSON(out)
+	}
 
 	tab := gotable.NewTable([]string{"ID", "Name", "Description"},
 		[]int64{-8, -32, -48}, "No volumes found. This repository is empty.")
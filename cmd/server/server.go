@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
 	"net/http"
 	"os"
@@ -11,7 +12,7 @@ import (
 	"strings"
 )
 
-const storagePath = "/tmp/knoxite.storage"
+var storagePath = "/tmp/knoxite.storage"
 
 func authPath(w http.ResponseWriter, r *http.Request) (string, error) {
 	auth, _, ok := r.BasicAuth()
@@ -227,13 +228,162 @@ func downloadSnapshot(w http.ResponseWriter, r *http.Request) {
 	http.ServeFile(w, r, filepath.Join(path, "snapshots", r.URL.Path[10:]))
 }
 
+// uploadFile stores an uploaded file in dir.
+func uploadFile(w http.ResponseWriter, r *http.Request, dir string) {
+	path, err := authPath(w, r)
+	if err != nil {
+		fmt.Println("ERROR:", err)
+		return
+	}
+
+	err = r.ParseMultipartForm(32 << 20)
+	if err != nil {
+		fmt.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	file, handler, err := r.FormFile("uploadfile")
+	if err != nil {
+		fmt.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	defer file.Close()
+
+	path = filepath.Join(path, dir)
+	err = os.MkdirAll(path, 0700)
+	if err != nil {
+		fmt.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	fmt.Fprintf(w, "%v", handler.Header)
+	path = filepath.Join(path, filepath.Base(handler.Filename))
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		fmt.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+
+	_, err = io.Copy(f, file)
+	if err != nil {
+		fmt.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	fmt.Println("Stored", path)
+}
+
+// listFiles returns the names of all files in dir, one per line.
+func listFiles(w http.ResponseWriter, r *http.Request, dir string) {
+	path, err := authPath(w, r)
+	if err != nil {
+		fmt.Println("ERROR:", err)
+		return
+	}
+
+	files, err := ioutil.ReadDir(filepath.Join(path, dir))
+	if err != nil && !os.IsNotExist(err) {
+		fmt.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	for _, file := range files {
+		if !file.IsDir() {
+			fmt.Fprintln(w, file.Name())
+		}
+	}
+}
+
+// fileHandler serves, and deletes files in dir. The file name follows prefix
+// in the request's path.
+func fileHandler(dir, prefix string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := filepath.Base(r.URL.Path[len(prefix):])
+
+		path, err := authPath(w, r)
+		if err != nil {
+			fmt.Println("ERROR:", err)
+			return
+		}
+		path = filepath.Join(path, dir, name)
+
+		switch r.Method {
+		case "GET":
+			fmt.Println("Serving", path)
+			http.ServeFile(w, r, path)
+		case "DELETE":
+			fmt.Println("Deleting", path)
+			err := os.Remove(path)
+			if os.IsNotExist(err) {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			if err != nil {
+				fmt.Println(err)
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// uploadHandler stores files uploaded by POST requests in dir.
+func uploadHandler(dir string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		uploadFile(w, r, dir)
+	}
+}
+
+// listHandler lists the files in dir.
+func listHandler(dir string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		listFiles(w, r, dir)
+	}
+}
+
+// chunkIndex stores, serves and deletes the chunk-index.
+func chunkIndex(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "POST" {
+		uploadFile(w, r, "chunks")
+		return
+	}
+	fileHandler("chunks", "/")(w, r)
+}
+
+func newServeMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/upload", upload)
+	mux.HandleFunc("/download/", download)
+	mux.HandleFunc("/repository", repository)
+	mux.HandleFunc("/snapshot", uploadSnapshot)
+	mux.HandleFunc("/snapshot/", downloadSnapshot)
+	mux.HandleFunc("/chunkindex", chunkIndex)
+	mux.HandleFunc("/locks", listHandler("locks"))
+	mux.HandleFunc("/lock", uploadHandler("locks"))
+	mux.HandleFunc("/lock/", fileHandler("locks", "/lock/"))
+	mux.HandleFunc("/indexsegments", listHandler("index"))
+	mux.HandleFunc("/indexsegment", uploadHandler("index"))
+	mux.HandleFunc("/indexsegment/", fileHandler("index", "/indexsegment/"))
+	mux.HandleFunc("/pack", uploadHandler("packs"))
+	mux.HandleFunc("/pack/", fileHandler("packs", "/pack/"))
+	return mux
+}
+
 func main() {
-	http.HandleFunc("/upload", upload)
-	http.HandleFunc("/download/", download)
-	http.HandleFunc("/repository", repository)
-	http.HandleFunc("/snapshot", uploadSnapshot)
-	http.HandleFunc("/snapshot/", downloadSnapshot)
-	err := http.ListenAndServe(":42024", nil) // setting listening port
+	err := http.ListenAndServe(":42024", newServeMux()) // setting listening port
 	if err != nil {
 		log.Fatal("ListenAndServe:", err)
 	}
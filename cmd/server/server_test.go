@@ -0,0 +1,185 @@
+/*
+ * knoxite
+ *     Copyright (c) 2016-2021, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	knoxitehttp "github.com/knoxite/knoxite/storage/http"
+)
+
+func testBackend(t *testing.T) (*knoxitehttp.HTTPStorage, func()) {
+	dir, err := ioutil.TempDir("", "knoxite.server")
+	if err != nil {
+		t.Fatalf("Failed creating temporary dir for storage: %s", err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "user"), 0700); err != nil {
+		t.Fatalf("Failed creating user storage: %s", err)
+	}
+	storagePath = dir
+
+	ts := httptest.NewServer(newServeMux())
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed parsing server url: %s", err)
+	}
+	u.User = url.User("user")
+
+	return &knoxitehttp.HTTPStorage{URL: *u}, func() {
+		ts.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestServerLocks(t *testing.T) {
+	backend, cleanup := testBackend(t)
+	defer cleanup()
+
+	ids, err := backend.ListLocks()
+	if err != nil {
+		t.Fatalf("Failed listing locks: %s", err)
+	}
+	if len(ids) != 0 {
+		t.Errorf("Expected no locks, got %v", ids)
+	}
+
+	data := []byte("lock")
+	if err := backend.SaveLock("a", data); err != nil {
+		t.Fatalf("Failed saving lock: %s", err)
+	}
+	if err := backend.SaveLock("b", data); err != nil {
+		t.Fatalf("Failed saving lock: %s", err)
+	}
+
+	ids, err = backend.ListLocks()
+	if err != nil {
+		t.Fatalf("Failed listing locks: %s", err)
+	}
+	if !reflect.DeepEqual(ids, []string{"a", "b"}) {
+		t.Errorf("Expected locks [a b], got %v", ids)
+	}
+
+	b, err := backend.LoadLock("a")
+	if err != nil {
+		t.Fatalf("Failed loading lock: %s", err)
+	}
+	if !bytes.Equal(b, data) {
+		t.Errorf("Expected lock %q, got %q", data, b)
+	}
+
+	if err := backend.DeleteLock("a"); err != nil {
+		t.Fatalf("Failed deleting lock: %s", err)
+	}
+	if _, err := backend.LoadLock("a"); err == nil {
+		t.Error("Expected an error loading a deleted lock")
+	}
+	if err := backend.DeleteLock("a"); err == nil {
+		t.Error("Expected an error deleting a deleted lock")
+	}
+
+	ids, err = backend.ListLocks()
+	if err != nil {
+		t.Fatalf("Failed listing locks: %s", err)
+	}
+	if !reflect.DeepEqual(ids, []string{"b"}) {
+		t.Errorf("Expected locks [b], got %v", ids)
+	}
+}
+
+func TestServerChunkIndex(t *testing.T) {
+	backend, cleanup := testBackend(t)
+	defer cleanup()
+
+	if _, err := backend.LoadChunkIndex(); err == nil {
+		t.Error("Expected an error loading a missing chunk-index")
+	}
+
+	data := []byte("index")
+	if err := backend.SaveChunkIndex(data); err != nil {
+		t.Fatalf("Failed saving chunk-index: %s", err)
+	}
+	b, err := backend.LoadChunkIndex()
+	if err != nil {
+		t.Fatalf("Failed loading chunk-index: %s", err)
+	}
+	if !bytes.Equal(b, data) {
+		t.Errorf("Expected chunk-index %q, got %q", data, b)
+	}
+
+	if err := backend.DeleteChunkIndex(); err != nil {
+		t.Fatalf("Failed deleting chunk-index: %s", err)
+	}
+	if _, err := backend.LoadChunkIndex(); err == nil {
+		t.Error("Expected an error loading a deleted chunk-index")
+	}
+}
+
+func TestServerIndexSegments(t *testing.T) {
+	backend, cleanup := testBackend(t)
+	defer cleanup()
+
+	data := []byte("segment")
+	if err := backend.SaveIndexSegment("a", data); err != nil {
+		t.Fatalf("Failed saving index segment: %s", err)
+	}
+
+	ids, err := backend.ListIndexSegments()
+	if err != nil {
+		t.Fatalf("Failed listing index segments: %s", err)
+	}
+	if !reflect.DeepEqual(ids, []string{"a"}) {
+		t.Errorf("Expected index segments [a], got %v", ids)
+	}
+
+	b, err := backend.LoadIndexSegment("a")
+	if err != nil {
+		t.Fatalf("Failed loading index segment: %s", err)
+	}
+	if !bytes.Equal(b, data) {
+		t.Errorf("Expected index segment %q, got %q", data, b)
+	}
+
+	if err := backend.DeleteIndexSegment("a"); err != nil {
+		t.Fatalf("Failed deleting index segment: %s", err)
+	}
+	if _, err := backend.LoadIndexSegment("a"); err == nil {
+		t.Error("Expected an error loading a deleted index segment")
+	}
+}
+
+func TestServerPacks(t *testing.T) {
+	backend, cleanup := testBackend(t)
+	defer cleanup()
+
+	data := []byte("0123456789")
+	if _, err := backend.StorePack("a", data); err != nil {
+		t.Fatalf("Failed storing pack: %s", err)
+	}
+
+	b, err := backend.LoadPack("a", 2, 5)
+	if err != nil {
+		t.Fatalf("Failed loading pack: %s", err)
+	}
+	if !bytes.Equal(b, data[2:7]) {
+		t.Errorf("Expected pack range %q, got %q", data[2:7], b)
+	}
+
+	if err := backend.DeletePack("a"); err != nil {
+		t.Fatalf("Failed deleting pack: %s", err)
+	}
+	if _, err := backend.LoadPack("a", 0, 1); err == nil {
+		t.Error("Expected an error loading a deleted pack")
+	}
+}
@@ -11,11 +11,12 @@ import (
 	"bufio"
 	"bytes"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
-	"runtime"
+	"sort"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/klauspost/reedsolomon"
@@ -65,20 +66,57 @@ func (e *DataReconstructionError) Error() string {
 	return fmt.Sprintf("Could not reconstruct data, got %d out of %d chunks (%d backends missing data)", e.BlocksFound, e.Chunk.DataParts, e.FailedBackends)
 }
 
+// RestoreOptions holds all the options that can be set when restoring a
+// snapshot.
+type RestoreOptions struct {
+	Excludes []string
+	Pedantic bool
+	// NoXAttrs skips restoring extended attributes, ACLs & capabilities
+	NoXAttrs bool
+	// NoOwner skips restoring ownerships, which only get restored when
+	// running as root
+	NoOwner bool
+	// NumericOwner restores the stored user & group ids, instead of looking
+	// up the ids of the stored user & group names on this system
+	NumericOwner bool
+}
+
 // DecodeSnapshot restores an entire snapshot to dst.
 func DecodeSnapshot(repository Repository, snapshot *Snapshot, dst string, excludes []string, pedantic bool) (<-chan Progress, error) {
+	return DecodeSnapshotWithOptions(repository, snapshot, dst, RestoreOptions{
+		Excludes: excludes,
+		Pedantic: pedantic,
+	})
+}
+
+// DecodeSnapshotWithOptions restores an entire snapshot to dst.
+func DecodeSnapshotWithOptions(repository Repository, snapshot *Snapshot, dst string, opts RestoreOptions) (<-chan Progress, error) {
 	prog := make(chan Progress)
 	go func() {
 		defer close(prog)
+
+		// hard links can only be created once the file they link to has been
+		// restored, so they come last
+		var archives, links []*Archive
 		for _, arc := range snapshot.Archives {
+			if arc.LinkTo != "" {
+				links = append(links, arc)
+			} else {
+				archives = append(archives, arc)
+			}
+		}
+		restored := make(map[string]bool)
+		var decoded []*Archive
+
+		for _, arc := range append(archives, links...) {
 			path := filepath.Join(dst, arc.Path)
 
 			match := false
-			for _, exclude := range excludes {
+			for _, exclude := range opts.Excludes {
 				var err error
 				match, err = filepath.Match(strings.ToLower(exclude), strings.ToLower(arc.Path))
 				if err != nil {
-					fmt.Println("Invalid exclude filter:", exclude)
+					log.Warnf("Invalid exclude filter: %s", exclude)
 					return
 				}
 				if match {
@@ -90,16 +128,43 @@ func DecodeSnapshot(repository Repository, snapshot *Snapshot, dst string, exclu
 				continue
 			}
 
-			err := DecodeArchive(prog, repository, *arc, path)
+			// fall back to restoring the data if the linked file is missing
+			if restored[arc.LinkTo] && decodeHardLink(prog, *arc, path, filepath.Join(dst, arc.LinkTo)) {
+				continue
+			}
+
+			err := decodeArchive(prog, repository, *arc, path)
 			if err != nil {
 				p := newProgressError(err)
 				p.Path = arc.Path
 				prog <- p
-				if pedantic {
-					break
+				if opts.Pedantic {
+					return
 				}
 				continue
 			}
+			restored[arc.Path] = true
+			decoded = append(decoded, arc)
+		}
+
+		// Metadata gets restored once all contents have been written, so
+		// read-only directories can be populated and directories' modification
+		// times don't get changed afterwards. Children come before their
+		// parents.
+		sort.Slice(decoded, func(i, j int) bool {
+			return decoded[i].Path > decoded[j].Path
+		})
+		owners := newOwnerIDs(opts.NumericOwner)
+		for _, arc := range decoded {
+			err := restoreMetadata(filepath.Join(dst, arc.Path), *arc, opts, owners)
+			if err != nil {
+				p := newProgressError(err)
+				p.Path = arc.Path
+				prog <- p
+				if opts.Pedantic {
+					return
+				}
+			}
 		}
 	}()
 
@@ -107,7 +172,7 @@ func DecodeSnapshot(repository Repository, snapshot *Snapshot, dst string, exclu
 }
 
 func decodeChunk(repository Repository, archive Archive, chunk Chunk, b []byte) ([]byte, error) {
-	pipe, err := NewDecodingPipeline(archive.Compressed, archive.Encrypted, repository.Key)
+	pipe, err := NewDecodingPipeline(archive.Compressed, archive.Encrypted, repository.decryptionKey(archive.Encrypted))
 	if err != nil {
 		return []byte{}, err
 	}
@@ -116,7 +181,7 @@ func decodeChunk(repository Repository, archive Archive, chunk Chunk, b []byte)
 		return []byte{}, err
 	}
 
-	hashsum := Hash(b, HashHighway256)
+	hashsum := HashWithKey(b, HashHighway256, repository.HashKey)
 	if chunk.DecryptedHash != hashsum {
 		return []byte{}, &CheckSumError{"highwayhash", chunk.DecryptedHash, hashsum}
 	}
@@ -124,7 +189,40 @@ func decodeChunk(repository Repository, archive Archive, chunk Chunk, b []byte)
 	return b, nil
 }
 
+// loadChunk returns the decoded data of a chunk, preferably from the
+// repository's cache.
 func loadChunk(repository Repository, archive Archive, chunk Chunk) ([]byte, error) {
+	if chunk.Sparse {
+		return make([]byte, chunk.OriginalSize), nil
+	}
+	if repository.cache != nil {
+		if b, ok := repository.cache.Get(chunk.Hash); ok {
+			return b, nil
+		}
+	}
+
+	b, err := fetchChunk(repository, archive, chunk)
+	if err != nil {
+		return b, err
+	}
+	if repository.cache != nil {
+		repository.cache.Put(chunk.Hash, b)
+	}
+	return b, nil
+}
+
+// fetchChunk loads a chunk from the backends and decodes it.
+func fetchChunk(repository Repository, archive Archive, chunk Chunk) ([]byte, error) {
+	if chunk.Sparse {
+		return make([]byte, chunk.OriginalSize), nil
+	}
+
+	var err error
+	chunk.Packs, err = repository.chunkLocations(chunk.Hash)
+	if err != nil {
+		return []byte{}, err
+	}
+
 	if chunk.ParityParts > 0 {
 		enc, err := reedsolomon.New(int(chunk.DataParts), int(chunk.ParityParts))
 		if err != nil {
@@ -179,15 +277,24 @@ func loadChunk(repository Repository, archive Archive, chunk Chunk) ([]byte, err
 
 // DecodeArchive restores a single archive to path.
 func DecodeArchive(progress chan<- Progress, repository Repository, arc Archive, path string) error {
+	err := decodeArchive(progress, repository, arc, path)
+	if err != nil {
+		return err
+	}
+
+	return restoreMetadata(path, arc, RestoreOptions{}, newOwnerIDs(false))
+}
+
+// decodeArchive restores the content of a single archive to path. Its
+// metadata gets restored separately by restoreMetadata.
+func decodeArchive(progress chan<- Progress, repository Repository, arc Archive, path string) error {
 	p := newProgress(&arc)
 
 	if arc.Type == Directory {
 		//fmt.Printf("Creating directory %s\n", path)
-		err := os.MkdirAll(path, arc.Mode)
-		if err != nil {
-			return err
-		}
-		err = os.Chtimes(path, time.Now().Local(), time.Unix(arc.ModTime, 0))
+		// the directory has to stay writable until all its children are
+		// restored
+		err := os.MkdirAll(path, 0700)
 		if err != nil {
 			return err
 		}
@@ -195,15 +302,28 @@ func DecodeArchive(progress chan<- Progress, repository Repository, arc Archive,
 		progress <- p
 	} else if arc.Type == SymLink {
 		//fmt.Printf("Creating symlink %s -> %s\n", path, arc.PointsTo)
-		err := os.Symlink(arc.PointsTo, path)
+		err := os.MkdirAll(filepath.Dir(path), 0755)
+		if err != nil {
+			return err
+		}
+		err = os.Symlink(arc.PointsTo, path)
 		if err != nil {
 			return err
 		}
 		p.TotalStatistics.SymLinks++
 		progress <- p
+	} else if arc.Type == CharDevice || arc.Type == BlockDevice || arc.Type == FIFO || arc.Type == Socket {
+		err := os.MkdirAll(filepath.Dir(path), 0755)
+		if err != nil {
+			return err
+		}
+		err = mknod(path, arc)
+		if err != nil {
+			return err
+		}
+		progress <- p
 	} else if arc.Type == File {
-		parts := uint(len(arc.Chunks))
-		//fmt.Printf("Creating file %s (%d chunks).\n", path, parts)
+		//fmt.Printf("Creating file %s (%d chunks).\n", path, len(arc.Chunks))
 
 		p.TotalStatistics.Files++
 		p.TotalStatistics.Size = arc.Size
@@ -218,32 +338,61 @@ func DecodeArchive(progress chan<- Progress, repository Repository, arc Archive,
 		}
 
 		// write to disk
-		f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY, arc.Mode)
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
 		if err != nil {
 			return err
 		}
+		defer f.Close()
 
-		for i := uint(0); i < parts; i++ {
-			idx, err := arc.IndexOfChunk(i)
-			if err != nil {
-				return err
+		r, err := NewArchiveReader(repository, arc)
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+
+		// reads never cross chunk boundaries, so we report progress at least
+		// once per chunk
+		buf := make([]byte, 1<<20)
+		for {
+			// recreate holes instead of writing zeros
+			if hole := r.hole(); hole > 0 {
+				_, err = r.Seek(hole, io.SeekCurrent)
+				if err != nil {
+					return err
+				}
+				_, err = f.Seek(hole, io.SeekCurrent)
+				if err != nil {
+					return err
+				}
+
+				p.TotalStatistics.Transferred += uint64(hole)
+				p.CurrentItemStats.Transferred += uint64(hole)
+				progress <- p
+				continue
 			}
 
-			chunk := arc.Chunks[idx]
-			b, err := loadChunk(repository, arc, chunk)
+			n, err := r.Read(buf)
+			if err == io.EOF {
+				break
+			}
 			if err != nil {
 				return err
 			}
 
-			_, err = f.Write(b)
+			_, err = f.Write(buf[:n])
 			if err != nil {
 				return err
 			}
 
-			p.TotalStatistics.Transferred += uint64(len(b))
-			p.CurrentItemStats.Transferred += uint64(len(b))
+			p.TotalStatistics.Transferred += uint64(n)
+			p.CurrentItemStats.Transferred += uint64(n)
 			progress <- p
-			// fmt.Printf("Chunk OK: %d bytes, hash: %s\n", size, chunk.DecryptedHash)
+		}
+
+		// seeking beyond the end doesn't extend files ending with a hole
+		err = f.Truncate(r.Size())
+		if err != nil {
+			return err
 		}
 
 		err = f.Sync()
@@ -254,60 +403,91 @@ func DecodeArchive(progress chan<- Progress, repository Repository, arc Archive,
 		if err != nil {
 			return err
 		}
+	}
 
-		// Restore modification time
-		err = os.Chtimes(path, time.Unix(arc.ModTime, 0), time.Unix(arc.ModTime, 0))
+	return nil
+}
+
+// restoreMetadata restores the ownership, permissions, extended attributes,
+// modification time and flags of arc to path.
+func restoreMetadata(path string, arc Archive, opts RestoreOptions, owners *ownerIDs) error {
+	// Restore ownerships. Like tar, only root gets to give files away, other
+	// users keep owning what they restore. Geteuid returns -1 on Windows
+	if os.Geteuid() == 0 && !opts.NoOwner {
+		err := os.Lchown(path, owners.uid(arc), owners.gid(arc))
 		if err != nil {
 			return err
 		}
 	}
 
-	if runtime.GOOS == "windows" {
-		return nil
+	// Changing the owner clears setuid & setgid bits, so permissions need to
+	// be restored afterwards. Symlinks don't have permissions of their own
+	if arc.Type != SymLink {
+		err := os.Chmod(path, arc.Mode)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Changing the owner clears file capabilities, so extended attributes
+	// need to be restored afterwards
+	if !opts.NoXAttrs {
+		err := writeXAttrs(path, arc.XAttrs)
+		if err != nil {
+			return err
+		}
 	}
 
-	// Restore ownerships
-	return os.Lchown(path, int(arc.UID), int(arc.GID))
+	err := lchtimes(path, time.Unix(arc.ModTime, 0))
+	if err != nil {
+		return err
+	}
+
+	// Flags like immutable prevent any further changes, so they come last.
+	// Setting them would follow symlinks
+	if arc.Flags == 0 || arc.Type == SymLink {
+		return nil
+	}
+	return setFlags(path, arc.Flags)
 }
 
-var (
-	cache map[string][]byte
-	mutex = &sync.Mutex{}
-)
+// decodeHardLink recreates a hard link to the already restored file target.
+// It returns false if the link couldn't be created.
+func decodeHardLink(progress chan<- Progress, arc Archive, path, target string) bool {
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return false
+	}
+	err = os.Link(target, path)
+	if err != nil {
+		return false
+	}
 
-func init() {
-	cache = make(map[string][]byte)
+	p := newProgress(&arc)
+	p.TotalStatistics.Files++
+	p.TotalStatistics.StorageSize = arc.StorageSize
+	p.TotalStatistics.Transferred = arc.Size
+	p.CurrentItemStats.Transferred = arc.Size
+	progress <- p
+	return true
 }
 
-// DecodeArchiveData returns the content of a single archive.
+// DecodeArchiveData returns the content of a single archive. The entire
+// content is held in memory, use an ArchiveReader for large archives.
 func DecodeArchiveData(repository Repository, arc Archive) ([]byte, Stats, error) {
 	var b []byte
 	var stats Stats
 
 	if arc.Type == File {
-		parts := uint(len(arc.Chunks))
-
-		for i := uint(0); i < parts; i++ {
-			idx, err := arc.IndexOfChunk(i)
-			if err != nil {
-				return b, stats, err
-			}
-
-			chunk := arc.Chunks[idx]
-			mutex.Lock()
-			cd, ok := cache[chunk.Hash]
-			if ok {
-				fmt.Println("Using cached chunk", chunk.Hash)
-			} else {
-				cd, err = loadChunk(repository, arc, chunk)
-				if err != nil {
-					return b, stats, err
-				}
-				cache[chunk.Hash] = cd
-			}
+		r, err := NewArchiveReader(repository, arc)
+		if err != nil {
+			return b, stats, err
+		}
+		defer r.Close()
 
-			mutex.Unlock()
-			b = append(b, cd...)
+		b, err = ioutil.ReadAll(r)
+		if err != nil {
+			return b, stats, err
 		}
 
 		stats.StorageSize += arc.StorageSize
@@ -319,73 +499,32 @@ func DecodeArchiveData(repository Repository, arc Archive) ([]byte, Stats, error
 	return b, stats, nil
 }
 
-func readArchiveChunk(repository Repository, arc Archive, chunkNum uint) (*[]byte, error) {
-	var b []byte
-	var err error
+// ReadArchive reads up to size bytes starting at offset from an archive.
+//
+// Deprecated: use an ArchiveReader, which keeps the fetched chunks around
+// between reads.
+func ReadArchive(repository Repository, arc Archive, offset int, size int) (*[]byte, error) {
+	b := []byte{}
+	if arc.Type != File {
+		return &b, nil
+	}
 
-	idx, err := arc.IndexOfChunk(chunkNum)
+	r, err := NewArchiveReader(repository, arc)
 	if err != nil {
 		return &b, err
 	}
+	defer r.Close()
 
-	chunk := arc.Chunks[idx]
-	mutex.Lock()
-	cd, ok := cache[chunk.Hash]
-	if !ok {
-		cd, err = loadChunk(repository, arc, chunk)
-		if err != nil {
-			return &b, err
-		}
-		cache[chunk.Hash] = cd
+	if int64(offset) >= r.Size() {
+		return &b, io.EOF
 	}
 
-	mutex.Unlock()
-	b = append(b, cd...)
-
-	return &b, nil
-}
-
-// ReadArchive reads from an archive.
-func ReadArchive(repository Repository, arc Archive, offset int, size int) (*[]byte, error) {
-	var b []byte
-
-	// fmt.Println("Read req:", offset, size)
-	if arc.Type == File {
-		neededPart, internalOffset, err := arc.ChunkForOffset(offset)
-		if err != nil {
-			return &b, err
-		}
-
-		for len(b) < size {
-			if neededPart >= uint(len(arc.Chunks)) {
-				return &b, nil
-			}
-			cd, err := readArchiveChunk(repository, arc, neededPart)
-			if err != nil || len(*cd) == 0 {
-				//return b, err
-				panic(err)
-			}
-
-			d := (*cd)[internalOffset:]
-			if err != nil || len(d) == 0 {
-				//return b, err
-				panic(err)
-			}
-			if len(d)+len(b) > size {
-				b = append(b, d[:size-len(b)]...)
-			} else {
-				b = append(b, d...)
-			}
-
-			internalOffset = 0
-			neededPart++
-		}
-
-		// cache the next block NOW
-		go func() {
-			_, _ = readArchiveChunk(repository, arc, neededPart)
-		}()
+	b = make([]byte, size)
+	n, err := r.ReadAt(b, int64(offset))
+	b = b[:n]
+	if err == io.EOF {
+		// reading less than size bytes at the end of an archive is fine
+		err = nil
 	}
-
-	return &b, nil
+	return &b, err
 }
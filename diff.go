@@ -0,0 +1,155 @@
+/*
+ * knoxite
+ *     Copyright (c) 2016-2021, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package knoxite
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// An ArchiveDiff describes how an archive differs between two snapshots.
+type ArchiveDiff struct {
+	Path         string `json:"path"`
+	Added        bool   `json:"added,omitempty"`
+	Removed      bool   `json:"removed,omitempty"`
+	Modified     bool   `json:"modified,omitempty"`
+	ModeChanged  bool   `json:"mode_changed,omitempty"`
+	OwnerChanged bool   `json:"owner_changed,omitempty"`
+	SizeDelta    int64  `json:"size_delta"`
+
+	Old *Archive `json:"-"` // nil if the archive has been added
+	New *Archive `json:"-"` // nil if the archive has been removed
+}
+
+// A SnapshotDiff describes all changes between two snapshots.
+type SnapshotDiff struct {
+	Changes []ArchiveDiff `json:"changes"`
+
+	Added        int    `json:"added"`
+	Removed      int    `json:"removed"`
+	Modified     int    `json:"modified"`
+	ModeChanged  int    `json:"mode_changed"`
+	OwnerChanged int    `json:"owner_changed"`
+	AddedSize    uint64 `json:"added_size"`   // size of all added archives
+	RemovedSize  uint64 `json:"removed_size"` // size of all removed archives
+	SizeDelta    int64  `json:"size_delta"`   // change of the total size
+}
+
+// DiffSnapshots compares the archives of two snapshots. If path isn't empty,
+// only archives at or below path get compared.
+func DiffSnapshots(a, b *Snapshot, path string) SnapshotDiff {
+	diff := SnapshotDiff{
+		Changes: []ArchiveDiff{},
+	}
+
+	paths := []string{}
+	for p := range a.Archives {
+		if containsPath(path, p) {
+			paths = append(paths, p)
+		}
+	}
+	for p := range b.Archives {
+		if _, ok := a.Archives[p]; !ok && containsPath(path, p) {
+			paths = append(paths, p)
+		}
+	}
+	sort.Strings(paths)
+
+	for _, p := range paths {
+		d := diffArchives(p, a.Archives[p], b.Archives[p])
+		if !d.Added && !d.Removed && !d.Modified && !d.ModeChanged && !d.OwnerChanged {
+			continue
+		}
+
+		diff.Changes = append(diff.Changes, d)
+		diff.SizeDelta += d.SizeDelta
+		switch {
+		case d.Added:
+			diff.Added++
+			diff.AddedSize += d.New.Size
+		case d.Removed:
+			diff.Removed++
+			diff.RemovedSize += d.Old.Size
+		}
+		if d.Modified {
+			diff.Modified++
+		}
+		if d.ModeChanged {
+			diff.ModeChanged++
+		}
+		if d.OwnerChanged {
+			diff.OwnerChanged++
+		}
+	}
+
+	return diff
+}
+
+// diffArchives compares two versions of an archive, either of which might be
+// nil.
+func diffArchives(path string, before, after *Archive) ArchiveDiff {
+	d := ArchiveDiff{
+		Path: path,
+		Old:  before,
+		New:  after,
+	}
+
+	switch {
+	case before == nil:
+		d.Added = true
+		d.SizeDelta = int64(after.Size)
+	case after == nil:
+		d.Removed = true
+		d.SizeDelta = -int64(before.Size)
+	default:
+		d.SizeDelta = int64(after.Size) - int64(before.Size)
+		d.Modified = before.Type != after.Type ||
+			before.Size != after.Size ||
+			before.ModTime != after.ModTime ||
+			before.PointsTo != after.PointsTo ||
+			!sameChunks(before, after)
+		d.ModeChanged = before.Mode&^os.ModeType != after.Mode&^os.ModeType
+		d.OwnerChanged = before.UID != after.UID || before.GID != after.GID
+	}
+
+	return d
+}
+
+// sameChunks returns true if both archives consist of the same data chunks.
+func sameChunks(a, b *Archive) bool {
+	if len(a.Chunks) != len(b.Chunks) {
+		return false
+	}
+
+	for i := uint(0); i < uint(len(a.Chunks)); i++ {
+		ia, erra := a.IndexOfChunk(i)
+		ib, errb := b.IndexOfChunk(i)
+		if erra != nil || errb != nil {
+			return false
+		}
+		if a.Chunks[ia].DecryptedHash != b.Chunks[ib].DecryptedHash {
+			return false
+		}
+	}
+
+	return true
+}
+
+// containsPath returns true if p is dir itself or is located below dir. An
+// empty dir contains all paths.
+func containsPath(dir, p string) bool {
+	if dir == "" {
+		return true
+	}
+
+	dir = filepath.Clean(dir)
+	p = filepath.Clean(p)
+	return p == dir || strings.HasPrefix(p, strings.TrimSuffix(dir, string(filepath.Separator))+string(filepath.Separator))
+}
@@ -0,0 +1,62 @@
+/*
+ * knoxite
+ *     Copyright (c) 2016-2021, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package knoxite
+
+import (
+	"testing"
+)
+
+func TestDiffSnapshots(t *testing.T) {
+	a := &Snapshot{Archives: map[string]*Archive{
+		"dir":           {Path: "dir", Type: Directory, Mode: 0755},
+		"dir/unchanged": {Path: "dir/unchanged", Type: File, Mode: 0644, Size: 10, Chunks: []Chunk{{DecryptedHash: "a"}}},
+		"dir/modified":  {Path: "dir/modified", Type: File, Mode: 0644, Size: 10, Chunks: []Chunk{{DecryptedHash: "b"}}},
+		"dir/chmod":     {Path: "dir/chmod", Type: File, Mode: 0644, Size: 10, Chunks: []Chunk{{DecryptedHash: "c"}}},
+		"dir/removed":   {Path: "dir/removed", Type: File, Mode: 0644, Size: 20},
+		"other":         {Path: "other", Type: File, Mode: 0644, Size: 5},
+	}}
+	b := &Snapshot{Archives: map[string]*Archive{
+		"dir":           {Path: "dir", Type: Directory, Mode: 0755},
+		"dir/unchanged": {Path: "dir/unchanged", Type: File, Mode: 0644, Size: 10, Chunks: []Chunk{{DecryptedHash: "a"}}},
+		"dir/modified":  {Path: "dir/modified", Type: File, Mode: 0644, Size: 10, Chunks: []Chunk{{DecryptedHash: "d"}}},
+		"dir/chmod":     {Path: "dir/chmod", Type: File, Mode: 0600, UID: 1, Size: 10, Chunks: []Chunk{{DecryptedHash: "c"}}},
+		"dir/added":     {Path: "dir/added", Type: File, Mode: 0644, Size: 30},
+		"other":         {Path: "other", Type: File, Mode: 0644, Size: 7, ModTime: 1},
+	}}
+
+	diff := DiffSnapshots(a, b, "")
+	expected := []string{"dir/added", "dir/chmod", "dir/modified", "dir/removed", "other"}
+	if len(diff.Changes) != len(expected) {
+		t.Fatalf("Expected %d changes, got %+v", len(expected), diff.Changes)
+	}
+	for i, path := range expected {
+		if diff.Changes[i].Path != path {
+			t.Errorf("Expected change #%d to be %s, got %s", i, path, diff.Changes[i].Path)
+		}
+	}
+
+	c := diff.Changes[1]
+	if c.Modified || !c.ModeChanged || !c.OwnerChanged {
+		t.Errorf("Expected mode and owner of dir/chmod to be changed, got %+v", c)
+	}
+	if !diff.Changes[2].Modified {
+		t.Errorf("Expected dir/modified to be modified")
+	}
+	if diff.Added != 1 || diff.Removed != 1 || diff.Modified != 2 || diff.ModeChanged != 1 || diff.OwnerChanged != 1 {
+		t.Errorf("Unexpected summary: %+v", diff)
+	}
+	if diff.AddedSize != 30 || diff.RemovedSize != 20 || diff.SizeDelta != 12 {
+		t.Errorf("Unexpected size deltas: %+v", diff)
+	}
+
+	// limited to a path
+	diff = DiffSnapshots(a, b, "dir/")
+	if len(diff.Changes) != 4 || diff.SizeDelta != 10 {
+		t.Errorf("Expected 4 changes below dir, got %+v", diff.Changes)
+	}
+}
@@ -10,105 +10,263 @@ package knoxite
 import (
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/rand"
 	"crypto/sha256"
+	"encoding/base64"
 	"errors"
+	"io"
+
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/hkdf"
+	"golang.org/x/crypto/nacl/box"
 )
 
 // Available encryption algos.
 const (
 	EncryptionNone = iota
-	EncryptionAES
+	EncryptionAES  // legacy AES-CFB with a key-derived IV, only kept for reading old data
+	EncryptionAESGCM
+	EncryptionX25519 // sealed to a X25519 public key, only the private key can decrypt
+)
+
+const (
+	// hkdfInfoAESGCM binds keys derived for AES-GCM to their purpose.
+	hkdfInfoAESGCM  = "knoxite aes-256-gcm"
+	aesGCMKeyLength = 32
 )
 
 // Error declarations.
 var (
-	ErrInvalidPassword = errors.New("empty password not permitted")
+	ErrInvalidPassword       = errors.New("empty password not permitted")
+	ErrUnknownEncryption     = errors.New("unknown encryption method")
+	ErrCiphertextTooShort    = errors.New("ciphertext too short")
+	ErrDecryptionAuthFailure = errors.New("message authentication failed")
+	ErrInvalidX25519Key      = errors.New("invalid X25519 key")
+	ErrPrivateKeyRequired    = errors.New("this repository is write-only, the private key is required to decrypt data")
 )
 
 // Encryptor is a pipeline processor that encrypts data.
 type Encryptor struct {
 	Method uint16
 
-	iv    []byte
-	block cipher.Block
+	iv        []byte
+	block     cipher.Block
+	aead      cipher.AEAD
+	recipient *[32]byte
 }
 
-// NewEncryptor returns a newly configured Encryptor.
+// NewEncryptor returns a newly configured Encryptor. For EncryptionX25519 the
+// password is the recipient's public key.
 func NewEncryptor(method uint16, password string) (Encryptor, error) {
 	e := Encryptor{
 		Method: method,
 	}
-	if method == EncryptionAES {
-		if len(password) == 0 {
-			return e, ErrInvalidPassword
-		}
 
-		key := sha256.Sum256([]byte(password))
-		e.iv = key[:aes.BlockSize]
-
-		var err error
-		e.block, err = aes.NewCipher(key[:])
-		if err != nil {
-			return e, err
-		}
+	var err error
+	switch method {
+	case EncryptionNone:
+	case EncryptionAES:
+		e.iv, e.block, err = newLegacyAESCipher(password)
+	case EncryptionAESGCM:
+		e.aead, err = newAESGCMCipher(password)
+	case EncryptionX25519:
+		e.recipient, err = parseX25519Key(password)
+	default:
+		err = ErrUnknownEncryption
 	}
 
-	return e, nil
+	return e, err
 }
 
 // Process encrypts the data.
 func (e Encryptor) Process(data []byte) ([]byte, error) {
-	if e.Method == EncryptionNone {
+	switch e.Method {
+	case EncryptionNone:
 		return data, nil
-	}
 
-	b := make([]byte, len(data))
-	encrypter := cipher.NewCFBEncrypter(e.block, e.iv)
-	encrypter.XORKeyStream(b, data)
+	case EncryptionAES:
+		b := make([]byte, len(data))
+		encrypter := cipher.NewCFBEncrypter(e.block, e.iv)
+		encrypter.XORKeyStream(b, data)
+		return b, nil
+
+	case EncryptionAESGCM:
+		// every message gets its own random nonce, which gets prepended to
+		// the sealed data: nonce || ciphertext || tag
+		nonce := make([]byte, e.aead.NonceSize(), e.aead.NonceSize()+len(data)+e.aead.Overhead())
+		if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+			return nil, err
+		}
+		return e.aead.Seal(nonce, nonce, data, nil), nil
+
+	case EncryptionX25519:
+		// every message gets sealed with a new ephemeral key pair
+		return box.SealAnonymous(nil, data, e.recipient, rand.Reader)
+	}
 
-	return b, nil
+	return nil, ErrUnknownEncryption
 }
 
 // Decryptor is a pipeline processor that decrypts data.
 type Decryptor struct {
 	Method uint16
 
-	iv    []byte
-	block cipher.Block
+	iv         []byte
+	block      cipher.Block
+	aead       cipher.AEAD
+	publicKey  *[32]byte
+	privateKey *[32]byte
 }
 
-// NewDecryptor returns a newly configured Decryptor.
+// NewDecryptor returns a newly configured Decryptor. For EncryptionX25519 the
+// password is the recipient's private key.
 func NewDecryptor(method uint16, password string) (Decryptor, error) {
 	e := Decryptor{
 		Method: method,
 	}
-	if method == EncryptionAES {
+
+	var err error
+	switch method {
+	case EncryptionNone:
+	case EncryptionAES:
+		e.iv, e.block, err = newLegacyAESCipher(password)
+	case EncryptionAESGCM:
+		e.aead, err = newAESGCMCipher(password)
+	case EncryptionX25519:
 		if len(password) == 0 {
-			return e, ErrInvalidPassword
+			return e, ErrPrivateKeyRequired
 		}
-
-		key := sha256.Sum256([]byte(password))
-		e.iv = key[:aes.BlockSize]
-
-		var err error
-		e.block, err = aes.NewCipher(key[:])
+		e.privateKey, err = parseX25519Key(password)
 		if err != nil {
 			return e, err
 		}
+		e.publicKey, err = x25519PublicKey(e.privateKey)
+	default:
+		err = ErrUnknownEncryption
 	}
 
-	return e, nil
+	return e, err
 }
 
 // Process decrypts the data.
 func (e Decryptor) Process(data []byte) ([]byte, error) {
-	if e.Method == EncryptionNone {
+	switch e.Method {
+	case EncryptionNone:
 		return data, nil
+
+	case EncryptionAES:
+		b := make([]byte, len(data))
+		decrypter := cipher.NewCFBDecrypter(e.block, e.iv)
+		decrypter.XORKeyStream(b, data)
+		return b, nil
+
+	case EncryptionAESGCM:
+		ns := e.aead.NonceSize()
+		if len(data) < ns+e.aead.Overhead() {
+			return nil, ErrCiphertextTooShort
+		}
+		b, err := e.aead.Open(nil, data[:ns], data[ns:], nil)
+		if err != nil {
+			return nil, ErrDecryptionAuthFailure
+		}
+		return b, nil
+
+	case EncryptionX25519:
+		b, ok := box.OpenAnonymous(nil, data, e.publicKey, e.privateKey)
+		if !ok {
+			return nil, ErrDecryptionAuthFailure
+		}
+		return b, nil
 	}
 
-	b := make([]byte, len(data))
-	decrypter := cipher.NewCFBDecrypter(e.block, e.iv)
-	decrypter.XORKeyStream(b, data)
+	return nil, ErrUnknownEncryption
+}
+
+// isDeterministicEncryption returns true if method always produces the same
+// ciphertext for the same data and key.
+func isDeterministicEncryption(method uint16) bool {
+	return method == EncryptionNone || method == EncryptionAES
+}
+
+// GenerateX25519KeyPair returns a new public and private key for
+// EncryptionX25519.
+func GenerateX25519KeyPair() (publicKey string, privateKey string, err error) {
+	pub, priv, err := box.GenerateKey(rand.Reader)
+	if err != nil {
+		return "", "", err
+	}
+
+	return base64.URLEncoding.EncodeToString(pub[:]), base64.URLEncoding.EncodeToString(priv[:]), nil
+}
+
+// X25519PublicKey returns the public key belonging to privateKey.
+func X25519PublicKey(privateKey string) (string, error) {
+	priv, err := parseX25519Key(privateKey)
+	if err != nil {
+		return "", err
+	}
+	pub, err := x25519PublicKey(priv)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.URLEncoding.EncodeToString(pub[:]), nil
+}
+
+func x25519PublicKey(privateKey *[32]byte) (*[32]byte, error) {
+	b, err := curve25519.X25519(privateKey[:], curve25519.Basepoint)
+	if err != nil {
+		return nil, err
+	}
+
+	var pub [32]byte
+	copy(pub[:], b)
+	return &pub, nil
+}
+
+func parseX25519Key(s string) (*[32]byte, error) {
+	b, err := base64.URLEncoding.DecodeString(s)
+	if err != nil || len(b) != 32 {
+		return nil, ErrInvalidX25519Key
+	}
+
+	var key [32]byte
+	copy(key[:], b)
+	return &key, nil
+}
+
+// newLegacyAESCipher sets up the AES-CFB cipher used by EncryptionAES.
+func newLegacyAESCipher(password string) ([]byte, cipher.Block, error) {
+	if len(password) == 0 {
+		return nil, nil, ErrInvalidPassword
+	}
+
+	key := sha256.Sum256([]byte(password))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return key[:aes.BlockSize], block, nil
+}
+
+// newAESGCMCipher derives an AES-256 key from password with HKDF-SHA256 and
+// returns an AES-GCM AEAD for it.
+func newAESGCMCipher(password string) (cipher.AEAD, error) {
+	if len(password) == 0 {
+		return nil, ErrInvalidPassword
+	}
+
+	key := make([]byte, aesGCMKeyLength)
+	kdf := hkdf.New(sha256.New, []byte(password), nil, []byte(hkdfInfoAESGCM))
+	if _, err := io.ReadFull(kdf, key); err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
 
-	return b, nil
+	return cipher.NewGCM(block)
 }
@@ -8,6 +8,7 @@
 package knoxite
 
 import (
+	"bytes"
 	"testing"
 )
 
@@ -38,14 +39,120 @@ func TestEncryption(t *testing.T) {
 	}
 }
 
-func TestEmptyPassword(t *testing.T) {
-	_, err := NewEncodingPipeline(CompressionNone, EncryptionAES, "")
-	if err != ErrInvalidPassword {
-		t.Errorf("Expected %v, got %v", ErrInvalidPassword, err)
+func TestEncryptionAESGCM(t *testing.T) {
+	testPassword := "this_is_a_password"
+	b := []byte("1234567890")
+
+	epipe, err := NewEncodingPipeline(CompressionNone, EncryptionAESGCM, testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	be1, err := epipe.Process(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	be2, err := epipe.Process(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(be1, be2) {
+		t.Error("Encrypting the same data twice resulted in identical ciphertexts")
+	}
+
+	dpipe, err := NewDecodingPipeline(CompressionNone, EncryptionAESGCM, testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, be := range [][]byte{be1, be2} {
+		bd, err := dpipe.Process(be)
+		if err != nil {
+			t.Error(err)
+		}
+		if !bytes.Equal(b, bd) {
+			t.Error("Data mismatch after encryption & decryption cycle.")
+		}
+	}
+
+	// any modification of the ciphertext must be detected
+	be1[len(be1)-1] ^= 0xff
+	if _, err := dpipe.Process(be1); err != ErrDecryptionAuthFailure {
+		t.Errorf("Expected %v, got %v", ErrDecryptionAuthFailure, err)
+	}
+	if _, err := dpipe.Process(be2[:4]); err != ErrCiphertextTooShort {
+		t.Errorf("Expected %v, got %v", ErrCiphertextTooShort, err)
+	}
+
+	wpipe, err := NewDecodingPipeline(CompressionNone, EncryptionAESGCM, "wrong_password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := wpipe.Process(be2); err != ErrDecryptionAuthFailure {
+		t.Errorf("Expected %v, got %v", ErrDecryptionAuthFailure, err)
+	}
+}
+
+func TestEncryptionX25519(t *testing.T) {
+	b := []byte("1234567890")
+
+	pub, priv, err := GenerateX25519KeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p, err := X25519PublicKey(priv); err != nil || p != pub {
+		t.Errorf("Public key mismatch, got %s expected %s", p, pub)
 	}
 
-	_, err = NewDecodingPipeline(CompressionNone, EncryptionAES, "")
-	if err != ErrInvalidPassword {
-		t.Errorf("Expected %v, got %v", ErrInvalidPassword, err)
+	epipe, err := NewEncodingPipeline(CompressionNone, EncryptionX25519, pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	be, err := epipe.Process(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dpipe, err := NewDecodingPipeline(CompressionNone, EncryptionX25519, priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bd, err := dpipe.Process(be)
+	if err != nil {
+		t.Error(err)
+	}
+	if !bytes.Equal(b, bd) {
+		t.Error("Data mismatch after encryption & decryption cycle.")
+	}
+
+	_, otherPriv, err := GenerateX25519KeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wpipe, err := NewDecodingPipeline(CompressionNone, EncryptionX25519, otherPriv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := wpipe.Process(be); err != ErrDecryptionAuthFailure {
+		t.Errorf("Expected %v, got %v", ErrDecryptionAuthFailure, err)
+	}
+
+	if _, err := NewDecodingPipeline(CompressionNone, EncryptionX25519, ""); err != ErrPrivateKeyRequired {
+		t.Errorf("Expected %v, got %v", ErrPrivateKeyRequired, err)
+	}
+	if _, err := NewEncodingPipeline(CompressionNone, EncryptionX25519, "invalid"); err != ErrInvalidX25519Key {
+		t.Errorf("Expected %v, got %v", ErrInvalidX25519Key, err)
+	}
+}
+
+func TestEmptyPassword(t *testing.T) {
+	for _, method := range []uint16{EncryptionAES, EncryptionAESGCM} {
+		_, err := NewEncodingPipeline(CompressionNone, method, "")
+		if err != ErrInvalidPassword {
+			t.Errorf("Expected %v, got %v", ErrInvalidPassword, err)
+		}
+
+		_, err = NewDecodingPipeline(CompressionNone, method, "")
+		if err != ErrInvalidPassword {
+			t.Errorf("Expected %v, got %v", ErrInvalidPassword, err)
+		}
 	}
 }
@@ -0,0 +1,130 @@
+/*
+ * knoxite
+ *     Copyright (c) 2016-2021, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package knoxite
+
+import (
+	"path/filepath"
+	"regexp"
+	"sort"
+	"time"
+)
+
+// FindOptions holds all the criteria archives get matched against.
+type FindOptions struct {
+	Pattern string // glob pattern matched against the path and the filename
+	Regexp  bool   // treat Pattern as a regular expression matched against the path
+
+	MinSize   uint64    // ignored if zero
+	MaxSize   uint64    // ignored if zero
+	NewerThan time.Time // ignored if zero
+	OlderThan time.Time // ignored if zero
+
+	Volume   string // only search this volume, if set
+	Snapshot string // only search this snapshot, if set
+}
+
+// A FindResult is an archive matching the search criteria.
+type FindResult struct {
+	Volume   *Volume
+	Snapshot *Snapshot
+	Archive  *Archive
+}
+
+// Find searches the snapshots of a repository for archives matching opts.
+func (r *Repository) Find(opts FindOptions) ([]FindResult, error) {
+	match, err := archiveMatcher(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	volumes := r.Volumes
+	if opts.Volume != "" {
+		volume, err := r.FindVolume(opts.Volume)
+		if err != nil {
+			return nil, err
+		}
+		volumes = []*Volume{volume}
+	}
+
+	results := []FindResult{}
+	for _, volume := range volumes {
+		for _, id := range volume.Snapshots {
+			if opts.Snapshot != "" && id != opts.Snapshot {
+				continue
+			}
+
+			snapshot, err := volume.LoadSnapshot(id, r)
+			if err != nil {
+				return results, err
+			}
+			paths := make([]string, 0, len(snapshot.Archives))
+			for path := range snapshot.Archives {
+				paths = append(paths, path)
+			}
+			sort.Strings(paths)
+
+			for _, path := range paths {
+				if archive := snapshot.Archives[path]; match(archive) {
+					results = append(results, FindResult{
+						Volume:   volume,
+						Snapshot: snapshot,
+						Archive:  archive,
+					})
+				}
+			}
+		}
+	}
+
+	return results, nil
+}
+
+// archiveMatcher returns a func, which checks whether an archive matches the
+// criteria in opts.
+func archiveMatcher(opts FindOptions) (func(*Archive) bool, error) {
+	matchPath := func(path string) bool {
+		return true
+	}
+
+	if opts.Regexp {
+		re, err := regexp.Compile(opts.Pattern)
+		if err != nil {
+			return nil, err
+		}
+		matchPath = re.MatchString
+	} else if opts.Pattern != "" {
+		// reject invalid patterns right away
+		if _, err := filepath.Match(opts.Pattern, ""); err != nil {
+			return nil, err
+		}
+		matchPath = func(path string) bool {
+			m, _ := filepath.Match(opts.Pattern, path)
+			if !m {
+				m, _ = filepath.Match(opts.Pattern, filepath.Base(path))
+			}
+			return m
+		}
+	}
+
+	return func(arc *Archive) bool {
+		if opts.MinSize > 0 && arc.Size < opts.MinSize {
+			return false
+		}
+		if opts.MaxSize > 0 && arc.Size > opts.MaxSize {
+			return false
+		}
+		modTime := time.Unix(arc.ModTime, 0)
+		if !opts.NewerThan.IsZero() && !modTime.After(opts.NewerThan) {
+			return false
+		}
+		if !opts.OlderThan.IsZero() && !modTime.Before(opts.OlderThan) {
+			return false
+		}
+
+		return matchPath(arc.Path)
+	}, nil
+}
@@ -0,0 +1,67 @@
+/*
+ * knoxite
+ *     Copyright (c) 2016-2021, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package knoxite
+
+import (
+	"testing"
+	"time"
+)
+
+func TestArchiveMatcher(t *testing.T) {
+	archives := []*Archive{
+		{Path: "docs/readme.txt", Size: 10, ModTime: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC).Unix()},
+		{Path: "docs/manual.pdf", Size: 5000, ModTime: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC).Unix()},
+		{Path: "src/main.go", Size: 200, ModTime: time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC).Unix()},
+	}
+
+	tests := []struct {
+		opts     FindOptions
+		expected []string
+	}{
+		{FindOptions{}, []string{"docs/readme.txt", "docs/manual.pdf", "src/main.go"}},
+		{FindOptions{Pattern: "*.txt"}, []string{"docs/readme.txt"}},
+		{FindOptions{Pattern: "docs/*"}, []string{"docs/readme.txt", "docs/manual.pdf"}},
+		{FindOptions{Pattern: `^src/.*\.go$`, Regexp: true}, []string{"src/main.go"}},
+		{FindOptions{MinSize: 100}, []string{"docs/manual.pdf", "src/main.go"}},
+		{FindOptions{MinSize: 100, MaxSize: 1000}, []string{"src/main.go"}},
+		{FindOptions{NewerThan: time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC)}, []string{"docs/manual.pdf", "src/main.go"}},
+		{FindOptions{OlderThan: time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC), Pattern: "docs/*"}, []string{"docs/readme.txt", "docs/manual.pdf"}},
+	}
+
+	for _, tt := range tests {
+		match, err := archiveMatcher(tt.opts)
+		if err != nil {
+			t.Errorf("Failed creating matcher for %+v: %s", tt.opts, err)
+			continue
+		}
+
+		found := []string{}
+		for _, arc := range archives {
+			if match(arc) {
+				found = append(found, arc.Path)
+			}
+		}
+		if len(found) != len(tt.expected) {
+			t.Errorf("Expected %v for %+v, got %v", tt.expected, tt.opts, found)
+			continue
+		}
+		for i := range found {
+			if found[i] != tt.expected[i] {
+				t.Errorf("Expected %v for %+v, got %v", tt.expected, tt.opts, found)
+				break
+			}
+		}
+	}
+
+	if _, err := archiveMatcher(FindOptions{Pattern: "[", Regexp: true}); err == nil {
+		t.Error("Expected an error for an invalid regular expression")
+	}
+	if _, err := archiveMatcher(FindOptions{Pattern: "["}); err == nil {
+		t.Error("Expected an error for an invalid glob pattern")
+	}
+}
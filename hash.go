@@ -8,10 +8,13 @@
 package knoxite
 
 import (
+	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/hex"
+	"io"
 
 	"github.com/minio/highwayhash"
+	"golang.org/x/crypto/hkdf"
 )
 
 // Available hash algos.
@@ -20,18 +23,56 @@ const (
 	HashHighway256
 )
 
-var hashkey [32]byte
+const (
+	// hkdfInfoHashKey binds keys derived for hashing to their purpose.
+	hkdfInfoHashKey = "knoxite highwayhash"
+	hashKeyLength   = 32
+)
+
+// legacyHashKey is the all-zero key, which was used to hash chunks before
+// repositories got their own hash key.
+var legacyHashKey [hashKeyLength]byte
 
-// Hash data.
+// Hash data without a key. The result only depends on the data, so it must
+// not be used for anything that would reveal the plaintext's identity.
 func Hash(b []byte, hashtype uint8) string {
+	return HashWithKey(b, hashtype, nil)
+}
+
+// HashWithKey hashes data with a secret key, usually a repository's HashKey.
+// HashSha256 turns into HMAC-SHA256, while HashHighway256 uses key as its key,
+// which needs to be 32 bytes long. An empty key results in the same hashes
+// as Hash.
+func HashWithKey(b []byte, hashtype uint8, key []byte) string {
 	var data [32]byte
 
 	switch hashtype {
 	case HashSha256:
-		data = sha256.Sum256(b)
+		if len(key) == 0 {
+			data = sha256.Sum256(b)
+		} else {
+			mac := hmac.New(sha256.New, key)
+			_, _ = mac.Write(b)
+			copy(data[:], mac.Sum(nil))
+		}
 	case HashHighway256:
-		data = highwayhash.Sum(b, hashkey[:])
+		if len(key) == 0 {
+			key = legacyHashKey[:]
+		}
+		data = highwayhash.Sum(b, key)
 	}
 
 	return hex.EncodeToString(data[:])
 }
+
+// deriveHashKey derives a repository's hash key from its secret key.
+func deriveHashKey(key string) ([]byte, error) {
+	if len(key) == 0 {
+		return nil, ErrInvalidPassword
+	}
+
+	b := make([]byte, hashKeyLength)
+	kdf := hkdf.New(sha256.New, []byte(key), nil, []byte(hkdfInfoHashKey))
+	_, err := io.ReadFull(kdf, b)
+	return b, err
+}
@@ -0,0 +1,154 @@
+/*
+ * knoxite
+ *     Copyright (c) 2016-2021, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package knoxite
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHashWithKey(t *testing.T) {
+	data := []byte("knoxite")
+	key1, _ := deriveHashKey("this_is_a_key")
+	key2, _ := deriveHashKey("this_is_another_key")
+
+	for _, hashtype := range []uint8{HashSha256, HashHighway256} {
+		if HashWithKey(data, hashtype, nil) != Hash(data, hashtype) {
+			t.Errorf("Expected an empty key to result in an unkeyed hash")
+		}
+		if HashWithKey(data, hashtype, key1) == Hash(data, hashtype) {
+			t.Errorf("Expected keyed hash to differ from unkeyed hash")
+		}
+		if HashWithKey(data, hashtype, key1) == HashWithKey(data, hashtype, key2) {
+			t.Errorf("Expected hashes with different keys to differ")
+		}
+		if HashWithKey(data, hashtype, key1) != HashWithKey(data, hashtype, key1) {
+			t.Errorf("Expected hashes with the same key to match")
+		}
+	}
+}
+
+func TestChunkHashMigration(t *testing.T) {
+	testPassword := "this_is_a_password"
+
+	dir, err := ioutil.TempDir("", "knoxite")
+	if err != nil {
+		t.Errorf("Failed creating temporary dir for repository: %s", err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	// pretend this is a version 8 repository, which hashes chunks without a
+	// key
+	r, _ := NewRepository(dir, testPassword)
+	r.Version = 8
+	r.HashKey = nil
+	r.Chunker = legacyChunkerConfig()
+	vol, _ := NewVolume("test", "")
+	_ = r.AddVolume(vol)
+	index, _ := OpenChunkIndex(&r)
+	wd, _ := os.Getwd()
+
+	snapshot, _ := NewSnapshot("test_snapshot")
+	opts := StoreOptions{
+		CWD:         wd,
+		Paths:       []string{"hash.go"},
+		Excludes:    []string{},
+		Compress:    CompressionNone,
+		Encrypt:     EncryptionAESGCM,
+		DataParts:   1,
+		ParityParts: 0,
+	}
+	progress := snapshot.Add(r, &index, opts)
+	for p := range progress {
+		if p.Error != nil {
+			t.Errorf("Failed adding to snapshot: %s", p.Error)
+		}
+	}
+	_ = snapshot.Save(&r)
+	_ = vol.AddSnapshot(snapshot.ID)
+	_ = index.Save(&r)
+	_ = r.Save()
+
+	var packs []string
+	_ = filepath.Walk(filepath.Join(dir, "packs"), func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			packs = append(packs, path)
+		}
+		return nil
+	})
+	unkeyed := snapshot.Archives["hash.go"].Chunks
+
+	// a migration interrupted before the repository got saved gets repeated
+	hashKey, _ := deriveHashKey(r.Key)
+	if err = r.migrateChunkHashes(hashKey); err != nil {
+		t.Errorf("Failed migrating chunk hashes: %s", err)
+		return
+	}
+
+	r, err = OpenRepository(dir, testPassword)
+	if err != nil {
+		t.Errorf("Failed opening repository: %s", err)
+		return
+	}
+	_, snapshot, err = r.FindSnapshot(snapshot.ID)
+	if err != nil {
+		t.Errorf("Failed finding snapshot after migration: %s", err)
+		return
+	}
+
+	archive := snapshot.Archives["hash.go"]
+	for i, chunk := range archive.Chunks {
+		if chunk.Hash == unkeyed[i].Hash || chunk.DecryptedHash == unkeyed[i].DecryptedHash {
+			t.Errorf("Expected chunk %d to be rehashed", i)
+		}
+	}
+	b, _, err := DecodeArchiveData(r, *archive)
+	expected, _ := ioutil.ReadFile("hash.go")
+	if err != nil || !bytes.Equal(b, expected) {
+		t.Errorf("Failed restoring rehashed file: %v", err)
+	}
+
+	// the former packs and index segments are gone
+	if len(packs) == 0 {
+		t.Errorf("Expected chunks to be stored in packs")
+	}
+	for _, path := range packs {
+		if _, err := os.Stat(path); err == nil {
+			t.Errorf("Expected pack %s to be deleted", path)
+		}
+	}
+	index, err = OpenChunkIndex(&r)
+	if err != nil {
+		t.Errorf("Failed opening chunk-index: %s", err)
+		return
+	}
+	if len(index.segments) != 1 {
+		t.Errorf("Expected 1 index segment after migration, got %d", len(index.segments))
+	}
+	for _, chunk := range unkeyed {
+		if _, ok := index.Chunks[chunk.Hash]; ok {
+			t.Errorf("Expected chunk %s to be removed from the chunk-index", chunk.Hash)
+		}
+	}
+
+	// new data gets deduplicated against the rehashed chunks
+	snapshot, _ = NewSnapshot("test_snapshot")
+	progress = snapshot.Add(r, &index, opts)
+	for p := range progress {
+		if p.Error != nil {
+			t.Errorf("Failed adding to snapshot: %s", p.Error)
+		}
+	}
+	if snapshot.Stats.Deduplicated != archive.Size || snapshot.Stats.New != 0 {
+		t.Errorf("Expected all data to be deduplicated, got %+v", snapshot.Stats)
+	}
+}
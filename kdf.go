@@ -0,0 +1,94 @@
+/*
+ * knoxite
+ *     Copyright (c) 2016-2021, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package knoxite
+
+import (
+	"crypto/rand"
+	"errors"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/scrypt"
+)
+
+// Available key derivation functions.
+const (
+	KDFNone     = iota // the password is used as is
+	KDFArgon2id        // Argon2id
+	KDFScrypt          // scrypt
+)
+
+const (
+	kdfSaltLength = 32
+	kdfKeyLength  = 32
+)
+
+// Error declarations.
+var (
+	ErrUnknownKDF       = errors.New("unknown key derivation function")
+	ErrInvalidKDFParams = errors.New("invalid key derivation parameters")
+)
+
+// KDFParams holds the salt and cost parameters required to derive a key from
+// a password.
+type KDFParams struct {
+	Method uint8  `json:"method"`
+	Salt   []byte `json:"salt,omitempty"`
+
+	// Argon2id parameters
+	Time    uint32 `json:"time,omitempty"`
+	Memory  uint32 `json:"memory,omitempty"` // in KiB
+	Threads uint8  `json:"threads,omitempty"`
+
+	// scrypt parameters
+	N int `json:"n,omitempty"`
+	R int `json:"r,omitempty"`
+	P int `json:"p,omitempty"`
+}
+
+// DefaultKDFParams are the parameters used for newly generated keys.
+var DefaultKDFParams = KDFParams{
+	Method:  KDFArgon2id,
+	Time:    3,
+	Memory:  64 * 1024,
+	Threads: 4,
+}
+
+// NewKDFParams returns a copy of DefaultKDFParams with a fresh random salt.
+func NewKDFParams() (KDFParams, error) {
+	p := DefaultKDFParams
+	p.Salt = make([]byte, kdfSaltLength)
+
+	_, err := rand.Read(p.Salt)
+	return p, err
+}
+
+// DeriveKey derives a key from password.
+func (p KDFParams) DeriveKey(password string) ([]byte, error) {
+	if len(password) == 0 {
+		return nil, ErrInvalidPassword
+	}
+
+	switch p.Method {
+	case KDFNone:
+		return []byte(password), nil
+
+	case KDFArgon2id:
+		if len(p.Salt) == 0 || p.Time == 0 || p.Memory == 0 || p.Threads == 0 {
+			return nil, ErrInvalidKDFParams
+		}
+		return argon2.IDKey([]byte(password), p.Salt, p.Time, p.Memory, p.Threads, kdfKeyLength), nil
+
+	case KDFScrypt:
+		if len(p.Salt) == 0 {
+			return nil, ErrInvalidKDFParams
+		}
+		return scrypt.Key([]byte(password), p.Salt, p.N, p.R, p.P, kdfKeyLength)
+	}
+
+	return nil, ErrUnknownKDF
+}
@@ -0,0 +1,81 @@
+/*
+ * knoxite
+ *     Copyright (c) 2016-2021, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package knoxite
+
+import (
+	"bytes"
+	"testing"
+)
+
+func init() {
+	// keep the tests fast, the parameters are stored alongside every key anyway
+	DefaultKDFParams.Time = 1
+	DefaultKDFParams.Memory = 1024
+	DefaultKDFParams.Threads = 1
+}
+
+func TestKDF(t *testing.T) {
+	testPassword := "this_is_a_password"
+
+	for _, method := range []uint8{KDFArgon2id, KDFScrypt} {
+		p, err := NewKDFParams()
+		if err != nil {
+			t.Fatal(err)
+		}
+		p.Method = method
+		p.N, p.R, p.P = 1024, 8, 1
+
+		k1, err := p.DeriveKey(testPassword)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(k1) != kdfKeyLength {
+			t.Errorf("Expected key of length %d, got %d", kdfKeyLength, len(k1))
+		}
+		k2, err := p.DeriveKey(testPassword)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(k1, k2) {
+			t.Error("Deriving a key twice from the same password resulted in different keys")
+		}
+
+		q, err := NewKDFParams()
+		if err != nil {
+			t.Fatal(err)
+		}
+		q.Method, q.N, q.R, q.P = p.Method, p.N, p.R, p.P
+		k3, err := q.DeriveKey(testPassword)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Equal(k1, k3) {
+			t.Error("Deriving keys with different salts resulted in identical keys")
+		}
+	}
+}
+
+func TestKDFErrors(t *testing.T) {
+	p, err := NewKDFParams()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := p.DeriveKey(""); err != ErrInvalidPassword {
+		t.Errorf("Expected %v, got %v", ErrInvalidPassword, err)
+	}
+
+	p.Method = 255
+	if _, err := p.DeriveKey("password"); err != ErrUnknownKDF {
+		t.Errorf("Expected %v, got %v", ErrUnknownKDF, err)
+	}
+
+	if _, err := (KDFParams{Method: KDFArgon2id}).DeriveKey("password"); err != ErrInvalidKDFParams {
+		t.Errorf("Expected %v, got %v", ErrInvalidKDFParams, err)
+	}
+}
@@ -0,0 +1,88 @@
+/*
+ * knoxite
+ *     Copyright (c) 2016-2021, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package knoxite
+
+import (
+	"errors"
+	"time"
+
+	uuid "github.com/nu7hatch/gouuid"
+)
+
+// Error declarations.
+var (
+	ErrKeySlotNotFound = errors.New("key slot not found")
+	ErrLastKeySlot     = errors.New("can't remove the last key slot of a repository")
+	ErrCurrentKeySlot  = errors.New("can't remove the key slot currently in use")
+)
+
+// A KeySlot grants access to a repository with its own password. All key
+// slots of a repository wrap the same key, which encrypts the repository file.
+type KeySlot struct {
+	ID      string    `json:"id"`
+	Label   string    `json:"label"`
+	Created time.Time `json:"created"`
+	KDF     KDFParams `json:"kdf"`
+	Key     []byte    `json:"key"` // the wrapped repository file key
+}
+
+// newKeySlot returns a key slot, which wraps key with password.
+func newKeySlot(label, password string, key []byte) (KeySlot, error) {
+	slot := KeySlot{
+		Label:   label,
+		Created: time.Now(),
+	}
+
+	u, err := uuid.NewV4()
+	if err != nil {
+		return slot, err
+	}
+	slot.ID = u.String()[:8]
+
+	err = slot.wrap(password, key)
+	return slot, err
+}
+
+// wrap encrypts key with a key derived from password, using a fresh salt and
+// the current default KDF parameters.
+func (slot *KeySlot) wrap(password string, key []byte) error {
+	kdf, err := NewKDFParams()
+	if err != nil {
+		return err
+	}
+	k, err := kdf.DeriveKey(password)
+	if err != nil {
+		return err
+	}
+	e, err := NewEncryptor(EncryptionAESGCM, string(k))
+	if err != nil {
+		return err
+	}
+	b, err := e.Process(key)
+	if err != nil {
+		return err
+	}
+
+	slot.KDF = kdf
+	slot.Key = b
+	return nil
+}
+
+// unwrap returns the key wrapped in this slot, if password matches.
+func (slot *KeySlot) unwrap(password string) ([]byte, error) {
+	k, err := slot.KDF.DeriveKey(password)
+	if err != nil {
+		return nil, err
+	}
+	d, err := NewDecryptor(EncryptionAESGCM, string(k))
+	if err != nil {
+		return nil, err
+	}
+
+	return d.Process(slot.Key)
+}
@@ -0,0 +1,274 @@
+/*
+ * knoxite
+ *     Copyright (c) 2016-2021, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package knoxite
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"time"
+
+	uuid "github.com/nu7hatch/gouuid"
+)
+
+// Const declarations.
+const (
+	// StaleLockTimeout is the duration after which a lock, which hasn't been
+	// refreshed by its process, is considered stale.
+	StaleLockTimeout = 30 * time.Minute
+
+	lockRefreshInterval = 5 * time.Minute
+)
+
+// Error declarations.
+var (
+	ErrRepositoryLocked = errors.New("repository is locked")
+)
+
+// A Lock protects a repository from concurrent modifications. Exclusive locks
+// are required to modify a repository and conflict with any other lock.
+// Shared locks only conflict with exclusive locks.
+type Lock struct {
+	ID        string    `json:"id"`
+	Exclusive bool      `json:"exclusive"`
+	Hostname  string    `json:"hostname"`
+	Username  string    `json:"username"`
+	PID       int       `json:"pid"`
+	Created   time.Time `json:"created"`
+	Refreshed time.Time `json:"refreshed"`
+
+	repository *Repository
+	stop       chan struct{}
+	done       chan struct{}
+}
+
+// newLock returns a new lock for the current process.
+func newLock(exclusive bool) (*Lock, error) {
+	u, err := uuid.NewV4()
+	if err != nil {
+		return nil, err
+	}
+
+	hostname, _ := os.Hostname()
+	var username string
+	if usr, err := user.Current(); err == nil {
+		username = usr.Username
+	}
+
+	now := time.Now()
+	return &Lock{
+		ID:        u.String()[:8],
+		Exclusive: exclusive,
+		Hostname:  hostname,
+		Username:  username,
+		PID:       os.Getpid(),
+		Created:   now,
+		Refreshed: now,
+	}, nil
+}
+
+// String returns a user-friendly description of a lock.
+func (l Lock) String() string {
+	kind := "shared"
+	if l.Exclusive {
+		kind = "exclusive"
+	}
+
+	return fmt.Sprintf("%s lock %s held by %s@%s (PID %d) since %s",
+		kind, l.ID, l.Username, l.Hostname, l.PID, l.Created.Format(time.RFC3339))
+}
+
+// IsStale returns true if the process holding a lock seems to be gone: either
+// the lock hasn't been refreshed in time or it was created on this host by a
+// process which doesn't exist anymore.
+func (l Lock) IsStale() bool {
+	if time.Since(l.Refreshed) > StaleLockTimeout {
+		return true
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil || hostname != l.Hostname {
+		return false
+	}
+	return !processExists(l.PID)
+}
+
+// conflicts returns true if l can't be held at the same time as other.
+func (l Lock) conflicts(other Lock) bool {
+	return l.ID != other.ID && (l.Exclusive || other.Exclusive) && !other.IsStale()
+}
+
+// Unlock releases a lock.
+func (l *Lock) Unlock() error {
+	if l.stop != nil {
+		close(l.stop)
+		<-l.done
+		l.stop = nil
+	}
+
+	return l.repository.backend.DeleteLock(l.ID)
+}
+
+// refresh periodically updates the lock, so other processes don't consider it
+// to be stale.
+func (l *Lock) refresh() {
+	defer close(l.done)
+
+	ticker := time.NewTicker(lockRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+			l.Refreshed = time.Now()
+			_ = l.repository.saveLock(l)
+		}
+	}
+}
+
+// Lock acquires an exclusive or a shared lock on a repository. Once the lock
+// is held, the repository's metadata gets reloaded, as it might have been
+// modified by the previous lock holder. The lock gets refreshed in the
+// background until it is released with Unlock.
+func (r *Repository) Lock(exclusive bool) (*Lock, error) {
+	lock, err := newLock(exclusive)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.checkLocks(lock); err != nil {
+		return nil, err
+	}
+	if err := r.saveLock(lock); err != nil {
+		return nil, err
+	}
+	// another process might have stored a conflicting lock in the meantime
+	if err := r.checkLocks(lock); err != nil {
+		_ = r.backend.DeleteLock(lock.ID)
+		return nil, err
+	}
+	if err := r.reload(); err != nil {
+		_ = r.backend.DeleteLock(lock.ID)
+		return nil, err
+	}
+
+	lock.repository = r
+	lock.stop = make(chan struct{})
+	lock.done = make(chan struct{})
+	go lock.refresh()
+
+	return lock, nil
+}
+
+// Locks returns all locks held on a repository. Locks which can't be decoded
+// get skipped with a warning.
+func (r *Repository) Locks() ([]Lock, error) {
+	locks, _, err := r.loadLocks()
+	return locks, err
+}
+
+// loadLocks returns all decodable locks held on a repository, as well as the
+// IDs of the locks which couldn't be decoded.
+func (r *Repository) loadLocks() ([]Lock, []string, error) {
+	ids, err := r.backend.ListLocks()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pipe, err := NewDecodingPipeline(CompressionNone, r.metadataEncryption(), r.Key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	locks := []Lock{}
+	invalid := []string{}
+	for _, id := range ids {
+		b, err := r.backend.LoadLock(id)
+		if err != nil {
+			// the lock got released in the meantime
+			continue
+		}
+
+		var lock Lock
+		if err := pipe.Decode(b, &lock); err != nil {
+			log.Warnf("skipping undecodable lock %s: %v", id, err)
+			invalid = append(invalid, id)
+			continue
+		}
+		locks = append(locks, lock)
+	}
+
+	return locks, invalid, nil
+}
+
+// RemoveLocks removes all stale locks from a repository. If all is true, all
+// locks get removed, whether their processes are still alive or not. This
+// includes locks which can't be decoded. It returns the decodable locks which
+// have been removed.
+func (r *Repository) RemoveLocks(all bool) ([]Lock, error) {
+	locks, invalid, err := r.loadLocks()
+	if err != nil {
+		return nil, err
+	}
+
+	removed := []Lock{}
+	for _, lock := range locks {
+		if !all && !lock.IsStale() {
+			continue
+		}
+		if err := r.backend.DeleteLock(lock.ID); err != nil {
+			return removed, err
+		}
+		removed = append(removed, lock)
+	}
+
+	if all {
+		for _, id := range invalid {
+			log.Warnf("removing undecodable lock %s", id)
+			if err := r.backend.DeleteLock(id); err != nil {
+				return removed, err
+			}
+		}
+	}
+
+	return removed, nil
+}
+
+// checkLocks returns an error if any lock conflicting with lock is held on
+// the repository.
+func (r *Repository) checkLocks(lock *Lock) error {
+	locks, err := r.Locks()
+	if err != nil {
+		return err
+	}
+
+	for _, l := range locks {
+		if lock.conflicts(l) {
+			return fmt.Errorf("%w: %s", ErrRepositoryLocked, l)
+		}
+	}
+
+	return nil
+}
+
+// saveLock writes a lock to the repository.
+func (r *Repository) saveLock(lock *Lock) error {
+	pipe, err := NewEncodingPipeline(CompressionNone, r.metadataEncryption(), r.Key)
+	if err != nil {
+		return err
+	}
+	b, err := pipe.Encode(lock)
+	if err != nil {
+		return err
+	}
+
+	return r.backend.SaveLock(lock.ID, b)
+}
@@ -0,0 +1,140 @@
+/*
+ * knoxite
+ *     Copyright (c) 2016-2021, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package knoxite
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestRepositoryLock(t *testing.T) {
+	testPassword := "this_is_a_password"
+
+	dir, err := ioutil.TempDir("", "knoxite")
+	if err != nil {
+		t.Errorf("Failed creating temporary dir for repository: %s", err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	r, err := NewRepository(dir, testPassword)
+	if err != nil {
+		t.Errorf("Failed creating repository: %s", err)
+		return
+	}
+	r2, err := OpenRepository(dir, testPassword)
+	if err != nil {
+		t.Errorf("Failed opening repository: %s", err)
+		return
+	}
+
+	exclusive, err := r.Lock(true)
+	if err != nil {
+		t.Errorf("Failed locking repository: %s", err)
+		return
+	}
+	if _, err = r2.Lock(false); !errors.Is(err, ErrRepositoryLocked) {
+		t.Errorf("Expected %v, got %v", ErrRepositoryLocked, err)
+	}
+	if _, err = r2.Lock(true); !errors.Is(err, ErrRepositoryLocked) {
+		t.Errorf("Expected %v, got %v", ErrRepositoryLocked, err)
+	}
+
+	// modify the repository while holding the lock
+	vol, _ := NewVolume("test", "")
+	_ = r.AddVolume(vol)
+	if err = r.Save(); err != nil {
+		t.Errorf("Failed saving repository: %s", err)
+	}
+	if err = exclusive.Unlock(); err != nil {
+		t.Errorf("Failed unlocking repository: %s", err)
+	}
+
+	// shared locks don't conflict with each other
+	shared, err := r2.Lock(false)
+	if err != nil {
+		t.Errorf("Failed locking repository: %s", err)
+		return
+	}
+	if len(r2.Volumes) != 1 {
+		t.Errorf("Expected repository to be reloaded after locking it, got %d volumes", len(r2.Volumes))
+	}
+	shared2, err := r.Lock(false)
+	if err != nil {
+		t.Errorf("Failed locking repository: %s", err)
+		return
+	}
+	if _, err = r.Lock(true); !errors.Is(err, ErrRepositoryLocked) {
+		t.Errorf("Expected %v, got %v", ErrRepositoryLocked, err)
+	}
+	locks, err := r.Locks()
+	if err != nil || len(locks) != 2 {
+		t.Errorf("Expected 2 locks, got %d: %v", len(locks), err)
+	}
+	_ = shared.Unlock()
+	_ = shared2.Unlock()
+
+	// stale locks get ignored
+	stale, _ := newLock(true)
+	stale.Refreshed = time.Now().Add(-2 * StaleLockTimeout)
+	if err = r.saveLock(stale); err != nil {
+		t.Errorf("Failed saving lock: %s", err)
+		return
+	}
+	if !stale.IsStale() {
+		t.Errorf("Expected lock to be stale")
+	}
+	exclusive, err = r.Lock(true)
+	if err != nil {
+		t.Errorf("Failed locking repository with a stale lock: %s", err)
+		return
+	}
+
+	removed, err := r.RemoveLocks(false)
+	if err != nil || len(removed) != 1 || removed[0].ID != stale.ID {
+		t.Errorf("Expected stale lock %s to be removed, got %v: %v", stale.ID, removed, err)
+	}
+	removed, err = r.RemoveLocks(true)
+	if err != nil || len(removed) != 1 || removed[0].ID != exclusive.ID {
+		t.Errorf("Expected lock %s to be removed, got %v: %v", exclusive.ID, removed, err)
+	}
+	if locks, _ = r.Locks(); len(locks) != 0 {
+		t.Errorf("Expected no locks, got %d", len(locks))
+	}
+
+	// undecodable locks get skipped and only removed with all
+	if err = r.backend.SaveLock("corrupt", []byte("garbage")); err != nil {
+		t.Errorf("Failed saving lock: %s", err)
+		return
+	}
+	if locks, err = r.Locks(); err != nil || len(locks) != 0 {
+		t.Errorf("Expected no locks, got %d: %v", len(locks), err)
+	}
+	exclusive, err = r.Lock(true)
+	if err != nil {
+		t.Errorf("Failed locking repository with an undecodable lock: %s", err)
+		return
+	}
+	_ = exclusive.Unlock()
+	if _, err = r.RemoveLocks(false); err != nil {
+		t.Errorf("Failed removing stale locks: %s", err)
+	}
+	if ids, _ := r.backend.ListLocks(); len(ids) != 1 {
+		t.Errorf("Expected undecodable lock to be kept, got %v", ids)
+	}
+	removed, err = r.RemoveLocks(true)
+	if err != nil || len(removed) != 0 {
+		t.Errorf("Expected no decodable locks to be removed, got %v: %v", removed, err)
+	}
+	if ids, _ := r.backend.ListLocks(); len(ids) != 0 {
+		t.Errorf("Expected undecodable lock to be removed, got %v", ids)
+	}
+}
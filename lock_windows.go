@@ -0,0 +1,32 @@
+// +build windows
+
+/*
+ * knoxite
+ *     Copyright (c) 2016-2021, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package knoxite
+
+import "golang.org/x/sys/windows"
+
+// stillActive is the exit code reported for processes which are still running.
+const stillActive = 259
+
+// processExists returns true if a process with this PID is running.
+func processExists(pid int) bool {
+	h, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, uint32(pid))
+	if err != nil {
+		// processes of other users can't be queried, but they're still alive
+		return err == windows.ERROR_ACCESS_DENIED
+	}
+	defer func() { _ = windows.CloseHandle(h) }()
+
+	// handles of exited processes stay valid as long as anyone holds them
+	var code uint32
+	if err := windows.GetExitCodeProcess(h, &code); err != nil {
+		return true
+	}
+	return code == stillActive
+}
@@ -0,0 +1,113 @@
+/*
+ * knoxite
+ *     Copyright (c) 2016-2021, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package knoxite
+
+import (
+	"os/user"
+	"strconv"
+)
+
+// ownerNames looks up the user and group names of ids, caching the results.
+type ownerNames struct {
+	users  map[uint32]string
+	groups map[uint32]string
+}
+
+func newOwnerNames() *ownerNames {
+	return &ownerNames{
+		users:  make(map[uint32]string),
+		groups: make(map[uint32]string),
+	}
+}
+
+// user returns the name of the user with the given id, or an empty string if
+// there is no such user.
+func (n *ownerNames) user(uid uint32) string {
+	name, ok := n.users[uid]
+	if !ok {
+		if u, err := user.LookupId(strconv.FormatUint(uint64(uid), 10)); err == nil {
+			name = u.Username
+		}
+		n.users[uid] = name
+	}
+	return name
+}
+
+// group returns the name of the group with the given id, or an empty string
+// if there is no such group.
+func (n *ownerNames) group(gid uint32) string {
+	name, ok := n.groups[gid]
+	if !ok {
+		if g, err := user.LookupGroupId(strconv.FormatUint(uint64(gid), 10)); err == nil {
+			name = g.Name
+		}
+		n.groups[gid] = name
+	}
+	return name
+}
+
+// ownerIDs maps the user and group names stored in archives to the ids on
+// this system, caching the results. The ids stored in archives get used for
+// unknown names, or if numeric is true.
+type ownerIDs struct {
+	numeric bool
+	users   map[string]int // -1 if unknown
+	groups  map[string]int // -1 if unknown
+}
+
+func newOwnerIDs(numeric bool) *ownerIDs {
+	return &ownerIDs{
+		numeric: numeric,
+		users:   make(map[string]int),
+		groups:  make(map[string]int),
+	}
+}
+
+// uid returns the id of the user owning arc.
+func (o *ownerIDs) uid(arc Archive) int {
+	if o.numeric || arc.User == "" {
+		return int(arc.UID)
+	}
+
+	id, ok := o.users[arc.User]
+	if !ok {
+		id = -1
+		if u, err := user.Lookup(arc.User); err == nil {
+			if uid, err := strconv.Atoi(u.Uid); err == nil {
+				id = uid
+			}
+		}
+		o.users[arc.User] = id
+	}
+	if id < 0 {
+		return int(arc.UID)
+	}
+	return id
+}
+
+// gid returns the id of the group owning arc.
+func (o *ownerIDs) gid(arc Archive) int {
+	if o.numeric || arc.Group == "" {
+		return int(arc.GID)
+	}
+
+	id, ok := o.groups[arc.Group]
+	if !ok {
+		id = -1
+		if g, err := user.LookupGroup(arc.Group); err == nil {
+			if gid, err := strconv.Atoi(g.Gid); err == nil {
+				id = gid
+			}
+		}
+		o.groups[arc.Group] = id
+	}
+	if id < 0 {
+		return int(arc.GID)
+	}
+	return id
+}
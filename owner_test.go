@@ -0,0 +1,50 @@
+/*
+ * knoxite
+ *     Copyright (c) 2016-2021, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package knoxite
+
+import (
+	"os/user"
+	"strconv"
+	"testing"
+)
+
+func TestOwnerIDs(t *testing.T) {
+	u, err := user.Current()
+	if err != nil {
+		t.Skipf("Failed looking up current user: %s", err)
+	}
+	uid, err := strconv.Atoi(u.Uid)
+	if err != nil {
+		t.Skipf("User ids aren't numeric on this platform: %s", u.Uid)
+	}
+
+	tests := []struct {
+		arc      Archive
+		numeric  bool
+		expected int
+	}{
+		// names take precedence over the stored ids
+		{Archive{UID: 12345, User: u.Username}, false, uid},
+		{Archive{UID: 12345, User: u.Username}, true, 12345},
+		// unknown names fall back to the stored ids
+		{Archive{UID: 12345, User: "knoxite-unknown-user"}, false, 12345},
+		{Archive{UID: 12345}, false, 12345},
+	}
+
+	for _, tt := range tests {
+		owners := newOwnerIDs(tt.numeric)
+		if id := owners.uid(tt.arc); id != tt.expected {
+			t.Errorf("Expected uid %d for user %q (numeric: %v), got %d", tt.expected, tt.arc.User, tt.numeric, id)
+		}
+	}
+
+	names := newOwnerNames()
+	if name := names.user(uint32(uid)); name != u.Username {
+		t.Errorf("Expected user name %s, got %s", u.Username, name)
+	}
+}
@@ -0,0 +1,224 @@
+/*
+ * knoxite
+ *     Copyright (c) 2016-2021, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package knoxite
+
+import (
+	"sync"
+)
+
+// DefaultPackSize is the size packs get filled up to before they are stored.
+const DefaultPackSize = 16 * (1 << 20) // 16 MiB
+
+// A PackLocation describes where a chunk part is stored within a pack.
+type PackLocation struct {
+	Pack   string `json:"pack"`
+	Offset uint64 `json:"offset"`
+	Length uint64 `json:"length"`
+}
+
+// packedPart links a chunk part with its location within a pack.
+type packedPart struct {
+	Hash     string
+	Part     uint
+	Location PackLocation
+}
+
+// A packer bundles chunk parts into packs. Every backend gets its own pending
+// pack, which is stored as soon as it reaches the target size. A pack's ID is
+// derived from its content.
+type packer struct {
+	size    uint64
+	pending map[int]*pendingPack
+
+	parts []packedPart      // parts stored in packs since the last flush
+	packs map[string]uint64 // sizes of the packs stored since the last flush
+
+	added    map[string]bool // chunks added to this packer
+	existing map[string]bool // packs which have been checked to exist
+}
+
+type pendingPack struct {
+	data  []byte
+	parts []packedPart
+}
+
+// newPacker returns a packer filling packs up to size bytes.
+func newPacker(size uint64) *packer {
+	if size == 0 {
+		size = DefaultPackSize
+	}
+
+	return &packer{
+		size:     size,
+		pending:  make(map[int]*pendingPack),
+		packs:    make(map[string]uint64),
+		added:    make(map[string]bool),
+		existing: make(map[string]bool),
+	}
+}
+
+// add appends a chunk part to the pending pack of backend be.
+func (p *packer) add(backend *BackendManager, be int, hash string, part uint, data []byte) error {
+	pp, ok := p.pending[be]
+	if !ok {
+		pp = &pendingPack{}
+		p.pending[be] = pp
+	}
+
+	pp.parts = append(pp.parts, packedPart{
+		Hash: hash,
+		Part: part,
+		Location: PackLocation{
+			Offset: uint64(len(pp.data)),
+			Length: uint64(len(data)),
+		},
+	})
+	pp.data = append(pp.data, data...)
+	p.added[hash] = true
+
+	if uint64(len(pp.data)) >= p.size {
+		return p.store(backend, be)
+	}
+	return nil
+}
+
+// store writes the pending pack of backend be.
+func (p *packer) store(backend *BackendManager, be int) error {
+	pp, ok := p.pending[be]
+	if !ok || len(pp.data) == 0 {
+		return nil
+	}
+
+	id := Hash(pp.data, HashSha256)
+	if err := backend.storePack(be, id, pp.data); err != nil {
+		return err
+	}
+
+	for _, part := range pp.parts {
+		part.Location.Pack = id
+		p.parts = append(p.parts, part)
+	}
+	p.packs[id] = uint64(len(pp.data))
+	p.existing[id] = true
+	delete(p.pending, be)
+	return nil
+}
+
+// has returns true if a chunk has been added to this packer before.
+func (p *packer) has(hash string) bool {
+	return p.added[hash]
+}
+
+// packExists returns true if a pack of the given size can be found in the
+// backends. Reading its last byte makes sure the pack has been stored
+// completely. Every pack only gets checked once during the packer's lifetime.
+func (p *packer) packExists(backend *BackendManager, id string, size uint64) bool {
+	if ok, checked := p.existing[id]; checked {
+		return ok
+	}
+	if size == 0 {
+		// packs of unknown size never got recorded as stored
+		return false
+	}
+
+	_, err := backend.LoadPack(PackLocation{Pack: id, Offset: size - 1, Length: 1})
+	p.existing[id] = err == nil
+	return err == nil
+}
+
+// flush stores all pending packs and returns the locations of all parts, as
+// well as the sizes of all packs, which have been stored since the last flush.
+func (p *packer) flush(backend *BackendManager) ([]packedPart, map[string]uint64, error) {
+	for be := range p.pending {
+		if err := p.store(backend, be); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	parts, packs := p.parts, p.packs
+	p.parts = []packedPart{}
+	p.packs = make(map[string]uint64)
+	return parts, packs, nil
+}
+
+// packIndex caches the pack locations of all chunks in a repository. It gets
+// filled lazily from the chunk-index segments.
+type packIndex struct {
+	sync.Mutex
+	segments  map[string]bool
+	locations map[string][]PackLocation
+}
+
+func newPackIndex() *packIndex {
+	return &packIndex{
+		segments:  make(map[string]bool),
+		locations: make(map[string][]PackLocation),
+	}
+}
+
+// add records the locations of freshly packed chunk parts.
+func (pi *packIndex) add(parts []packedPart) {
+	pi.Lock()
+	defer pi.Unlock()
+
+	for _, part := range parts {
+		pi.locations[part.Hash] = setPackLocation(pi.locations[part.Hash], part.Part, part.Location)
+	}
+}
+
+// chunkLocations returns the pack locations of a chunk's parts. Chunks, which
+// have been stored before packs were introduced, don't have any locations.
+// Segments only get listed again for chunks, which haven't been looked up yet.
+func (r *Repository) chunkLocations(hash string) ([]PackLocation, error) {
+	pi := r.packs
+	pi.Lock()
+	defer pi.Unlock()
+
+	if locs, ok := pi.locations[hash]; ok {
+		return locs, nil
+	}
+
+	// only segments which have been written since we last looked need to be
+	// loaded
+	ids, err := r.backend.ListIndexSegments()
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		if pi.segments[id] {
+			continue
+		}
+
+		segment, err := loadIndexSegment(r, id)
+		if err != nil {
+			return nil, err
+		}
+		for h, chunk := range segment.Chunks {
+			if len(pi.locations[h]) == 0 {
+				pi.locations[h] = chunk.Packs
+			}
+		}
+		pi.segments[id] = true
+	}
+
+	// remember chunks without locations too, so legacy chunks don't cause
+	// the segments to be listed over and over again
+	locs := pi.locations[hash]
+	pi.locations[hash] = locs
+	return locs, nil
+}
+
+// setPackLocation stores loc as the location of part.
+func setPackLocation(locs []PackLocation, part uint, loc PackLocation) []PackLocation {
+	for uint(len(locs)) <= part {
+		locs = append(locs, PackLocation{})
+	}
+	locs[part] = loc
+
+	return locs
+}
@@ -43,3 +43,77 @@ func newProgressError(err error) Progress {
 func (p Progress) TransferSpeed() uint64 {
 	return uint64(float64(p.CurrentItemStats.Transferred) / time.Since(p.Timer).Seconds())
 }
+
+// A ProgressReporter gets notified about the progress of an operation, so
+// callers don't have to interpret raw Progress updates themselves.
+type ProgressReporter interface {
+	// ItemStarted gets called when processing an item begins.
+	ItemStarted(p Progress)
+	// ItemProgress gets called for every update of the current item.
+	ItemProgress(p Progress)
+	// ItemFinished gets called with the last update of an item.
+	ItemFinished(p Progress)
+	// Error gets called for every error. The path is empty if the error
+	// doesn't belong to an item.
+	Error(p Progress)
+}
+
+// A ProgressTracker turns a stream of Progress updates into calls of a
+// ProgressReporter.
+type ProgressTracker struct {
+	reporter ProgressReporter
+	current  *Progress
+}
+
+// NewProgressTracker returns a tracker reporting to r.
+func NewProgressTracker(r ProgressReporter) *ProgressTracker {
+	return &ProgressTracker{
+		reporter: r,
+	}
+}
+
+// Update processes a single Progress update.
+func (t *ProgressTracker) Update(p Progress) {
+	if p.Error != nil {
+		t.reporter.Error(p)
+		return
+	}
+
+	if t.current != nil && t.current.Path != p.Path {
+		t.reporter.ItemFinished(*t.current)
+		t.current = nil
+	}
+	if t.current == nil {
+		t.reporter.ItemStarted(p)
+	}
+
+	t.current = &p
+	t.reporter.ItemProgress(p)
+}
+
+// Close finishes the current item. It must be called once all updates have
+// been processed.
+func (t *ProgressTracker) Close() {
+	if t.current != nil {
+		t.reporter.ItemFinished(*t.current)
+		t.current = nil
+	}
+}
+
+// ReportProgress reports all updates of progress to r and returns once the
+// channel has been closed.
+func ReportProgress(progress <-chan Progress, r ProgressReporter) {
+	t := NewProgressTracker(r)
+	for p := range progress {
+		t.Update(p)
+	}
+	t.Close()
+}
+
+// nopProgressReporter discards all progress.
+type nopProgressReporter struct{}
+
+func (nopProgressReporter) ItemStarted(p Progress)  {}
+func (nopProgressReporter) ItemProgress(p Progress) {}
+func (nopProgressReporter) ItemFinished(p Progress) {}
+func (nopProgressReporter) Error(p Progress)        {}
@@ -36,3 +36,40 @@ func TestProgressError(t *testing.T) {
 		t.Errorf("Expected error, got %s", p.Error)
 	}
 }
+
+type testReporter struct {
+	events []string
+}
+
+func (r *testReporter) ItemStarted(p Progress)  { r.events = append(r.events, "start "+p.Path) }
+func (r *testReporter) ItemProgress(p Progress) { r.events = append(r.events, "progress "+p.Path) }
+func (r *testReporter) ItemFinished(p Progress) { r.events = append(r.events, "end "+p.Path) }
+func (r *testReporter) Error(p Progress)        { r.events = append(r.events, "error "+p.Path) }
+
+func TestReportProgress(t *testing.T) {
+	failed := newProgressError(errors.New("testError"))
+	failed.Path = "b"
+
+	ch := make(chan Progress)
+	go func() {
+		defer close(ch)
+		ch <- Progress{Path: "a"}
+		ch <- Progress{Path: "a"}
+		ch <- failed
+		ch <- Progress{Path: "b"}
+	}()
+
+	r := &testReporter{}
+	ReportProgress(ch, r)
+
+	expected := []string{"start a", "progress a", "progress a", "error b", "end a", "start b", "progress b", "end b"}
+	if len(r.events) != len(expected) {
+		t.Fatalf("Expected events %v, got %v", expected, r.events)
+	}
+	for i := range expected {
+		if r.events[i] != expected[i] {
+			t.Errorf("Expected events %v, got %v", expected, r.events)
+			break
+		}
+	}
+}
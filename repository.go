@@ -8,8 +8,10 @@
 package knoxite
 
 import (
+	"bytes"
 	"crypto/rand"
 	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"strings"
@@ -21,16 +23,40 @@ type Repository struct {
 	Volumes []*Volume `json:"volumes"`
 	Paths   []string  `json:"storage"`
 	Key     string    `json:"key"` // key for encrypting data stored with knoxite
+	// PublicKey turns this into a write-only repository: data, snapshots and
+	// the chunk-index get sealed to this key and can only be decrypted with
+	// the matching private key. See SetPublicKey for what stays readable
+	PublicKey string `json:"public_key,omitempty"`
+	// HashKey is derived from Key and keys the hashes identifying chunks, so
+	// they don't reveal anything about their content
+	HashKey []byte `json:"hash_key"`
+	// Chunker holds the secret polynomial and the sizes used to split files
+	// into chunks
+	Chunker ChunkerConfig `json:"chunker"`
 	// Owner   string    `json:"owner"`
 
-	backend  BackendManager
-	password string // password for knoxite repository file
+	backend    BackendManager
+	packs      *packIndex // cached pack locations of all chunks
+	cache      *Cache     // cached decoded chunks, might be nil
+	privateKey string     // private key belonging to PublicKey
+	password   string     // password for knoxite repository file
+	fileKey    []byte     // key for encrypting the knoxite repository file
+	keySlots   []KeySlot  // key slots wrapping fileKey, one per password
+	keySlot    string     // ID of the key slot matching password
+}
+
+// repositoryHeader is stored unencrypted in front of the repository file.
+type repositoryHeader struct {
+	KeySlots []KeySlot `json:"keyslots"`
 }
 
 // Const declarations.
 const (
-	RepositoryVersion   = 4
+	RepositoryVersion   = 11
 	repositoryKeyLength = 32
+
+	// repositoryHeaderMagic prefixes the header of a repository file.
+	repositoryHeaderMagic = "knoxite+keyslots:"
 )
 
 // Error declarations.
@@ -40,6 +66,8 @@ var (
 	ErrVolumeNotFound          = errors.New("volume not found")
 	ErrSnapshotNotFound        = errors.New("snapshot not found")
 	ErrGenerateRandomKeyFailed = errors.New("failed to generate a random encryption key for new repository")
+	ErrRepositoryNotEmpty      = errors.New("the repository already contains snapshots")
+	ErrPrivateKeyMismatch      = errors.New("the private key does not belong to this repository")
 )
 
 // NewRepository returns a new repository.
@@ -54,6 +82,15 @@ func NewRepository(path, password string) (Repository, error) {
 		Version:  RepositoryVersion,
 		password: password,
 		Key:      key,
+		packs:    newPackIndex(),
+	}
+	repository.HashKey, err = deriveHashKey(key)
+	if err != nil {
+		return repository, err
+	}
+	repository.Chunker, err = newChunkerConfig()
+	if err != nil {
+		return repository, err
 	}
 
 	backend, err := BackendFromURL(path)
@@ -66,6 +103,49 @@ func NewRepository(path, password string) (Repository, error) {
 	return repository, err
 }
 
+// unlock finds the key slot matching the repository's password and returns
+// the encrypted repository data following the header.
+func (r *Repository) unlock(b []byte) ([]byte, error) {
+	if !bytes.HasPrefix(b, []byte(repositoryHeaderMagic)) {
+		// files written before repository version 6 have no header and use
+		// the password as is
+		r.fileKey = []byte(r.password)
+		return b, nil
+	}
+
+	var header repositoryHeader
+	b, err := splitRepositoryHeader(b, repositoryHeaderMagic, &header)
+	if err != nil {
+		return b, err
+	}
+
+	r.keySlots = header.KeySlots
+	for _, slot := range r.keySlots {
+		key, err := slot.unwrap(r.password)
+		if err == nil {
+			r.fileKey = key
+			r.keySlot = slot.ID
+			return b, nil
+		}
+	}
+	return b, ErrOpenRepositoryFailed
+}
+
+// splitRepositoryHeader decodes the JSON header following magic into header
+// and returns the remaining data.
+func splitRepositoryHeader(b []byte, magic string, header interface{}) ([]byte, error) {
+	b = b[len(magic):]
+	idx := bytes.IndexByte(b, '\n')
+	if idx < 0 {
+		return b, ErrOpenRepositoryFailed
+	}
+	if err := json.Unmarshal(b[:idx], header); err != nil {
+		return b, ErrOpenRepositoryFailed
+	}
+
+	return b[idx+1:], nil
+}
+
 // generateRandomKey generates a random key with a specific length.
 func generateRandomKey(length int) (string, error) {
 	b := make([]byte, length)
@@ -82,6 +162,7 @@ func generateRandomKey(length int) (string, error) {
 func OpenRepository(path, password string) (Repository, error) {
 	repository := Repository{
 		password: password,
+		packs:    newPackIndex(),
 	}
 
 	backend, err := BackendFromURL(path)
@@ -92,32 +173,90 @@ func OpenRepository(path, password string) (Repository, error) {
 	if err != nil {
 		return repository, err
 	}
-
-	pipe, err := NewDecodingPipeline(CompressionNone, EncryptionAES, password)
+	err = repository.decode(b)
 	if err != nil {
 		return repository, err
 	}
-	err = pipe.Decode(b, &repository)
-	if err != nil {
-		return repository, ErrOpenRepositoryFailed
+
+	for _, url := range repository.Paths {
+		backend, err := BackendFromURL(url)
+		if err != nil {
+			return repository, err
+		}
+		repository.backend.AddBackend(&backend)
 	}
+
 	if repository.Version < RepositoryVersion {
 		// migrate to current version
-		err = repository.Migrate()
+		err = repository.migrateLocked()
 		if err != nil {
 			return repository, err
 		}
 	}
 
-	for _, url := range repository.Paths {
-		backend, err := BackendFromURL(url)
+	return repository, err
+}
+
+// migrateLocked migrates a repository while holding an exclusive lock on it.
+// Acquiring the lock reloads the repository, so if several clients open an
+// outdated repository at the same time, only the first one migrates it.
+func (r *Repository) migrateLocked() error {
+	lock, err := r.Lock(true)
+	if err != nil {
+		return err
+	}
+	if r.Version < RepositoryVersion {
+		err = r.Migrate()
+	}
+
+	if uerr := lock.Unlock(); err == nil {
+		err = uerr
+	}
+	return err
+}
+
+// decode unlocks and decodes the repository file's data.
+func (r *Repository) decode(b []byte) error {
+	b, err := r.unlock(b)
+	if err != nil {
+		return err
+	}
+
+	// repositories older than version 5 were encrypted with legacy AES-CFB
+	for _, encryption := range []uint16{EncryptionAESGCM, EncryptionAES} {
+		pipe, err := NewDecodingPipeline(CompressionNone, encryption, string(r.fileKey))
 		if err != nil {
-			return repository, err
+			return err
+		}
+		if err = pipe.Decode(b, r); err == nil {
+			return nil
 		}
-		repository.backend.AddBackend(&backend)
 	}
 
-	return repository, err
+	return ErrOpenRepositoryFailed
+}
+
+// reload re-reads a repository's metadata from its storage backends.
+func (r *Repository) reload() error {
+	b, err := r.backend.LoadRepository()
+	if err != nil {
+		return err
+	}
+
+	repository := Repository{
+		backend:    r.backend,
+		packs:      r.packs,
+		cache:      r.cache,
+		password:   r.password,
+		privateKey: r.privateKey,
+	}
+	err = repository.decode(b)
+	if err != nil {
+		return err
+	}
+
+	*r = repository
+	return nil
 }
 
 // AddVolume adds a volume to a repository.
@@ -177,7 +316,7 @@ func (r *Repository) FindSnapshot(id string) (*Volume, *Snapshot, error) {
 	} else {
 		for _, volume := range r.Volumes {
 			snapshot, err := volume.LoadSnapshot(id, r)
-			if err == nil {
+			if err != ErrSnapshotNotFound {
 				return volume, snapshot, err
 			}
 		}
@@ -216,7 +355,15 @@ func (r *Repository) init() error {
 func (r *Repository) Save() error {
 	r.Paths = r.backend.Locations()
 
-	pipe, err := NewEncodingPipeline(CompressionNone, EncryptionAES, r.password)
+	if len(r.keySlots) == 0 {
+		// this repository file has never been protected by key slots
+		err := r.initKeySlots()
+		if err != nil {
+			return err
+		}
+	}
+
+	pipe, err := NewEncodingPipeline(CompressionNone, r.metadataEncryption(), string(r.fileKey))
 	if err != nil {
 		return err
 	}
@@ -224,34 +371,530 @@ func (r *Repository) Save() error {
 	if err != nil {
 		return err
 	}
-	return r.backend.SaveRepository(b)
+	header, err := json.Marshal(repositoryHeader{KeySlots: r.keySlots})
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(repositoryHeaderMagic)
+	buf.Write(header)
+	buf.WriteByte('\n')
+	buf.Write(b)
+	return r.backend.SaveRepository(buf.Bytes())
+}
+
+// initKeySlots generates a new random key for the repository file and wraps
+// it in a single key slot for the repository's password.
+func (r *Repository) initKeySlots() error {
+	key := make([]byte, repositoryKeyLength)
+	_, err := rand.Read(key)
+	if err != nil {
+		return ErrGenerateRandomKeyFailed
+	}
+
+	slot, err := newKeySlot("default", r.password, key)
+	if err != nil {
+		return err
+	}
+
+	r.fileKey = key
+	r.keySlots = []KeySlot{slot}
+	r.keySlot = slot.ID
+	return nil
 }
 
-// Changes password of repository.
+// Changes password of repository. Only the key slot matching the current
+// password gets changed.
 func (r *Repository) ChangePassword(newPassword string) error {
 	r.password = newPassword
 
+	for i := range r.keySlots {
+		if r.keySlots[i].ID == r.keySlot {
+			err := r.keySlots[i].wrap(newPassword, r.fileKey)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
 	return r.Save()
 }
 
-// Migrates a repository to the current version, if possible.
+// KeySlots returns all key slots of a repository.
+func (r *Repository) KeySlots() []KeySlot {
+	return r.keySlots
+}
+
+// CurrentKeySlot returns the ID of the key slot the repository was opened with.
+func (r *Repository) CurrentKeySlot() string {
+	return r.keySlot
+}
+
+// AddKeySlot adds a key slot, which allows opening a repository with
+// password.
+func (r *Repository) AddKeySlot(label, password string) (KeySlot, error) {
+	slot, err := newKeySlot(label, password, r.fileKey)
+	if err != nil {
+		return slot, err
+	}
+
+	r.keySlots = append(r.keySlots, slot)
+	return slot, nil
+}
+
+// RemoveKeySlot removes a key slot from a repository. Neither the last key
+// slot nor the one matching the current password can be removed.
+func (r *Repository) RemoveKeySlot(id string) error {
+	for i, slot := range r.keySlots {
+		if slot.ID == id {
+			if len(r.keySlots) == 1 {
+				return ErrLastKeySlot
+			}
+			if slot.ID == r.keySlot {
+				return ErrCurrentKeySlot
+			}
+
+			r.keySlots = append(r.keySlots[:i], r.keySlots[i+1:]...)
+			return nil
+		}
+	}
+
+	return ErrKeySlotNotFound
+}
+
+// Migrates a repository to the current version, if possible. The caller
+// needs to hold an exclusive lock on the repository.
 func (r *Repository) Migrate() error {
-	switch v := r.Version; {
-	case v < 3:
+	if r.Version < 3 {
 		return ErrRepositoryIncompatible
-	case v == 3:
+	}
+
+	if r.Version == 3 {
 		// since the introduction of the repo passwd command there are two keys:
 		// - Key is for encryption of the data and will be stored in encrypted repo file
 		// - password is for the encryption of the repository (which holds Key)
 		// to migrate we need to use the existing repository password as key
-		if r.Key == "" {
-			r.Key = r.password
-			r.Version = 4
+		if r.Key != "" {
+			return ErrRepositoryIncompatible
+		}
+		r.Key = r.password
+		r.Version = 4
+	}
+
+	if r.Version == 4 {
+		// version 5 replaced the unauthenticated AES-CFB encryption of all
+		// metadata with AES-GCM. Data chunks keep their own encryption method
+		// in their archive and stay readable as they are.
+		err := r.migrateMetadataEncryption(EncryptionAES, EncryptionAESGCM)
+		if err != nil {
+			return err
+		}
+		r.Version = 5
+	}
+
+	if r.Version == 5 {
+		// version 6 wraps a random repository file key in a key slot, which
+		// protects it with a key derived from the password by Argon2id. Save
+		// takes care of creating the initial key slot.
+		r.Version = 6
+	}
+
+	if r.Version == 6 {
+		// version 7 split the chunk-index into index segments. The old
+		// chunk-index gets converted into the initial segment.
+		err := r.migrateChunkIndex()
+		if err != nil {
+			return err
+		}
+		r.Version = 7
+	}
+
+	if r.Version == 7 {
+		// version 8 bundles chunks into packs. Chunks stored on their own
+		// stay where they are, until they get removed by a pack operation.
+		r.Version = 8
+	}
+
+	if r.Version == 8 {
+		// version 9 keys the hashes identifying chunks with a key derived
+		// from Key, so they don't reveal whether known data is stored. All
+		// chunks get stored again under their keyed hashes.
+		hashKey, err := deriveHashKey(r.Key)
+		if err != nil {
+			return err
+		}
+		err = r.migrateChunkHashes(hashKey)
+		if err != nil {
+			return err
+		}
+		r.HashKey = hashKey
+		r.Version = 9
+	}
+
+	if r.Version == 9 {
+		// version 10 lets every repository have its own secret chunker
+		// polynomial and chunk sizes. Existing repositories keep using the
+		// formerly hardcoded ones, so their chunks still get deduplicated.
+		r.Chunker = legacyChunkerConfig()
+		r.Version = 10
+	}
+
+	if r.Version == 10 {
+		// version 11 skips storing chunks which only contain zeros. Such
+		// sparse chunks carry no hash, so older versions of knoxite must not
+		// try to restore them.
+		r.Version = 11
+	}
+
+	if r.Version != RepositoryVersion {
+		return ErrRepositoryIncompatible
+	}
+
+	return r.Save()
+}
 
-			return r.Save()
+// migrateChunkIndex converts a monolithic chunk-index into the initial index
+// segment and deletes it afterwards. Repositories which already contain index
+// segments only get the chunk-index deleted, so an interrupted migration can
+// safely be resumed.
+func (r *Repository) migrateChunkIndex() error {
+	b, err := r.backend.LoadChunkIndex()
+	if err != nil {
+		// there's no chunk-index yet, it will be rebuilt when needed
+		return nil
+	}
+
+	ids, err := r.backend.ListIndexSegments()
+	if err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		var index ChunkIndex
+		pipe, err := NewDecodingPipeline(CompressionLZMA, r.metadataEncryption(), r.Key)
+		if err != nil {
+			return err
+		}
+		if err := pipe.Decode(b, &index); err != nil {
+			return err
+		}
+
+		_, err = saveIndexSegment(r, indexSegment{
+			Chunks:           index.Chunks,
+			RemovedSnapshots: []string{},
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return r.backend.DeleteChunkIndex()
+}
+
+// migrateChunkHashes stores all chunks referenced by snapshots again, under
+// hashes keyed with hashKey, and updates the snapshots and the chunk-index to
+// refer to them. The former chunks, packs and index segments get deleted
+// afterwards.
+//
+// Snapshots only get rewritten once all chunks have been stored and indexed
+// again. If the migration gets interrupted, snapshots which already refer to
+// keyed hashes simply get migrated once more.
+func (r *Repository) migrateChunkHashes(hashKey []byte) error {
+	old, err := OpenChunkIndex(r)
+	if err != nil {
+		return err
+	}
+
+	keyed := *r
+	keyed.HashKey = hashKey
+	keyed.backend.packer = newPacker(DefaultPackSize)
+
+	index := newChunkIndex()
+	rehashed := make(map[string]Chunk) // keyed chunks by their former hash
+	for _, volume := range r.Volumes {
+		for _, id := range volume.Snapshots {
+			snapshot, err := volume.LoadSnapshot(id, r)
+			if err != nil {
+				return err
+			}
+
+			for _, archive := range snapshot.Archives {
+				for i, chunk := range archive.Chunks {
+					if chunk.Sparse {
+						continue
+					}
+
+					c, ok := rehashed[chunk.Hash]
+					if !ok {
+						c, err = keyed.rehashChunk(r, *archive, chunk)
+						if err != nil {
+							return err
+						}
+						rehashed[chunk.Hash] = c
+					}
+					c.Num = chunk.Num
+					archive.Chunks[i] = c
+				}
+				index.AddArchive(archive, snapshot.ID)
+			}
+		}
+	}
+
+	parts, packs, err := keyed.backend.packer.flush(&keyed.backend)
+	if err != nil {
+		return err
+	}
+	index.addPacked(parts, packs)
+	r.packs.add(parts)
+	err = index.Save(&keyed)
+	if err != nil {
+		return err
+	}
+
+	for _, volume := range r.Volumes {
+		for _, id := range volume.Snapshots {
+			snapshot, err := volume.LoadSnapshot(id, r)
+			if err != nil {
+				return err
+			}
+
+			for _, archive := range snapshot.Archives {
+				for i, chunk := range archive.Chunks {
+					if c, ok := rehashed[chunk.Hash]; ok {
+						c.Num = chunk.Num
+						archive.Chunks[i] = c
+					}
+				}
+			}
+			err = snapshot.Save(r)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	// the former chunks aren't referenced by any snapshot anymore
+	for _, id := range old.segments {
+		if containsString(index.segments, id) {
+			continue
+		}
+		err = r.backend.DeleteIndexSegment(id)
+		if err != nil {
+			return err
+		}
+	}
+	for pid := range old.PackSizes {
+		if _, ok := index.PackSizes[pid]; ok {
+			continue
+		}
+		err = r.backend.DeletePack(pid)
+		if err != nil {
+			return err
+		}
+	}
+	for _, chunk := range old.Chunks {
+		for part := uint(0); part < chunk.DataParts+chunk.ParityParts; part++ {
+			if part < uint(len(chunk.Packs)) && chunk.Packs[part].Pack != "" {
+				continue
+			}
+			// parts which got lost already don't need to be deleted
+			_ = r.backend.DeleteChunk(chunk.Hash, part, chunk.DataParts)
+		}
+	}
+
+	return nil
+}
+
+// rehashChunk loads a chunk of legacy and stores it again with the keyed
+// hashes of r. Chunks which already carry keyed hashes get stored under the
+// same hash once more.
+func (r *Repository) rehashChunk(legacy *Repository, archive Archive, chunk Chunk) (Chunk, error) {
+	b, err := fetchChunk(*legacy, archive, chunk)
+	if _, ok := err.(*CheckSumError); ok {
+		b, err = fetchChunk(*r, archive, chunk)
+	}
+	if err != nil {
+		return Chunk{}, err
+	}
+
+	pipe, err := NewEncodingPipeline(archive.Compressed, archive.Encrypted, r.encryptionKey(archive.Encrypted))
+	if err != nil {
+		return Chunk{}, err
+	}
+	opts := StoreOptions{
+		Compress:    archive.Compressed,
+		Encrypt:     archive.Encrypted,
+		DataParts:   chunk.DataParts,
+		ParityParts: chunk.ParityParts,
+	}
+	c, err := encodeChunk(r, &pipe, opts, b, chunk.Num)
+	if err != nil {
+		return Chunk{}, err
+	}
+	_, err = r.backend.StoreChunk(c)
+	if err != nil {
+		return Chunk{}, err
+	}
+
+	c.Data = nil
+	c.Packed = true
+	return c, nil
+}
+
+// migrateMetadataEncryption re-encrypts all snapshots and the chunk-index.
+// Items which are already encrypted with the new method get skipped, so an
+// interrupted migration can safely be resumed.
+func (r *Repository) migrateMetadataEncryption(from, to uint16) error {
+	oldPipe, err := NewDecodingPipeline(CompressionLZMA, from, r.Key)
+	if err != nil {
+		return err
+	}
+	checkPipe, err := NewDecodingPipeline(CompressionLZMA, to, r.Key)
+	if err != nil {
+		return err
+	}
+	newPipe, err := NewEncodingPipeline(CompressionLZMA, to, r.Key)
+	if err != nil {
+		return err
+	}
+
+	reencrypt := func(b []byte) ([]byte, error) {
+		if _, err := checkPipe.Process(b); err == nil {
+			return nil, nil
 		}
+		b, err := oldPipe.Process(b)
+		if err != nil {
+			return nil, err
+		}
+		return newPipe.Process(b)
+	}
+
+	for _, volume := range r.Volumes {
+		for _, id := range volume.Snapshots {
+			b, err := r.backend.LoadSnapshot(id)
+			if err != nil {
+				return err
+			}
+			b, err = reencrypt(b)
+			if err != nil {
+				return err
+			}
+			if b == nil {
+				continue
+			}
+			err = r.backend.SaveSnapshot(id, b)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	b, err := r.backend.LoadChunkIndex()
+	if err != nil {
+		// there's no chunk-index yet, it will be re-indexed when needed
+		return nil
+	}
+	b, err = reencrypt(b)
+	if err != nil || b == nil {
+		return err
+	}
+	return r.backend.SaveChunkIndex(b)
+}
+
+// SetPublicKey turns an empty repository into a write-only repository: all
+// snapshots and data chunks get sealed to publicKey. Storing data only
+// requires the public key, reading it requires the private key.
+//
+// The chunk-index gets sealed too, so hosts without the private key only see
+// the chunks they stored themselves and don't deduplicate against data stored
+// by others. They still unlock the repository with its password, so they keep
+// its symmetric secrets: Key encrypts the repository file and locks, while
+// HashKey and the chunker polynomial determine the chunks' hashes. With them a
+// compromised host can read the volumes, i.e. the IDs of all snapshots, and
+// confirm whether a known file is stored, by chunking and hashing it.
+func (r *Repository) SetPublicKey(publicKey string) error {
+	if !r.IsEmpty() {
+		return ErrRepositoryNotEmpty
+	}
+	if _, err := parseX25519Key(publicKey); err != nil {
+		return err
+	}
+
+	r.PublicKey = publicKey
+	return nil
+}
+
+// SetChunkSizes changes the minimum, average and maximum size of chunks in an
+// empty repository. The average size must be a power of two.
+func (r *Repository) SetChunkSizes(min, avg, max uint) error {
+	if !r.IsEmpty() {
+		return ErrRepositoryNotEmpty
+	}
+	if !validChunkSizes(min, avg, max) {
+		return ErrInvalidChunkSizes
+	}
+
+	r.Chunker.MinSize = min
+	r.Chunker.AvgSize = avg
+	r.Chunker.MaxSize = max
+	return nil
+}
+
+// SetPrivateKey sets the private key required to decrypt the data of a
+// write-only repository.
+func (r *Repository) SetPrivateKey(privateKey string) error {
+	pub, err := X25519PublicKey(privateKey)
+	if err != nil {
+		return err
+	}
+	if pub != r.PublicKey {
+		return ErrPrivateKeyMismatch
+	}
+
+	r.privateKey = privateKey
+	return nil
+}
+
+// encryptionKey returns the key to encrypt data with method.
+func (r *Repository) encryptionKey(method uint16) string {
+	if method == EncryptionX25519 {
+		return r.PublicKey
+	}
+	return r.Key
+}
+
+// decryptionKey returns the key to decrypt data encrypted with method.
+func (r *Repository) decryptionKey(method uint16) string {
+	if method == EncryptionX25519 {
+		return r.privateKey
+	}
+	return r.Key
+}
+
+// sealedEncryption returns the encryption method used for snapshots and index
+// segments, which write-only repositories seal to their public key.
+func (r *Repository) sealedEncryption() uint16 {
+	if r.PublicKey != "" {
+		return EncryptionX25519
+	}
+	return r.metadataEncryption()
+}
+
+// sealed returns true if this host can't read the sealed metadata of a
+// write-only repository, as it lacks the private key.
+func (r *Repository) sealed() bool {
+	return r.PublicKey != "" && r.privateKey == ""
+}
+
+// metadataEncryption returns the encryption method used for the repository's
+// metadata, i.e. the repository itself, its snapshots and the chunk-index.
+// Write-only repositories seal their snapshots and index segments with
+// sealedEncryption instead.
+func (r *Repository) metadataEncryption() uint16 {
+	if r.Version < 5 {
+		return EncryptionAES
 	}
-	return ErrRepositoryIncompatible
+	return EncryptionAESGCM
 }
 
 func (r *Repository) ChangeLocation(oldLocation, newLocation string) error {
@@ -292,7 +935,7 @@ func (r *Repository) ChangeLocation(oldLocation, newLocation string) error {
 	r.backend.Backends = append(r.backend.Backends, &b)
 
 	// Save Repository
-	fmt.Println("Saving Repository")
+	log.Debug("Saving Repository")
 	err = r.Save()
 	if err != nil {
 		return err
@@ -8,9 +8,13 @@
 package knoxite
 
 import (
+	"bytes"
+	"errors"
 	"io/ioutil"
 	"os"
 	"testing"
+
+	"github.com/restic/chunker"
 )
 
 func TestRepositoryCreate(t *testing.T) {
@@ -29,11 +33,15 @@ func TestRepositoryCreate(t *testing.T) {
 		return
 	}
 
-	_, err = OpenRepository(dir, testPassword)
+	r, err := OpenRepository(dir, testPassword)
 	if err != nil {
 		t.Errorf("Failed opening repository: %s", err)
 		return
 	}
+	slots := r.KeySlots()
+	if len(slots) != 1 || slots[0].KDF.Method != KDFArgon2id || len(slots[0].KDF.Salt) == 0 {
+		t.Errorf("Repository file is not protected by a key derivation function")
+	}
 }
 
 func TestRepositoryCreateError(t *testing.T) {
@@ -97,10 +105,14 @@ func TestRepositoryChangePassword(t *testing.T) {
 		return
 	}
 
+	salt := repo.KeySlots()[0].KDF.Salt
 	if repo.ChangePassword(newPassword) != nil {
 		t.Errorf("Failed to change repository password: %s", err)
 		return
 	}
+	if bytes.Equal(salt, repo.KeySlots()[0].KDF.Salt) {
+		t.Errorf("Changing the password did not generate a new salt")
+	}
 
 	_, err = OpenRepository(dir, testPassword)
 	if err == nil {
@@ -115,3 +127,377 @@ func TestRepositoryChangePassword(t *testing.T) {
 	}
 
 }
+
+func TestRepositoryMigrate(t *testing.T) {
+	testPassword := "this_is_a_password"
+
+	dir, err := ioutil.TempDir("", "knoxite")
+	if err != nil {
+		t.Errorf("Failed creating temporary dir for repository: %s", err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	r, err := NewRepository(dir, testPassword)
+	if err != nil {
+		t.Errorf("Failed creating repository: %s", err)
+		return
+	}
+
+	// pretend this is a version 4 repository, encrypted with AES-CFB
+	r.Version = 4
+	r.HashKey = nil
+	r.Chunker = ChunkerConfig{}
+	vol, _ := NewVolume("test", "")
+	_ = r.AddVolume(vol)
+	snapshot, _ := NewSnapshot("test_snapshot")
+	if err = snapshot.Save(&r); err != nil {
+		t.Errorf("Failed saving snapshot: %s", err)
+		return
+	}
+	_ = vol.AddSnapshot(snapshot.ID)
+	if err = r.Save(); err != nil {
+		t.Errorf("Failed saving repository: %s", err)
+		return
+	}
+
+	// repositories only get migrated while no one else is using them
+	lock, err := r.Lock(false)
+	if err != nil {
+		t.Errorf("Failed locking repository: %s", err)
+		return
+	}
+	if _, err = OpenRepository(dir, testPassword); !errors.Is(err, ErrRepositoryLocked) {
+		t.Errorf("Expected %v, got %v", ErrRepositoryLocked, err)
+	}
+	if err = lock.Unlock(); err != nil {
+		t.Errorf("Failed unlocking repository: %s", err)
+	}
+
+	r, err = OpenRepository(dir, testPassword)
+	if err != nil {
+		t.Errorf("Failed opening repository: %s", err)
+		return
+	}
+	if r.Version != RepositoryVersion {
+		t.Errorf("Expected repository version %d after migration, got %d", RepositoryVersion, r.Version)
+	}
+	if r.metadataEncryption() != EncryptionAESGCM {
+		t.Errorf("Expected metadata to be encrypted with AES-GCM after migration")
+	}
+	if len(r.HashKey) != hashKeyLength {
+		t.Errorf("Expected a hash key after migration, got %d bytes", len(r.HashKey))
+	}
+	if r.Chunker != legacyChunkerConfig() {
+		t.Errorf("Expected the legacy chunker config after migration, got %+v", r.Chunker)
+	}
+
+	_, s, err := r.FindSnapshot(snapshot.ID)
+	if err != nil {
+		t.Errorf("Failed finding snapshot after migration: %s", err)
+		return
+	}
+	if s.Description != snapshot.Description {
+		t.Errorf("Description mismatch, got %s expected %s", s.Description, snapshot.Description)
+	}
+}
+
+func TestRepositoryKeySlots(t *testing.T) {
+	testPassword := "this_is_a_password"
+	otherPassword := "this_is_another_password"
+
+	dir, err := ioutil.TempDir("", "knoxite")
+	if err != nil {
+		t.Errorf("Failed creating temporary dir for repository: %s", err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	r, err := NewRepository(dir, testPassword)
+	if err != nil {
+		t.Errorf("Failed creating repository: %s", err)
+		return
+	}
+	initialSlot := r.CurrentKeySlot()
+
+	if err = r.RemoveKeySlot(initialSlot); err != ErrLastKeySlot {
+		t.Errorf("Expected %v, got %v", ErrLastKeySlot, err)
+	}
+	if err = r.RemoveKeySlot("invalidID"); err != ErrKeySlotNotFound {
+		t.Errorf("Expected %v, got %v", ErrKeySlotNotFound, err)
+	}
+
+	slot, err := r.AddKeySlot("colleague", otherPassword)
+	if err != nil {
+		t.Errorf("Failed adding key slot: %s", err)
+		return
+	}
+	if err = r.Save(); err != nil {
+		t.Errorf("Failed saving repository: %s", err)
+		return
+	}
+
+	r, err = OpenRepository(dir, otherPassword)
+	if err != nil {
+		t.Errorf("Failed opening repository with the added key slot: %s", err)
+		return
+	}
+	if r.CurrentKeySlot() != slot.ID {
+		t.Errorf("Expected key slot %s to be used, got %s", slot.ID, r.CurrentKeySlot())
+	}
+	if len(r.KeySlots()) != 2 {
+		t.Errorf("Expected 2 key slots, got %d", len(r.KeySlots()))
+	}
+	if r.KeySlots()[1].Label != "colleague" {
+		t.Errorf("Label mismatch, got %s expected %s", r.KeySlots()[1].Label, "colleague")
+	}
+
+	if err = r.RemoveKeySlot(slot.ID); err != ErrCurrentKeySlot {
+		t.Errorf("Expected %v, got %v", ErrCurrentKeySlot, err)
+	}
+	if err = r.RemoveKeySlot(initialSlot); err != nil {
+		t.Errorf("Failed removing key slot: %s", err)
+		return
+	}
+	if err = r.Save(); err != nil {
+		t.Errorf("Failed saving repository: %s", err)
+		return
+	}
+
+	if _, err = OpenRepository(dir, testPassword); err != ErrOpenRepositoryFailed {
+		t.Errorf("Expected %v, got %v", ErrOpenRepositoryFailed, err)
+	}
+	if _, err = OpenRepository(dir, otherPassword); err != nil {
+		t.Errorf("Failed opening repository: %s", err)
+	}
+}
+
+func TestRepositoryPublicKey(t *testing.T) {
+	testPassword := "this_is_a_password"
+
+	dir, err := ioutil.TempDir("", "knoxite")
+	if err != nil {
+		t.Errorf("Failed creating temporary dir for repository: %s", err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	pub, priv, err := GenerateX25519KeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewRepository(dir, testPassword)
+	if err != nil {
+		t.Errorf("Failed creating repository: %s", err)
+		return
+	}
+	if err = r.SetPublicKey(pub); err != nil {
+		t.Errorf("Failed setting public key: %s", err)
+		return
+	}
+	vol, _ := NewVolume("test", "")
+	_ = r.AddVolume(vol)
+
+	// store a snapshot with nothing but the public key
+	index, err := OpenChunkIndex(&r)
+	if err != nil {
+		t.Errorf("Failed opening chunk-index: %s", err)
+		return
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Errorf("Failed getting working dir: %s", err)
+		return
+	}
+	snapshot, _ := NewSnapshot("test_snapshot")
+	progress := snapshot.Add(r, &index, StoreOptions{
+		CWD:       wd,
+		Paths:     []string{"repository.go"},
+		Encrypt:   EncryptionAESGCM,
+		DataParts: 1,
+	})
+	for p := range progress {
+		if p.Error != nil {
+			t.Errorf("Failed adding to snapshot: %s", p.Error)
+		}
+	}
+	if snapshot.Archives["repository.go"].Encrypted != EncryptionX25519 {
+		t.Errorf("Expected data to be sealed to the public key")
+	}
+	if err = snapshot.Save(&r); err != nil {
+		t.Errorf("Failed saving snapshot: %s", err)
+		return
+	}
+	_ = vol.AddSnapshot(snapshot.ID)
+	if err = index.Save(&r); err != nil {
+		t.Errorf("Failed saving chunk-index: %s", err)
+		return
+	}
+	if err = r.Save(); err != nil {
+		t.Errorf("Failed saving repository: %s", err)
+		return
+	}
+
+	if err = r.SetPublicKey(pub); err != ErrRepositoryNotEmpty {
+		t.Errorf("Expected %v, got %v", ErrRepositoryNotEmpty, err)
+	}
+
+	r, err = OpenRepository(dir, testPassword)
+	if err != nil {
+		t.Errorf("Failed opening repository: %s", err)
+		return
+	}
+	// the chunk-index is sealed as well
+	index, err = OpenChunkIndex(&r)
+	if err != nil {
+		t.Errorf("Failed opening chunk-index without private key: %s", err)
+	}
+	if len(index.Chunks) != 0 {
+		t.Errorf("Expected an empty chunk-index without private key, got %d chunks", len(index.Chunks))
+	}
+	if _, err = index.Pack(&r); err != ErrPrivateKeyRequired {
+		t.Errorf("Expected %v, got %v", ErrPrivateKeyRequired, err)
+	}
+	if _, _, err = r.FindSnapshot(snapshot.ID); err != ErrPrivateKeyRequired {
+		t.Errorf("Expected %v, got %v", ErrPrivateKeyRequired, err)
+	}
+
+	_, otherPriv, _ := GenerateX25519KeyPair()
+	if err = r.SetPrivateKey(otherPriv); err != ErrPrivateKeyMismatch {
+		t.Errorf("Expected %v, got %v", ErrPrivateKeyMismatch, err)
+	}
+	if err = r.SetPrivateKey(priv); err != nil {
+		t.Errorf("Failed setting private key: %s", err)
+		return
+	}
+	index, err = OpenChunkIndex(&r)
+	if err != nil {
+		t.Errorf("Failed opening chunk-index: %s", err)
+		return
+	}
+	for _, chunk := range snapshot.Archives["repository.go"].Chunks {
+		if _, ok := index.Chunks[chunk.Hash]; !ok {
+			t.Errorf("Expected chunk %s in chunk-index", chunk.Hash)
+		}
+	}
+	_, s, err := r.FindSnapshot(snapshot.ID)
+	if err != nil {
+		t.Errorf("Failed finding snapshot: %s", err)
+		return
+	}
+	b, _, err := DecodeArchiveData(r, *s.Archives["repository.go"])
+	if err != nil {
+		t.Errorf("Failed decoding archive: %s", err)
+		return
+	}
+	orig, _ := ioutil.ReadFile("repository.go")
+	if !bytes.Equal(b, orig) {
+		t.Errorf("Data mismatch after decoding archive")
+	}
+}
+
+func TestRepositoryChunker(t *testing.T) {
+	testPassword := "this_is_a_password"
+
+	dir, err := ioutil.TempDir("", "knoxite")
+	if err != nil {
+		t.Errorf("Failed creating temporary dir for repository: %s", err)
+		return
+	}
+	defer os.RemoveAll(dir)
+	dir2, err := ioutil.TempDir("", "knoxite")
+	if err != nil {
+		t.Errorf("Failed creating temporary dir for repository: %s", err)
+		return
+	}
+	defer os.RemoveAll(dir2)
+
+	r, err := NewRepository(dir, testPassword)
+	if err != nil {
+		t.Errorf("Failed creating repository: %s", err)
+		return
+	}
+	r2, err := NewRepository(dir2, testPassword)
+	if err != nil {
+		t.Errorf("Failed creating repository: %s", err)
+		return
+	}
+
+	// every repository gets its own secret polynomial
+	if !chunker.Pol(r.Chunker.Polynomial).Irreducible() {
+		t.Errorf("Expected an irreducible polynomial, got %x", r.Chunker.Polynomial)
+	}
+	if r.Chunker.Polynomial == r2.Chunker.Polynomial || r.Chunker.Polynomial == legacyChunkerPolynomial {
+		t.Errorf("Expected a random polynomial, got %x", r.Chunker.Polynomial)
+	}
+
+	if err = r.SetChunkSizes(64<<10, 100<<10, 1<<20); err != ErrInvalidChunkSizes {
+		t.Errorf("Expected %v, got %v", ErrInvalidChunkSizes, err)
+	}
+	if err = r.SetChunkSizes(128<<10, 64<<10, 1<<20); err != ErrInvalidChunkSizes {
+		t.Errorf("Expected %v, got %v", ErrInvalidChunkSizes, err)
+	}
+	if err = r.SetChunkSizes(1<<10, 4<<10, 16<<10); err != nil {
+		t.Errorf("Failed setting chunk sizes: %s", err)
+		return
+	}
+	if err = r.Save(); err != nil {
+		t.Errorf("Failed saving repository: %s", err)
+		return
+	}
+
+	r, err = OpenRepository(dir, testPassword)
+	if err != nil {
+		t.Errorf("Failed opening repository: %s", err)
+		return
+	}
+	vol, _ := NewVolume("test", "")
+	_ = r.AddVolume(vol)
+	index, err := OpenChunkIndex(&r)
+	if err != nil {
+		t.Errorf("Failed opening chunk-index: %s", err)
+		return
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Errorf("Failed getting working dir: %s", err)
+		return
+	}
+	snapshot, _ := NewSnapshot("test_snapshot")
+	progress := snapshot.Add(r, &index, StoreOptions{
+		CWD:       wd,
+		Paths:     []string{"repository.go"},
+		Encrypt:   EncryptionAESGCM,
+		DataParts: 1,
+	})
+	for p := range progress {
+		if p.Error != nil {
+			t.Errorf("Failed adding to snapshot: %s", p.Error)
+		}
+	}
+
+	arc := snapshot.Archives["repository.go"]
+	for _, c := range arc.Chunks {
+		if c.OriginalSize > 16<<10 {
+			t.Errorf("Expected chunks of at most %d bytes, got %d", 16<<10, c.OriginalSize)
+		}
+	}
+	if len(arc.Chunks) < 2 {
+		t.Errorf("Expected repository.go to be split into multiple chunks, got %d", len(arc.Chunks))
+	}
+	b, _, err := DecodeArchiveData(r, *arc)
+	if err != nil {
+		t.Errorf("Failed decoding archive: %s", err)
+		return
+	}
+	orig, _ := ioutil.ReadFile("repository.go")
+	if !bytes.Equal(b, orig) {
+		t.Errorf("Data mismatch after decoding archive")
+	}
+
+	_ = vol.AddSnapshot(snapshot.ID)
+	if err = r.SetChunkSizes(DefaultMinChunkSize, DefaultAvgChunkSize, DefaultMaxChunkSize); err != ErrRepositoryNotEmpty {
+		t.Errorf("Expected %v, got %v", ErrRepositoryNotEmpty, err)
+	}
+}
@@ -0,0 +1,160 @@
+/*
+ * knoxite
+ *     Copyright (c) 2016-2021, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package knoxite
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Error declarations.
+var (
+	ErrEmptyRetentionPolicy = errors.New("retention policy doesn't keep any snapshots")
+)
+
+// A RetentionPolicy describes which snapshots of a volume to keep. A snapshot
+// is kept if any of the rules matches it.
+type RetentionPolicy struct {
+	Last    int // the n most recent snapshots
+	Hourly  int // the most recent snapshot of each of the last n hours with snapshots
+	Daily   int // the most recent snapshot of each of the last n days with snapshots
+	Weekly  int // the most recent snapshot of each of the last n weeks with snapshots
+	Monthly int // the most recent snapshot of each of the last n months with snapshots
+	Yearly  int // the most recent snapshot of each of the last n years with snapshots
+
+	// Within keeps all snapshots taken within this duration before the most
+	// recent snapshot
+	Within time.Duration
+	// Tags keeps all snapshots carrying any of these tags
+	Tags []string
+}
+
+// Empty returns true if the policy doesn't contain any rules.
+func (p RetentionPolicy) Empty() bool {
+	return p.Last <= 0 && p.Hourly <= 0 && p.Daily <= 0 && p.Weekly <= 0 &&
+		p.Monthly <= 0 && p.Yearly <= 0 && p.Within <= 0 && len(p.Tags) == 0
+}
+
+// A RetentionResult describes whether a snapshot is kept and why.
+type RetentionResult struct {
+	Snapshot *Snapshot
+	Keep     bool
+	Reasons  []string
+}
+
+// retentionBucket groups snapshots by a period of time. Only the most recent
+// snapshot of each of the last n periods is kept.
+type retentionBucket struct {
+	reason string
+	n      int
+	period func(s *Snapshot) string
+	last   string
+}
+
+// applyRetentionPolicy decides which snapshots to keep, most recent first.
+func applyRetentionPolicy(snapshots []*Snapshot, policy RetentionPolicy) []RetentionResult {
+	sorted := make([]*Snapshot, len(snapshots))
+	copy(sorted, snapshots)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Date.After(sorted[j].Date)
+	})
+
+	buckets := []*retentionBucket{
+		{reason: "last", n: policy.Last, period: func(s *Snapshot) string {
+			// every snapshot is a period of its own
+			return s.ID
+		}},
+		{reason: "hourly", n: policy.Hourly, period: func(s *Snapshot) string {
+			return s.Date.Format("2006-01-02 15")
+		}},
+		{reason: "daily", n: policy.Daily, period: func(s *Snapshot) string {
+			return s.Date.Format("2006-01-02")
+		}},
+		{reason: "weekly", n: policy.Weekly, period: func(s *Snapshot) string {
+			year, week := s.Date.ISOWeek()
+			return fmt.Sprintf("%d-%02d", year, week)
+		}},
+		{reason: "monthly", n: policy.Monthly, period: func(s *Snapshot) string {
+			return s.Date.Format("2006-01")
+		}},
+		{reason: "yearly", n: policy.Yearly, period: func(s *Snapshot) string {
+			return s.Date.Format("2006")
+		}},
+	}
+
+	results := []RetentionResult{}
+	for _, snapshot := range sorted {
+		result := RetentionResult{Snapshot: snapshot}
+
+		for _, b := range buckets {
+			if b.n <= 0 {
+				continue
+			}
+			period := b.period(snapshot)
+			if period == b.last {
+				// a more recent snapshot already covers this period
+				continue
+			}
+
+			b.last = period
+			b.n--
+			result.Reasons = append(result.Reasons, b.reason)
+		}
+
+		if policy.Within > 0 && sorted[0].Date.Sub(snapshot.Date) <= policy.Within {
+			result.Reasons = append(result.Reasons, "within "+policy.Within.String())
+		}
+		for _, tag := range policy.Tags {
+			if containsString(snapshot.Tags, tag) {
+				result.Reasons = append(result.Reasons, "tag "+tag)
+			}
+		}
+
+		result.Keep = len(result.Reasons) > 0
+		results = append(results, result)
+	}
+
+	return results
+}
+
+// Forget applies a retention policy to a volume's snapshots. Snapshots which
+// aren't kept by the policy get removed from the volume and the chunk-index,
+// unless dryRun is true. Neither the repository nor the chunk-index get saved.
+func (v *Volume) Forget(repository *Repository, index *ChunkIndex, policy RetentionPolicy, dryRun bool) ([]RetentionResult, error) {
+	if policy.Empty() {
+		return nil, ErrEmptyRetentionPolicy
+	}
+
+	snapshots := []*Snapshot{}
+	for _, id := range v.Snapshots {
+		snapshot, err := v.LoadSnapshot(id, repository)
+		if err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+
+	results := applyRetentionPolicy(snapshots, policy)
+	if dryRun {
+		return results, nil
+	}
+
+	for _, result := range results {
+		if result.Keep {
+			continue
+		}
+		if err := v.RemoveSnapshot(result.Snapshot.ID); err != nil {
+			return results, err
+		}
+		index.RemoveSnapshot(result.Snapshot.ID)
+	}
+
+	return results, nil
+}
@@ -0,0 +1,114 @@
+/*
+ * knoxite
+ *     Copyright (c) 2016-2021, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package knoxite
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRetentionPolicy(t *testing.T) {
+	now := time.Date(2021, 3, 15, 12, 0, 0, 0, time.UTC)
+	snapshots := []*Snapshot{
+		{ID: "a", Date: now},
+		{ID: "b", Date: now.Add(-1 * time.Hour)},
+		{ID: "c", Date: now.Add(-26 * time.Hour)},
+		{ID: "d", Date: now.Add(-27 * time.Hour)},
+		{ID: "e", Date: now.AddDate(0, -1, 0)},
+		{ID: "f", Date: now.AddDate(0, -2, 0), Tags: []string{"important"}},
+		{ID: "g", Date: now.AddDate(-1, 0, 0)},
+	}
+
+	tests := []struct {
+		policy RetentionPolicy
+		keep   []string
+	}{
+		{RetentionPolicy{Last: 2}, []string{"a", "b"}},
+		{RetentionPolicy{Daily: 2}, []string{"a", "c"}},
+		{RetentionPolicy{Monthly: 3}, []string{"a", "e", "f"}},
+		{RetentionPolicy{Yearly: 5}, []string{"a", "g"}},
+		{RetentionPolicy{Within: 48 * time.Hour}, []string{"a", "b", "c", "d"}},
+		{RetentionPolicy{Tags: []string{"important"}}, []string{"f"}},
+		{RetentionPolicy{Last: 1, Yearly: 2, Tags: []string{"important"}}, []string{"a", "f", "g"}},
+	}
+
+	for _, test := range tests {
+		keep := []string{}
+		for _, result := range applyRetentionPolicy(snapshots, test.policy) {
+			if result.Keep {
+				keep = append(keep, result.Snapshot.ID)
+			}
+		}
+
+		if !reflect.DeepEqual(keep, test.keep) {
+			t.Errorf("Policy %+v: expected to keep %v, got %v", test.policy, test.keep, keep)
+		}
+	}
+}
+
+func TestVolumeForget(t *testing.T) {
+	testPassword := "this_is_a_password"
+
+	dir, err := ioutil.TempDir("", "knoxite")
+	if err != nil {
+		t.Errorf("Failed creating temporary dir for repository: %s", err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	r, err := NewRepository(dir, testPassword)
+	if err != nil {
+		t.Errorf("Failed creating repository: %s", err)
+		return
+	}
+	vol, _ := NewVolume("test", "")
+	_ = r.AddVolume(vol)
+	index, err := OpenChunkIndex(&r)
+	if err != nil {
+		t.Errorf("Failed opening chunk-index: %s", err)
+		return
+	}
+
+	for i := 0; i < 3; i++ {
+		snapshot, _ := NewSnapshot("test_snapshot")
+		snapshot.Date = snapshot.Date.Add(time.Duration(i) * time.Hour)
+		if err = snapshot.Save(&r); err != nil {
+			t.Errorf("Failed saving snapshot: %s", err)
+			return
+		}
+		_ = vol.AddSnapshot(snapshot.ID)
+	}
+
+	if _, err = vol.Forget(&r, &index, RetentionPolicy{}, false); err != ErrEmptyRetentionPolicy {
+		t.Errorf("Expected %v, got %v", ErrEmptyRetentionPolicy, err)
+	}
+
+	results, err := vol.Forget(&r, &index, RetentionPolicy{Last: 1}, true)
+	if err != nil {
+		t.Errorf("Failed forgetting snapshots: %s", err)
+		return
+	}
+	if len(results) != 3 || !results[0].Keep || results[0].Snapshot.ID != vol.Snapshots[2] {
+		t.Errorf("Expected the most recent snapshot to be kept, got %+v", results)
+	}
+	if len(vol.Snapshots) != 3 {
+		t.Errorf("Expected a dry-run not to remove any snapshots, got %d", len(vol.Snapshots))
+	}
+
+	latest := vol.Snapshots[2]
+	if _, err = vol.Forget(&r, &index, RetentionPolicy{Last: 1}, false); err != nil {
+		t.Errorf("Failed forgetting snapshots: %s", err)
+		return
+	}
+	if len(vol.Snapshots) != 1 || vol.Snapshots[0] != latest {
+		t.Errorf("Expected only snapshot %s to be kept, got %v", latest, vol.Snapshots)
+	}
+}
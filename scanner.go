@@ -15,7 +15,16 @@ import (
 	"strings"
 )
 
-func findFiles(rootPath string, excludes []string) <-chan ArchiveResult {
+// fileID identifies a file by its device and inode number.
+type fileID struct {
+	dev uint64
+	ino uint64
+}
+
+// findFiles walks rootPath and returns an archive for every file, directory and
+// symlink in it. links maps the files with several hard links to the first
+// path found for them, which later hard links refer to.
+func findFiles(rootPath string, excludes []string, links map[fileID]string) <-chan ArchiveResult {
 	c := make(chan ArchiveResult)
 	go func() {
 		defer close(c)
@@ -37,7 +46,7 @@ func findFiles(rootPath string, excludes []string) <-chan ArchiveResult {
 				// fmt.Println("Matching", path, filepath.Base(path), exclude)
 				match, err = filepath.Match(strings.ToLower(exclude), strings.ToLower(path))
 				if err != nil {
-					fmt.Println("Invalid exclude filter:", exclude)
+					log.Warnf("Invalid exclude filter: %s", exclude)
 					return err
 				}
 				if !match {
@@ -66,9 +75,19 @@ func findFiles(rootPath string, excludes []string) <-chan ArchiveResult {
 				ModTime: fi.ModTime().Unix(),
 				UID:     statT.uid(),
 				GID:     statT.gid(),
+				Device:  statT.dev(),
+				Inode:   statT.ino(),
+				CTime:   statT.ctime(),
+				Flags:   statT.flags(),
 				// AbsPath: path,
 				// FileInfo: fi,
 			}
+			// a file without readable extended attributes can still be stored
+			archive.XAttrs, err = readXAttrs(path)
+			if err != nil {
+				log.Warnf("error reading extended attributes of %s: %v", path, err)
+			}
+
 			if isSymLink(fi) {
 				symlink, err := os.Readlink(path)
 				if err != nil {
@@ -80,9 +99,28 @@ func findFiles(rootPath string, excludes []string) <-chan ArchiveResult {
 				archive.PointsTo = symlink
 			} else if fi.IsDir() {
 				archive.Type = Directory
+			} else if fi.Mode()&os.ModeDevice != 0 {
+				archive.Type = BlockDevice
+				if fi.Mode()&os.ModeCharDevice != 0 {
+					archive.Type = CharDevice
+				}
+				archive.DevMajor, archive.DevMinor = deviceNumbers(statT.rdev())
+			} else if fi.Mode()&os.ModeNamedPipe != 0 {
+				archive.Type = FIFO
+			} else if fi.Mode()&os.ModeSocket != 0 {
+				archive.Type = Socket
 			} else if isRegularFile(fi) {
 				archive.Type = File
 				archive.Size = uint64(fi.Size())
+
+				if statT.nlink() > 1 {
+					id := fileID{dev: statT.dev(), ino: statT.ino()}
+					if first, ok := links[id]; ok {
+						archive.LinkTo = first
+					} else {
+						links[id] = path
+					}
+				}
 			} else {
 				return nil
 			}
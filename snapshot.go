@@ -8,9 +8,15 @@
 package knoxite
 
 import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
 	"math"
 	"os"
+	"os/user"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -18,13 +24,27 @@ import (
 	uuid "github.com/nu7hatch/gouuid"
 )
 
+// Error declarations.
+var (
+	ErrInvalidArchivePath = errors.New("invalid archive path")
+	ErrSnapshotIncomplete = errors.New("snapshot is incomplete")
+)
+
 // A Snapshot is a compilation of one or many archives.
 type Snapshot struct {
 	mut sync.Mutex
+	// storeErr is set if data, which the snapshot already references, could
+	// not be stored. Such a snapshot must never be saved.
+	storeErr error
 
 	ID          string              `json:"id"`
 	Date        time.Time           `json:"date"`
 	Description string              `json:"description"`
+	Tags        []string            `json:"tags,omitempty"`
+	Hostname    string              `json:"hostname,omitempty"`
+	Username    string              `json:"username,omitempty"`
+	Paths       []string            `json:"paths,omitempty"`   // source paths
+	Version     string              `json:"version,omitempty"` // knoxite version which created the snapshot
 	Stats       Stats               `json:"stats"`
 	Archives    map[string]*Archive `json:"items"`
 }
@@ -39,6 +59,10 @@ type StoreOptions struct {
 	Pedantic    bool
 	DataParts   uint
 	ParityParts uint
+	PackSize    uint64 // target size of packs, DefaultPackSize if zero
+	// Parent is the previous snapshot of the same data. Files which haven't
+	// changed since the parent was taken get reused without reading them
+	Parent *Snapshot
 }
 
 // NewSnapshot creates a new snapshot.
@@ -49,6 +73,12 @@ func NewSnapshot(description string) (*Snapshot, error) {
 		Archives:    make(map[string]*Archive),
 	}
 
+	// host and user are merely informational, so errors can be ignored
+	snapshot.Hostname, _ = os.Hostname()
+	if u, err := user.Current(); err == nil {
+		snapshot.Username = u.Username
+	}
+
 	u, err := uuid.NewV4()
 	if err != nil {
 		return &snapshot, err
@@ -73,9 +103,12 @@ func (snapshot *Snapshot) gatherTargetInformation(cwd string, paths []string, ex
 
 	go func() {
 		var archives []ArchiveResult
+		// hard links are tracked across all paths
+		links := make(map[fileID]string)
+		names := newOwnerNames()
 
 		for _, path := range paths {
-			ff := findFiles(path, excludes)
+			ff := findFiles(path, excludes, links)
 
 			for result := range ff {
 				if result.Error == nil {
@@ -83,9 +116,17 @@ func (snapshot *Snapshot) gatherTargetInformation(cwd string, paths []string, ex
 					if err == nil && !strings.HasPrefix(rel, ".."+string(os.PathSeparator)) {
 						result.Archive.Path = rel
 					}
+					if result.Archive.LinkTo != "" {
+						rel, err := filepath.Rel(cwd, result.Archive.LinkTo)
+						if err == nil && !strings.HasPrefix(rel, ".."+string(os.PathSeparator)) {
+							result.Archive.LinkTo = rel
+						}
+					}
 					if isSpecialPath(result.Archive.Path) {
 						continue
 					}
+					result.Archive.User = names.user(result.Archive.UID)
+					result.Archive.Group = names.group(result.Archive.GID)
 
 					// update scan statistics
 					snapshot.mut.Lock()
@@ -124,10 +165,24 @@ func (snapshot *Snapshot) gatherTargetInformation(cwd string, paths []string, ex
 func (snapshot *Snapshot) Add(repository Repository, chunkIndex *ChunkIndex, opts StoreOptions) <-chan Progress {
 	progress := make(chan Progress)
 
+	if repository.PublicKey != "" && opts.Encrypt != EncryptionNone {
+		// write-only repositories only ever get to see the public key
+		opts.Encrypt = EncryptionX25519
+	}
+
+	for _, path := range opts.Paths {
+		if !containsString(snapshot.Paths, path) {
+			snapshot.Paths = append(snapshot.Paths, path)
+		}
+	}
+
 	ch := snapshot.gatherTargetInformation(opts.CWD, opts.Paths, opts.Excludes)
+	repository.backend.packer = newPacker(opts.PackSize)
 
 	go func() {
 		defer close(progress)
+		defer snapshot.flushPacks(&repository, chunkIndex, progress)
+
 		for result := range ch {
 			if result.Error != nil {
 				p := newProgressError(result.Error)
@@ -156,7 +211,32 @@ func (snapshot *Snapshot) Add(repository Repository, chunkIndex *ChunkIndex, opt
 
 			if archive.Type == File {
 				opts.DataParts = uint(math.Max(1, float64(opts.DataParts)))
-				chunkchan, err := chunkFile(archive.Path, repository.Key, opts)
+			}
+			if linked := snapshot.linkedArchive(archive); linked != nil {
+				// the data of hard links only gets stored once
+				archive.Chunks = append([]Chunk{}, linked.Chunks...)
+				archive.StorageSize = linked.StorageSize
+				archive.Encrypted = linked.Encrypted
+				archive.Compressed = linked.Compressed
+
+				p.CurrentItemStats.StorageSize = archive.StorageSize
+				progress <- p
+			} else if parent := reusableArchive(archive, opts); parent != nil {
+				archive.Chunks = append([]Chunk{}, parent.Chunks...)
+				archive.StorageSize = parent.StorageSize
+				archive.Encrypted = parent.Encrypted
+				archive.Compressed = parent.Compressed
+
+				p.CurrentItemStats.StorageSize = archive.StorageSize
+				p.CurrentItemStats.Reused = archive.Size
+				snapshot.mut.Lock()
+				snapshot.Stats.Reused += archive.Size
+				snapshot.Stats.StorageSize += archive.StorageSize
+				p.TotalStatistics = snapshot.Stats
+				snapshot.mut.Unlock()
+				progress <- p
+			} else if archive.Type == File {
+				chunkchan, err := chunkFile(archive.Path, &repository, opts)
 				if err != nil {
 					if os.IsNotExist(err) {
 						// if this file has already been deleted before we could backup it, we can gracefully ignore it and continue
@@ -170,49 +250,9 @@ func (snapshot *Snapshot) Add(repository Repository, chunkIndex *ChunkIndex, opt
 					}
 					continue
 				}
-				archive.Encrypted = opts.Encrypt
-				archive.Compressed = opts.Compress
-
-				for cd := range chunkchan {
-					if cd.Error != nil {
-						p = newProgressError(err)
-						p.Path = archive.Path
-						progress <- p
-						if opts.Pedantic {
-							return
-						}
-						continue
-					}
-					chunk := cd.Chunk
-					// fmt.Printf("\tSplit %s (#%d, %d bytes), compression: %s, encryption: %s, hash: %s\n", id.Path, cd.Num, cd.Size, CompressionText(cd.Compressed), EncryptionText(cd.Encrypted), cd.Hash)
-
-					// store this chunk
-					n, err := repository.backend.StoreChunk(chunk)
-					if err != nil {
-						p = newProgressError(err)
-						p.Path = archive.Path
-						progress <- p
-						if opts.Pedantic {
-							return
-						}
-						continue
-					}
 
-					// release the memory, we don't need the data anymore
-					chunk.Data = &[][]byte{}
-
-					archive.Chunks = append(archive.Chunks, chunk)
-					archive.StorageSize += n
-
-					p.CurrentItemStats.StorageSize = archive.StorageSize
-					p.CurrentItemStats.Transferred += uint64(chunk.OriginalSize)
-					snapshot.Stats.Transferred += uint64(chunk.OriginalSize)
-					snapshot.Stats.StorageSize += n
-
-					snapshot.mut.Lock()
-					p.TotalStatistics = snapshot.Stats
-					snapshot.mut.Unlock()
-					progress <- p
+				if !snapshot.storeChunks(&repository, chunkIndex, archive, chunkchan, p, progress, opts, false) {
+					return
 				}
 			}
 
@@ -225,6 +265,255 @@ func (snapshot *Snapshot) Add(repository Repository, chunkIndex *ChunkIndex, opt
 	return progress
 }
 
+// ReaderOptions describes the file, which gets created in a snapshot from the
+// content of a reader.
+type ReaderOptions struct {
+	Path    string      // path of the file within the snapshot, made relative if absolute
+	Mode    os.FileMode // permission bits, 0644 if zero
+	ModTime time.Time   // the current time if zero
+}
+
+// AddReader stores the content of r as a file in a snapshot. The file is owned
+// by the current user.
+func (snapshot *Snapshot) AddReader(repository Repository, chunkIndex *ChunkIndex, r io.Reader, ropts ReaderOptions, opts StoreOptions) <-chan Progress {
+	progress := make(chan Progress)
+
+	if repository.PublicKey != "" && opts.Encrypt != EncryptionNone {
+		// write-only repositories only ever get to see the public key
+		opts.Encrypt = EncryptionX25519
+	}
+	opts.DataParts = uint(math.Max(1, float64(opts.DataParts)))
+
+	archive := &Archive{
+		// like tar, strip leading separators, so restores stay within their
+		// target directory
+		Path:    strings.TrimLeft(filepath.Clean(ropts.Path), string(filepath.Separator)),
+		Type:    File,
+		Mode:    ropts.Mode &^ os.ModeType,
+		ModTime: ropts.ModTime.Unix(),
+	}
+	if archive.Mode == 0 {
+		archive.Mode = 0644
+	}
+	if ropts.ModTime.IsZero() {
+		archive.ModTime = time.Now().Unix()
+	}
+	if uid, gid := os.Getuid(), os.Getgid(); uid >= 0 && gid >= 0 {
+		archive.UID = uint32(uid)
+		archive.GID = uint32(gid)
+	}
+
+	repository.backend.packer = newPacker(opts.PackSize)
+
+	go func() {
+		defer close(progress)
+		if archive.Path == "" || isSpecialPath(archive.Path) {
+			p := newProgressError(ErrInvalidArchivePath)
+			p.Path = ropts.Path
+			progress <- p
+			return
+		}
+		defer snapshot.flushPacks(&repository, chunkIndex, progress)
+
+		snapshot.mut.Lock()
+		if !containsString(snapshot.Paths, archive.Path) {
+			snapshot.Paths = append(snapshot.Paths, archive.Path)
+		}
+		snapshot.Stats.Files++
+		snapshot.mut.Unlock()
+
+		p := newProgress(archive)
+		progress <- p
+
+		chunkchan := chunkReader(ioutil.NopCloser(r), &repository, opts)
+		if !snapshot.storeChunks(&repository, chunkIndex, archive, chunkchan, p, progress, opts, true) {
+			return
+		}
+
+		snapshot.AddArchive(archive)
+		chunkIndex.AddArchive(archive, snapshot.ID)
+	}()
+
+	return progress
+}
+
+// flushPacks stores the remaining, partially filled packs. The chunks they
+// contain are already referenced by the snapshot, so the snapshot fails if
+// they can't be stored. Pack locations only make it into the chunk-index once
+// their packs have been stored.
+func (snapshot *Snapshot) flushPacks(repository *Repository, chunkIndex *ChunkIndex, progress chan<- Progress) {
+	parts, packs, err := repository.backend.packer.flush(&repository.backend)
+	if err != nil {
+		snapshot.fail(err)
+		progress <- newProgressError(err)
+		return
+	}
+	chunkIndex.addPacked(parts, packs)
+	repository.packs.add(parts)
+}
+
+// storeChunks stores the chunks of an archive and reports the progress. If
+// stream is true, the size of the archive isn't known in advance and grows
+// with every chunk. It returns false if storing should be aborted.
+func (snapshot *Snapshot) storeChunks(repository *Repository, chunkIndex *ChunkIndex, archive *Archive, chunks <-chan ChunkResult, p Progress, progress chan<- Progress, opts StoreOptions, stream bool) bool {
+	archive.Encrypted = opts.Encrypt
+	archive.Compressed = opts.Compress
+
+	for cd := range chunks {
+		if cd.Error != nil {
+			pe := newProgressError(cd.Error)
+			pe.Path = archive.Path
+			progress <- pe
+			if opts.Pedantic {
+				return false
+			}
+			continue
+		}
+		chunk := cd.Chunk
+		// fmt.Printf("\tSplit %s (#%d, %d bytes), compression: %s, encryption: %s, hash: %s\n", id.Path, cd.Num, cd.Size, CompressionText(cd.Compressed), EncryptionText(cd.Encrypted), cd.Hash)
+
+		if stream {
+			archive.Size += uint64(chunk.OriginalSize)
+			p.CurrentItemStats.Size += uint64(chunk.OriginalSize)
+			snapshot.mut.Lock()
+			snapshot.Stats.Size += uint64(chunk.OriginalSize)
+			snapshot.mut.Unlock()
+		}
+
+		// with a packer, every chunk ends up in a pack, whether it has been
+		// stored just now or before
+		chunk.Packed = !chunk.Sparse && repository.backend.packer != nil
+
+		var n uint64
+		if chunk.Sparse {
+			// holes don't need to be stored at all
+			p.CurrentItemStats.Sparse += uint64(chunk.OriginalSize)
+			snapshot.Stats.Sparse += uint64(chunk.OriginalSize)
+		} else if chunkStored(repository, chunkIndex, chunk) {
+			// no need to transfer this chunk again
+			for _, data := range *chunk.Data {
+				if uint64(len(data)) > n {
+					n = uint64(len(data))
+				}
+			}
+			p.CurrentItemStats.Deduplicated += uint64(chunk.OriginalSize)
+			snapshot.Stats.Deduplicated += uint64(chunk.OriginalSize)
+		} else {
+			// store this chunk
+			var err error
+			n, err = repository.backend.StoreChunk(chunk)
+			if err != nil {
+				pe := newProgressError(err)
+				pe.Path = archive.Path
+				if repository.backend.packer != nil {
+					// a failed pack takes chunks of other archives with it
+					snapshot.fail(err)
+					progress <- pe
+					return false
+				}
+				progress <- pe
+				if opts.Pedantic {
+					return false
+				}
+				continue
+			}
+
+			var uploaded uint64
+			for _, data := range *chunk.Data {
+				uploaded += uint64(len(data))
+			}
+			p.CurrentItemStats.New += uint64(chunk.OriginalSize)
+			p.CurrentItemStats.Uploaded += uploaded
+			snapshot.Stats.New += uint64(chunk.OriginalSize)
+			snapshot.Stats.Uploaded += uploaded
+		}
+		p.CurrentItemStats.Transferred += uint64(chunk.OriginalSize)
+		snapshot.Stats.Transferred += uint64(chunk.OriginalSize)
+
+		// release the memory, we don't need the data anymore
+		chunk.Data = &[][]byte{}
+
+		archive.Chunks = append(archive.Chunks, chunk)
+		archive.StorageSize += n
+
+		p.CurrentItemStats.StorageSize = archive.StorageSize
+		snapshot.Stats.StorageSize += n
+
+		snapshot.mut.Lock()
+		p.TotalStatistics = snapshot.Stats
+		snapshot.mut.Unlock()
+		progress <- p
+	}
+
+	return true
+}
+
+// chunkStored returns true if a chunk doesn't need to be stored again: either
+// it has already been stored during this run, or all its parts can be found
+// in packs listed in the chunk-index.
+func chunkStored(repository *Repository, chunkIndex *ChunkIndex, chunk Chunk) bool {
+	packer := repository.backend.packer
+	if packer == nil {
+		return false
+	}
+	if packer.has(chunk.Hash) {
+		return true
+	}
+
+	item, ok := chunkIndex.Chunks[chunk.Hash]
+	if !ok || item.DataParts != chunk.DataParts || item.ParityParts != chunk.ParityParts ||
+		len(item.Packs) != len(*chunk.Data) {
+		// chunks stored before packs were introduced get moved into packs
+		return false
+	}
+	for _, loc := range item.Packs {
+		if loc.Pack == "" || !packer.packExists(&repository.backend, loc.Pack, chunkIndex.PackSizes[loc.Pack]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// linkedArchive returns the already stored archive a hard link refers to.
+func (snapshot *Snapshot) linkedArchive(archive *Archive) *Archive {
+	if archive.LinkTo == "" {
+		return nil
+	}
+
+	linked, ok := snapshot.Archives[archive.LinkTo]
+	if !ok || linked.Type != File {
+		return nil
+	}
+	return linked
+}
+
+// reusableArchive returns the parent's archive of an unchanged file, if its
+// chunks have all been stored with the same settings.
+func reusableArchive(archive *Archive, opts StoreOptions) *Archive {
+	if opts.Parent == nil {
+		return nil
+	}
+	parent, ok := opts.Parent.Archives[archive.Path]
+	if !ok || !archive.unchanged(parent) || !parent.complete() {
+		// incomplete archives get stored again, instead of staying broken
+		return nil
+	}
+	if parent.Encrypted != opts.Encrypt || parent.Compressed != opts.Compress {
+		return nil
+	}
+	for _, chunk := range parent.Chunks {
+		if chunk.Sparse {
+			continue
+		}
+		if chunk.DataParts != opts.DataParts || chunk.ParityParts != opts.ParityParts {
+			return nil
+		}
+	}
+
+	return parent
+}
+
 // Clone clones a snapshot.
 func (snapshot *Snapshot) Clone() (*Snapshot, error) {
 	s, err := NewSnapshot(snapshot.Description)
@@ -234,6 +523,8 @@ func (snapshot *Snapshot) Clone() (*Snapshot, error) {
 
 	s.Stats = snapshot.Stats
 	s.Archives = snapshot.Archives
+	s.Paths = append([]string{}, snapshot.Paths...)
+	s.AddTags(snapshot.Tags...)
 
 	return s, nil
 }
@@ -247,7 +538,8 @@ func openSnapshot(id string, repository *Repository) (*Snapshot, error) {
 	if err != nil {
 		return &snapshot, err
 	}
-	pipe, err := NewDecodingPipeline(CompressionLZMA, EncryptionAES, repository.Key)
+	encryption := repository.sealedEncryption()
+	pipe, err := NewDecodingPipeline(CompressionLZMA, encryption, repository.decryptionKey(encryption))
 	if err != nil {
 		return &snapshot, err
 	}
@@ -257,7 +549,15 @@ func openSnapshot(id string, repository *Repository) (*Snapshot, error) {
 
 // Save writes a snapshot's metadata.
 func (snapshot *Snapshot) Save(repository *Repository) error {
-	pipe, err := NewEncodingPipeline(CompressionLZMA, EncryptionAES, repository.Key)
+	snapshot.mut.Lock()
+	storeErr := snapshot.storeErr
+	snapshot.mut.Unlock()
+	if storeErr != nil {
+		return fmt.Errorf("%w: %v", ErrSnapshotIncomplete, storeErr)
+	}
+
+	encryption := repository.sealedEncryption()
+	pipe, err := NewEncodingPipeline(CompressionLZMA, encryption, repository.encryptionKey(encryption))
 	if err != nil {
 		return err
 	}
@@ -268,7 +568,72 @@ func (snapshot *Snapshot) Save(repository *Repository) error {
 	return repository.backend.SaveSnapshot(snapshot.ID, b)
 }
 
+// fail marks a snapshot as incomplete, as some of its data couldn't be
+// stored.
+func (snapshot *Snapshot) fail(err error) {
+	snapshot.mut.Lock()
+	defer snapshot.mut.Unlock()
+
+	if snapshot.storeErr == nil {
+		snapshot.storeErr = err
+	}
+}
+
 // AddArchive adds an archive to a snapshot.
 func (snapshot *Snapshot) AddArchive(archive *Archive) {
 	snapshot.Archives[archive.Path] = archive
 }
+
+// AddTags adds tags to a snapshot. Tags are kept sorted and unique.
+func (snapshot *Snapshot) AddTags(tags ...string) {
+	for _, tag := range tags {
+		if tag != "" && !containsString(snapshot.Tags, tag) {
+			snapshot.Tags = append(snapshot.Tags, tag)
+		}
+	}
+	sort.Strings(snapshot.Tags)
+}
+
+// RemoveTags removes tags from a snapshot.
+func (snapshot *Snapshot) RemoveTags(tags ...string) {
+	kept := []string{}
+	for _, tag := range snapshot.Tags {
+		if !containsString(tags, tag) {
+			kept = append(kept, tag)
+		}
+	}
+	snapshot.Tags = kept
+}
+
+// A SnapshotFilter selects snapshots by their metadata. Empty criteria match
+// all snapshots.
+type SnapshotFilter struct {
+	Hostname string
+	Username string
+	Path     string   // a path at or below one of the snapshot's source paths
+	Tags     []string // the snapshot has to carry all of these tags
+}
+
+// Matches returns true if the snapshot matches all criteria of the filter.
+func (f SnapshotFilter) Matches(snapshot *Snapshot) bool {
+	if f.Hostname != "" && f.Hostname != snapshot.Hostname {
+		return false
+	}
+	if f.Username != "" && f.Username != snapshot.Username {
+		return false
+	}
+	for _, tag := range f.Tags {
+		if !containsString(snapshot.Tags, tag) {
+			return false
+		}
+	}
+	if f.Path == "" {
+		return true
+	}
+	for _, path := range snapshot.Paths {
+		if containsPath(path, f.Path) {
+			return true
+		}
+	}
+	return false
+}
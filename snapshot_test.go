@@ -9,11 +9,16 @@
 package knoxite
 
 import (
+	"bytes"
+	"crypto/rand"
 	"encoding/hex"
+	"errors"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"runtime"
 	"testing"
+	"time"
 
 	"github.com/minio/highwayhash"
 	"github.com/muesli/combinator"
@@ -306,3 +311,740 @@ func TestSnapshotFind(t *testing.T) {
 		t.Errorf("Failed finding latest snapshot: %s %s", err, snapshot.ID)
 	}
 }
+
+func TestSnapshotDeduplication(t *testing.T) {
+	testPassword := "this_is_a_password"
+
+	dir, err := ioutil.TempDir("", "knoxite")
+	if err != nil {
+		t.Errorf("Failed creating temporary dir for repository: %s", err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	r, err := NewRepository(dir, testPassword)
+	if err != nil {
+		t.Errorf("Failed creating repository: %s", err)
+		return
+	}
+	index, err := OpenChunkIndex(&r)
+	if err != nil {
+		t.Errorf("Failed opening chunk-index: %s", err)
+		return
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Errorf("Failed getting working dir: %s", err)
+		return
+	}
+
+	opts := StoreOptions{
+		CWD:       wd,
+		Paths:     []string{"snapshot.go"},
+		Compress:  CompressionNone,
+		Encrypt:   EncryptionAESGCM,
+		DataParts: 1,
+	}
+
+	fi, _ := os.Stat("snapshot.go")
+	size := uint64(fi.Size())
+
+	var hashes []string
+	for i := 0; i < 4; i++ {
+		if i == 2 {
+			// chunks, which can't be found in the backends, get stored again
+			_ = os.RemoveAll(filepath.Join(dir, "packs"))
+		}
+		if i == 3 {
+			// as do chunks in incompletely stored packs
+			_ = filepath.Walk(filepath.Join(dir, "packs"), func(path string, info os.FileInfo, err error) error {
+				if err == nil && !info.IsDir() {
+					err = os.Truncate(path, info.Size()-1)
+				}
+				return err
+			})
+		}
+
+		snapshot, _ := NewSnapshot("test_snapshot")
+		progress := snapshot.Add(r, &index, opts)
+		for p := range progress {
+			if p.Error != nil {
+				t.Errorf("Failed adding to snapshot: %s", p.Error)
+			}
+		}
+
+		for _, chunk := range snapshot.Archives["snapshot.go"].Chunks {
+			hashes = append(hashes, chunk.Hash)
+		}
+
+		stats := snapshot.Stats
+		if i == 1 {
+			if stats.Deduplicated != size || stats.New != 0 || stats.Uploaded != 0 || stats.Transferred != size {
+				t.Errorf("Expected all data to be deduplicated, got %+v", stats)
+			}
+		} else if stats.New != size || stats.Deduplicated != 0 || stats.Uploaded == 0 || stats.Transferred != size {
+			t.Errorf("Expected all data to be stored, got %+v", stats)
+		}
+	}
+
+	if len(hashes) != 4 || hashes[0] != hashes[1] || hashes[1] != hashes[2] || hashes[2] != hashes[3] {
+		t.Errorf("Expected identical chunks to be deduplicated, got %v", hashes)
+	}
+	if len(index.Chunks) != 1 {
+		t.Errorf("Expected 1 chunk in chunk-index, got %d", len(index.Chunks))
+	}
+
+	// snapshots referencing packs, which couldn't be stored, can't be saved
+	_ = os.RemoveAll(filepath.Join(dir, "packs"))
+	if err = ioutil.WriteFile(filepath.Join(dir, "packs"), nil, 0600); err != nil {
+		t.Errorf("Failed replacing packs dir: %s", err)
+		return
+	}
+	index, _ = OpenChunkIndex(&r)
+	snapshot, _ := NewSnapshot("test_snapshot")
+	failed := false
+	for p := range snapshot.Add(r, &index, opts) {
+		failed = failed || p.Error != nil
+	}
+	if !failed {
+		t.Errorf("Expected storing packs to fail")
+	}
+	if err = snapshot.Save(&r); !errors.Is(err, ErrSnapshotIncomplete) {
+		t.Errorf("Expected %v, got %v", ErrSnapshotIncomplete, err)
+	}
+}
+
+func TestSnapshotParent(t *testing.T) {
+	testPassword := "this_is_a_password"
+
+	dir, err := ioutil.TempDir("", "knoxite")
+	if err != nil {
+		t.Errorf("Failed creating temporary dir for repository: %s", err)
+		return
+	}
+	defer os.RemoveAll(dir)
+	srcDir, err := ioutil.TempDir("", "knoxite")
+	if err != nil {
+		t.Errorf("Failed creating temporary dir for source files: %s", err)
+		return
+	}
+	defer os.RemoveAll(srcDir)
+
+	path := filepath.Join(srcDir, "data")
+	if err = ioutil.WriteFile(path, []byte("this_is_some_data"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	fi, _ := os.Stat(path)
+
+	r, err := NewRepository(dir, testPassword)
+	if err != nil {
+		t.Errorf("Failed creating repository: %s", err)
+		return
+	}
+	index, err := OpenChunkIndex(&r)
+	if err != nil {
+		t.Errorf("Failed opening chunk-index: %s", err)
+		return
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Errorf("Failed getting working dir: %s", err)
+		return
+	}
+
+	opts := StoreOptions{
+		CWD:       wd,
+		Paths:     []string{srcDir},
+		Compress:  CompressionNone,
+		Encrypt:   EncryptionAESGCM,
+		DataParts: 1,
+	}
+	store := func() *Snapshot {
+		snapshot, _ := NewSnapshot("test_snapshot")
+		progress := snapshot.Add(r, &index, opts)
+		for p := range progress {
+			if p.Error != nil {
+				t.Errorf("Failed adding to snapshot: %s", p.Error)
+			}
+		}
+		return snapshot
+	}
+
+	parent := store()
+	if parent.Stats.Reused != 0 {
+		t.Errorf("Expected no data to be reused without a parent, got %d bytes", parent.Stats.Reused)
+	}
+
+	opts.Parent = parent
+	snapshot := store()
+	if snapshot.Stats.Reused != uint64(fi.Size()) || snapshot.Stats.Transferred != 0 {
+		t.Errorf("Expected unchanged file to be reused, got %+v", snapshot.Stats)
+	}
+	if snapshot.Archives[path].Chunks[0].Hash != parent.Archives[path].Chunks[0].Hash {
+		t.Errorf("Expected chunks to be copied from the parent")
+	}
+
+	// same size and modification time, but the inode changed
+	if err = ioutil.WriteFile(path, []byte("this_is_more_data"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	_ = os.Chtimes(path, fi.ModTime(), fi.ModTime())
+	snapshot = store()
+	if snapshot.Stats.Reused != 0 {
+		t.Errorf("Expected modified file to be read again, got %+v", snapshot.Stats)
+	}
+	b, _, err := DecodeArchiveData(r, *snapshot.Archives[path])
+	if err != nil || string(b) != "this_is_more_data" {
+		t.Errorf("Expected modified data, got %q: %v", b, err)
+	}
+
+	// too many parity parts make storing every chunk fail
+	opts.Parent = nil
+	opts.ParityParts = 256
+	incomplete, _ := NewSnapshot("test_snapshot")
+	failed := false
+	for p := range incomplete.Add(r, &index, opts) {
+		failed = failed || p.Error != nil
+	}
+	if !failed || len(incomplete.Archives[path].Chunks) != 0 {
+		t.Fatalf("Expected storing chunks to fail")
+	}
+
+	opts.Parent = incomplete
+	opts.ParityParts = 0
+	snapshot = store()
+	if snapshot.Stats.Reused != 0 {
+		t.Errorf("Expected incomplete file to be stored again, got %+v", snapshot.Stats)
+	}
+	b, _, err = DecodeArchiveData(r, *snapshot.Archives[path])
+	if err != nil || string(b) != "this_is_more_data" {
+		t.Errorf("Expected complete data, got %q: %v", b, err)
+	}
+}
+
+func TestSnapshotMetadata(t *testing.T) {
+	testPassword := "this_is_a_password"
+
+	dir, err := ioutil.TempDir("", "knoxite")
+	if err != nil {
+		t.Errorf("Failed creating temporary dir for repository: %s", err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	r, _ := NewRepository(dir, testPassword)
+	snapshot, _ := NewSnapshot("test_snapshot")
+	snapshot.Hostname = "host"
+	snapshot.Username = "user"
+	snapshot.Paths = []string{"/home/user"}
+	snapshot.Version = "1.0"
+	snapshot.AddTags("weekly", "daily", "weekly")
+	if err := snapshot.Save(&r); err != nil {
+		t.Errorf("Failed saving snapshot: %s", err)
+		return
+	}
+
+	s, err := openSnapshot(snapshot.ID, &r)
+	if err != nil {
+		t.Errorf("Failed opening snapshot: %s", err)
+		return
+	}
+	if s.Hostname != "host" || s.Username != "user" || s.Version != "1.0" ||
+		len(s.Paths) != 1 || s.Paths[0] != "/home/user" {
+		t.Errorf("Metadata mismatch after loading snapshot: %+v", s)
+	}
+	if len(s.Tags) != 2 || s.Tags[0] != "daily" || s.Tags[1] != "weekly" {
+		t.Errorf("Expected sorted, unique tags, got %v", s.Tags)
+	}
+
+	s.RemoveTags("daily")
+	if len(s.Tags) != 1 || s.Tags[0] != "weekly" {
+		t.Errorf("Expected only the weekly tag to remain, got %v", s.Tags)
+	}
+
+	tests := []struct {
+		filter   SnapshotFilter
+		expected bool
+	}{
+		{SnapshotFilter{}, true},
+		{SnapshotFilter{Hostname: "host", Username: "user"}, true},
+		{SnapshotFilter{Hostname: "other"}, false},
+		{SnapshotFilter{Username: "other"}, false},
+		{SnapshotFilter{Path: "/home/user"}, true},
+		{SnapshotFilter{Path: "/home/user/docs"}, true},
+		{SnapshotFilter{Path: "/home"}, false},
+		{SnapshotFilter{Tags: []string{"weekly"}}, true},
+		{SnapshotFilter{Tags: []string{"weekly", "daily"}}, false},
+	}
+	for _, tt := range tests {
+		if m := tt.filter.Matches(s); m != tt.expected {
+			t.Errorf("Expected filter %+v to return %t, got %t", tt.filter, tt.expected, m)
+		}
+	}
+}
+
+func TestSnapshotAddReader(t *testing.T) {
+	testPassword := "this_is_a_password"
+
+	dir, err := ioutil.TempDir("", "knoxite")
+	if err != nil {
+		t.Errorf("Failed creating temporary dir for repository: %s", err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	r, err := NewRepository(dir, testPassword)
+	if err != nil {
+		t.Errorf("Failed creating repository: %s", err)
+		return
+	}
+	index, err := OpenChunkIndex(&r)
+	if err != nil {
+		t.Errorf("Failed opening chunk-index: %s", err)
+		return
+	}
+
+	// big enough to get split into several chunks
+	data := make([]byte, 3*r.Chunker.MaxSize)
+	_, _ = rand.Read(data)
+	modTime := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	opts := StoreOptions{
+		Encrypt:   EncryptionAESGCM,
+		DataParts: 1,
+	}
+	snapshot, _ := NewSnapshot("test_snapshot")
+	progress := snapshot.AddReader(r, &index, bytes.NewReader(data), ReaderOptions{
+		Path:    "dumps/db.sql",
+		Mode:    0600,
+		ModTime: modTime,
+	}, opts)
+	for p := range progress {
+		if p.Error != nil {
+			t.Errorf("Failed adding reader to snapshot: %s", p.Error)
+			return
+		}
+	}
+
+	arc, ok := snapshot.Archives["dumps/db.sql"]
+	if !ok {
+		t.Errorf("Expected the snapshot to contain dumps/db.sql, got %v", snapshot.Archives)
+		return
+	}
+	if arc.Type != File || arc.Mode != 0600 || arc.ModTime != modTime.Unix() {
+		t.Errorf("Unexpected archive metadata: %+v", arc)
+	}
+	if arc.Size != uint64(len(data)) || snapshot.Stats.Size != uint64(len(data)) || snapshot.Stats.Files != 1 {
+		t.Errorf("Expected a size of %d bytes, got %d (snapshot stats: %+v)", len(data), arc.Size, snapshot.Stats)
+	}
+	if len(arc.Chunks) < 2 {
+		t.Errorf("Expected the data to be split into several chunks, got %d", len(arc.Chunks))
+	}
+
+	b, _, err := DecodeArchiveData(r, *arc)
+	if err != nil {
+		t.Errorf("Failed decoding archive: %s", err)
+		return
+	}
+	if !bytes.Equal(b, data) {
+		t.Errorf("Decoded data doesn't match the stored data")
+	}
+
+	snapshot, _ = NewSnapshot("test_snapshot")
+	progress = snapshot.AddReader(r, &index, bytes.NewReader(data), ReaderOptions{Path: ""}, opts)
+	err = nil
+	for p := range progress {
+		if p.Error != nil {
+			err = p.Error
+		}
+	}
+	if err != ErrInvalidArchivePath {
+		t.Errorf("Expected %v, got %v", ErrInvalidArchivePath, err)
+	}
+}
+
+func TestSnapshotHardLinks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Hard links aren't detected on Windows")
+	}
+	testPassword := "this_is_a_password"
+
+	srcdir, err := ioutil.TempDir("", "knoxite.source")
+	if err != nil {
+		t.Errorf("Failed creating temporary dir for source: %s", err)
+		return
+	}
+	defer os.RemoveAll(srcdir)
+
+	err = ioutil.WriteFile(filepath.Join(srcdir, "a"), []byte("content"), 0644)
+	if err != nil {
+		t.Errorf("Failed writing test file: %s", err)
+		return
+	}
+	for _, name := range []string{"b", "c"} {
+		err = os.Link(filepath.Join(srcdir, "a"), filepath.Join(srcdir, name))
+		if err != nil {
+			t.Errorf("Failed creating hard link: %s", err)
+			return
+		}
+	}
+
+	dir, err := ioutil.TempDir("", "knoxite")
+	if err != nil {
+		t.Errorf("Failed creating temporary dir for repository: %s", err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	r, err := NewRepository(dir, testPassword)
+	if err != nil {
+		t.Errorf("Failed creating repository: %s", err)
+		return
+	}
+	index, err := OpenChunkIndex(&r)
+	if err != nil {
+		t.Errorf("Failed opening chunk-index: %s", err)
+		return
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Errorf("Failed getting working dir: %s", err)
+		return
+	}
+
+	snapshot, _ := NewSnapshot("test_snapshot")
+	progress := snapshot.Add(r, &index, StoreOptions{
+		CWD:       wd,
+		Paths:     []string{srcdir},
+		Encrypt:   EncryptionAES,
+		DataParts: 1,
+	})
+	for p := range progress {
+		if p.Error != nil {
+			t.Errorf("Failed adding to snapshot: %s", p.Error)
+			return
+		}
+	}
+
+	var first *Archive
+	links := 0
+	for _, arc := range snapshot.Archives {
+		if arc.Type != File {
+			continue
+		}
+		if arc.LinkTo == "" {
+			if first != nil {
+				t.Errorf("Expected only one file without a hard link, got %s and %s", first.Path, arc.Path)
+			}
+			first = arc
+			continue
+		}
+		links++
+	}
+	if first == nil || links != 2 {
+		t.Errorf("Expected one file and two hard links, got %d hard links", links)
+		return
+	}
+	for _, arc := range snapshot.Archives {
+		if arc.LinkTo != "" && (arc.LinkTo != first.Path || len(arc.Chunks) != len(first.Chunks)) {
+			t.Errorf("Expected hard link %s to refer to %s, got %+v", arc.Path, first.Path, arc)
+		}
+	}
+
+	targetdir, err := ioutil.TempDir("", "knoxite.target")
+	if err != nil {
+		t.Errorf("Failed creating temporary dir for restore: %s", err)
+		return
+	}
+	defer os.RemoveAll(targetdir)
+
+	progress, err = DecodeSnapshot(r, snapshot, targetdir, []string{}, false)
+	if err != nil {
+		t.Errorf("Failed restoring snapshot: %s", err)
+		return
+	}
+	for p := range progress {
+		if p.Error != nil {
+			t.Errorf("Failed restoring snapshot: %s", p.Error)
+		}
+	}
+
+	fi1, err := os.Stat(filepath.Join(targetdir, first.Path))
+	if err != nil {
+		t.Errorf("Failed to stat restored file: %s", err)
+		return
+	}
+	for _, arc := range snapshot.Archives {
+		if arc.LinkTo == "" {
+			continue
+		}
+		fi2, err := os.Stat(filepath.Join(targetdir, arc.Path))
+		if err != nil {
+			t.Errorf("Failed to stat restored file: %s", err)
+			continue
+		}
+		if !os.SameFile(fi1, fi2) {
+			t.Errorf("Expected %s to be restored as a hard link", arc.Path)
+		}
+	}
+
+	// without the file they link to, hard links get restored as regular files
+	targetdir2, err := ioutil.TempDir("", "knoxite.target")
+	if err != nil {
+		t.Errorf("Failed creating temporary dir for restore: %s", err)
+		return
+	}
+	defer os.RemoveAll(targetdir2)
+
+	progress, err = DecodeSnapshot(r, snapshot, targetdir2, []string{first.Path}, false)
+	if err != nil {
+		t.Errorf("Failed restoring snapshot: %s", err)
+		return
+	}
+	for p := range progress {
+		if p.Error != nil {
+			t.Errorf("Failed restoring snapshot: %s", p.Error)
+		}
+	}
+	for _, arc := range snapshot.Archives {
+		if arc.LinkTo == "" {
+			continue
+		}
+		b, err := ioutil.ReadFile(filepath.Join(targetdir2, arc.Path))
+		if err != nil || string(b) != "content" {
+			t.Errorf("Expected %s to be restored with its content, got %q (%v)", arc.Path, b, err)
+		}
+	}
+}
+
+func TestSnapshotRestoreMetadata(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Permissions and symlinks differ on Windows")
+	}
+	testPassword := "this_is_a_password"
+	modTime := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	dirModTime := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	srcdir, err := ioutil.TempDir("", "knoxite.source")
+	if err != nil {
+		t.Errorf("Failed creating temporary dir for source: %s", err)
+		return
+	}
+	defer os.RemoveAll(srcdir)
+
+	// a read-only directory containing a file and a symlink
+	ro := filepath.Join(srcdir, "ro")
+	err = os.Mkdir(ro, 0755)
+	if err != nil {
+		t.Errorf("Failed creating test dir: %s", err)
+		return
+	}
+	err = ioutil.WriteFile(filepath.Join(ro, "file"), []byte("content"), 0640)
+	if err != nil {
+		t.Errorf("Failed writing test file: %s", err)
+		return
+	}
+	err = os.Chmod(filepath.Join(ro, "file"), 0640)
+	if err != nil {
+		t.Errorf("Failed changing permissions of test file: %s", err)
+		return
+	}
+	err = os.Symlink("file", filepath.Join(ro, "link"))
+	if err != nil {
+		t.Errorf("Failed creating symlink: %s", err)
+		return
+	}
+	for _, name := range []string{"file", "link"} {
+		err = lchtimes(filepath.Join(ro, name), modTime)
+		if err != nil {
+			t.Errorf("Failed changing times of %s: %s", name, err)
+			return
+		}
+	}
+	err = os.Chmod(ro, 0555)
+	if err != nil {
+		t.Errorf("Failed changing permissions of test dir: %s", err)
+		return
+	}
+	defer os.Chmod(ro, 0755)
+	err = os.Chtimes(ro, dirModTime, dirModTime)
+	if err != nil {
+		t.Errorf("Failed changing times of test dir: %s", err)
+		return
+	}
+
+	dir, err := ioutil.TempDir("", "knoxite")
+	if err != nil {
+		t.Errorf("Failed creating temporary dir for repository: %s", err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	r, err := NewRepository(dir, testPassword)
+	if err != nil {
+		t.Errorf("Failed creating repository: %s", err)
+		return
+	}
+	index, err := OpenChunkIndex(&r)
+	if err != nil {
+		t.Errorf("Failed opening chunk-index: %s", err)
+		return
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Errorf("Failed getting working dir: %s", err)
+		return
+	}
+
+	snapshot, _ := NewSnapshot("test_snapshot")
+	progress := snapshot.Add(r, &index, StoreOptions{
+		CWD:       wd,
+		Paths:     []string{ro},
+		Encrypt:   EncryptionAES,
+		DataParts: 1,
+	})
+	for p := range progress {
+		if p.Error != nil {
+			t.Errorf("Failed adding to snapshot: %s", p.Error)
+			return
+		}
+	}
+
+	var rodir string
+	for _, arc := range snapshot.Archives {
+		if arc.Type == Directory {
+			rodir = arc.Path
+		}
+	}
+
+	targetdir, err := ioutil.TempDir("", "knoxite.target")
+	if err != nil {
+		t.Errorf("Failed creating temporary dir for restore: %s", err)
+		return
+	}
+	defer os.RemoveAll(targetdir)
+	defer os.Chmod(filepath.Join(targetdir, rodir), 0755)
+
+	progress, err = DecodeSnapshotWithOptions(r, snapshot, targetdir, RestoreOptions{})
+	if err != nil {
+		t.Errorf("Failed restoring snapshot: %s", err)
+		return
+	}
+	for p := range progress {
+		if p.Error != nil {
+			t.Errorf("Failed restoring snapshot: %s", p.Error)
+		}
+	}
+
+	tests := []struct {
+		path    string
+		mode    os.FileMode
+		modTime time.Time
+	}{
+		{rodir, os.ModeDir | 0555, dirModTime},
+		{filepath.Join(rodir, "file"), 0640, modTime},
+		{filepath.Join(rodir, "link"), os.ModeSymlink, modTime},
+	}
+	for _, tt := range tests {
+		fi, err := os.Lstat(filepath.Join(targetdir, tt.path))
+		if err != nil {
+			t.Errorf("Failed to stat restored %s: %s", tt.path, err)
+			continue
+		}
+		if tt.mode != os.ModeSymlink && fi.Mode() != tt.mode {
+			t.Errorf("Expected %s to have mode %s, got %s", tt.path, tt.mode, fi.Mode())
+		}
+		if tt.mode == os.ModeSymlink && fi.Mode()&os.ModeSymlink == 0 {
+			t.Errorf("Expected %s to be a symlink, got %s", tt.path, fi.Mode())
+		}
+		if !fi.ModTime().Equal(tt.modTime) {
+			t.Errorf("Expected %s to have modification time %v, got %v", tt.path, tt.modTime, fi.ModTime())
+		}
+	}
+}
+
+func TestSnapshotSparseFile(t *testing.T) {
+	testPassword := "this_is_a_password"
+
+	dir, err := ioutil.TempDir("", "knoxite")
+	if err != nil {
+		t.Errorf("Failed creating temporary dir for repository: %s", err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	r, err := NewRepository(dir, testPassword)
+	if err != nil {
+		t.Errorf("Failed creating repository: %s", err)
+		return
+	}
+	index, err := OpenChunkIndex(&r)
+	if err != nil {
+		t.Errorf("Failed opening chunk-index: %s", err)
+		return
+	}
+
+	// some data surrounded by holes
+	data := make([]byte, 8*r.Chunker.MaxSize)
+	_, _ = rand.Read(data[3*r.Chunker.MaxSize : 4*r.Chunker.MaxSize])
+
+	opts := StoreOptions{
+		Encrypt:   EncryptionAESGCM,
+		DataParts: 1,
+	}
+	snapshot, _ := NewSnapshot("test_snapshot")
+	progress := snapshot.AddReader(r, &index, bytes.NewReader(data), ReaderOptions{Path: "disk.img"}, opts)
+	for p := range progress {
+		if p.Error != nil {
+			t.Errorf("Failed adding reader to snapshot: %s", p.Error)
+			return
+		}
+	}
+
+	arc := snapshot.Archives["disk.img"]
+	var sparse uint64
+	for _, chunk := range arc.Chunks {
+		if chunk.Sparse {
+			sparse += uint64(chunk.OriginalSize)
+			if _, ok := index.Chunks[chunk.Hash]; ok {
+				t.Errorf("Expected sparse chunk #%d not to be in the chunk-index", chunk.Num)
+			}
+		}
+	}
+	if sparse < uint64(6*r.Chunker.MaxSize) || snapshot.Stats.Sparse != sparse {
+		t.Errorf("Expected at least %d bytes in sparse chunks, got %d (snapshot stats: %+v)", 6*r.Chunker.MaxSize, sparse, snapshot.Stats)
+	}
+	if arc.StorageSize > uint64(2*r.Chunker.MaxSize) {
+		t.Errorf("Expected holes not to be stored, got a storage size of %d", arc.StorageSize)
+	}
+
+	targetdir, err := ioutil.TempDir("", "knoxite.target")
+	if err != nil {
+		t.Errorf("Failed creating temporary dir for restore: %s", err)
+		return
+	}
+	defer os.RemoveAll(targetdir)
+
+	progress, err = DecodeSnapshot(r, snapshot, targetdir, []string{}, false)
+	if err != nil {
+		t.Errorf("Failed restoring snapshot: %s", err)
+		return
+	}
+	for p := range progress {
+		if p.Error != nil {
+			t.Errorf("Failed restoring snapshot: %s", p.Error)
+		}
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(targetdir, "disk.img"))
+	if err != nil {
+		t.Errorf("Failed reading restored file: %s", err)
+		return
+	}
+	if !bytes.Equal(b, data) {
+		t.Errorf("Restored data doesn't match the stored data")
+	}
+}
@@ -0,0 +1,14 @@
+/*
+ * knoxite
+ *     Copyright (c) 2016-2021, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package knoxite
+
+import "golang.org/x/sys/unix"
+
+func makeNode(path string, mode uint32, dev uint64) error {
+	return unix.Mknod(path, mode, dev)
+}
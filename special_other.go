@@ -0,0 +1,22 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+/*
+ * knoxite
+ *     Copyright (c) 2016-2021, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package knoxite
+
+// deviceNumbers splits a device number into its major and minor number.
+func deviceNumbers(rdev uint64) (uint32, uint32) {
+	return 0, 0
+}
+
+// mknod recreates the device node, FIFO or socket described by arc at path,
+// which isn't supported on this platform.
+func mknod(path string, arc Archive) error {
+	return ErrSpecialFilesUnsupported
+}
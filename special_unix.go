@@ -0,0 +1,43 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build darwin dragonfly freebsd linux netbsd openbsd solaris
+
+/*
+ * knoxite
+ *     Copyright (c) 2016-2021, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package knoxite
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// deviceNumbers splits a device number into its major and minor number.
+func deviceNumbers(rdev uint64) (uint32, uint32) {
+	return unix.Major(rdev), unix.Minor(rdev)
+}
+
+// mknod recreates the device node, FIFO or socket described by arc at path.
+// Only root is allowed to create device nodes.
+func mknod(path string, arc Archive) error {
+	var mode uint32
+	switch arc.Type {
+	case CharDevice:
+		mode = unix.S_IFCHR
+	case BlockDevice:
+		mode = unix.S_IFBLK
+	case FIFO:
+		mode = unix.S_IFIFO
+	case Socket:
+		mode = unix.S_IFSOCK
+	}
+	if (arc.Type == CharDevice || arc.Type == BlockDevice) && os.Geteuid() != 0 {
+		return ErrDeviceNodesRequireRoot
+	}
+
+	return makeNode(path, mode|uint32(arc.Mode.Perm()), unix.Mkdev(arc.DevMajor, arc.DevMinor))
+}
@@ -0,0 +1,131 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build darwin dragonfly freebsd linux netbsd openbsd solaris
+
+/*
+ * knoxite
+ *     Copyright (c) 2016-2021, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package knoxite
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestSpecialFiles(t *testing.T) {
+	testPassword := "this_is_a_password"
+
+	srcdir, err := ioutil.TempDir("", "knoxite.source")
+	if err != nil {
+		t.Errorf("Failed creating temporary dir for source: %s", err)
+		return
+	}
+	defer os.RemoveAll(srcdir)
+
+	fifo := filepath.Join(srcdir, "fifo")
+	err = unix.Mkfifo(fifo, 0600)
+	if err != nil {
+		t.Errorf("Failed creating FIFO: %s", err)
+		return
+	}
+	// the same device numbers as /dev/null on Linux, only root may create it
+	device := filepath.Join(srcdir, "null")
+	err = makeNode(device, unix.S_IFCHR|0666, unix.Mkdev(1, 3))
+	hasDevice := err == nil
+
+	dir, err := ioutil.TempDir("", "knoxite")
+	if err != nil {
+		t.Errorf("Failed creating temporary dir for repository: %s", err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	r, err := NewRepository(dir, testPassword)
+	if err != nil {
+		t.Errorf("Failed creating repository: %s", err)
+		return
+	}
+	index, err := OpenChunkIndex(&r)
+	if err != nil {
+		t.Errorf("Failed opening chunk-index: %s", err)
+		return
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Errorf("Failed getting working dir: %s", err)
+		return
+	}
+
+	snapshot, _ := NewSnapshot("test_snapshot")
+	progress := snapshot.Add(r, &index, StoreOptions{
+		CWD:       wd,
+		Paths:     []string{srcdir},
+		Encrypt:   EncryptionAES,
+		DataParts: 1,
+	})
+	for p := range progress {
+		if p.Error != nil {
+			t.Errorf("Failed adding to snapshot: %s", p.Error)
+			return
+		}
+	}
+
+	archives := make(map[string]*Archive)
+	for _, arc := range snapshot.Archives {
+		archives[filepath.Base(arc.Path)] = arc
+	}
+	if arc, ok := archives["fifo"]; !ok || arc.Type != FIFO {
+		t.Errorf("Expected the snapshot to contain a FIFO, got %+v", arc)
+		return
+	}
+	if hasDevice {
+		arc, ok := archives["null"]
+		if !ok || arc.Type != CharDevice || arc.DevMajor != 1 || arc.DevMinor != 3 {
+			t.Errorf("Expected the snapshot to contain character device 1:3, got %+v", arc)
+			return
+		}
+	}
+
+	targetdir, err := ioutil.TempDir("", "knoxite.target")
+	if err != nil {
+		t.Errorf("Failed creating temporary dir for restore: %s", err)
+		return
+	}
+	defer os.RemoveAll(targetdir)
+
+	progress, err = DecodeSnapshot(r, snapshot, targetdir, []string{}, false)
+	if err != nil {
+		t.Errorf("Failed restoring snapshot: %s", err)
+		return
+	}
+	for p := range progress {
+		if p.Error != nil {
+			t.Errorf("Failed restoring snapshot: %s", p.Error)
+		}
+	}
+
+	fi, err := os.Lstat(filepath.Join(targetdir, archives["fifo"].Path))
+	if err != nil {
+		t.Errorf("Failed to stat restored FIFO: %s", err)
+	} else if fi.Mode()&os.ModeNamedPipe == 0 || fi.Mode().Perm() != 0600 {
+		t.Errorf("Expected a FIFO with mode 0600, got %s", fi.Mode())
+	}
+
+	if hasDevice {
+		var st unix.Stat_t
+		err = unix.Lstat(filepath.Join(targetdir, archives["null"].Path), &st)
+		if err != nil {
+			t.Errorf("Failed to stat restored device node: %s", err)
+		} else if st.Mode&unix.S_IFMT != unix.S_IFCHR || unix.Major(uint64(st.Rdev)) != 1 || unix.Minor(uint64(st.Rdev)) != 3 {
+			t.Errorf("Expected character device 1:3, got mode %o and device %d", st.Mode, st.Rdev)
+		}
+	}
+}
@@ -0,0 +1,13 @@
+//go:build linux || dragonfly || openbsd || solaris
+// +build linux dragonfly openbsd solaris
+
+/*
+ * knoxite
+ *     Copyright (c) 2016-2021, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package knoxite
+
+func (s statUnix) ctime() int64 { return s.Ctim.Nano() }
@@ -0,0 +1,20 @@
+//go:build darwin || dragonfly || freebsd || netbsd || openbsd
+// +build darwin dragonfly freebsd netbsd openbsd
+
+/*
+ * knoxite
+ *     Copyright (c) 2016-2021, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package knoxite
+
+import "golang.org/x/sys/unix"
+
+func (s statUnix) flags() uint32 { return s.Flags }
+
+// setFlags sets the file flags of path, e.g. the immutable flag.
+func setFlags(path string, flags uint32) error {
+	return unix.Chflags(path, int(flags))
+}
@@ -0,0 +1,17 @@
+//go:build !darwin && !dragonfly && !freebsd && !netbsd && !openbsd
+// +build !darwin,!dragonfly,!freebsd,!netbsd,!openbsd
+
+/*
+ * knoxite
+ *     Copyright (c) 2016-2021, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package knoxite
+
+// setFlags sets the file flags of path, which aren't supported on this
+// platform, so they get skipped.
+func setFlags(path string, flags uint32) error {
+	return nil
+}
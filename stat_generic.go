@@ -15,4 +15,6 @@ type statT interface {
 	gid() uint32
 	rdev() uint64
 	size() int64
+	ctime() int64  // inode change time in nanoseconds
+	flags() uint32 // file flags, e.g. immutable
 }
@@ -0,0 +1,13 @@
+//go:build linux || solaris
+// +build linux solaris
+
+/*
+ * knoxite
+ *     Copyright (c) 2016-2021, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package knoxite
+
+func (s statUnix) flags() uint32 { return 0 }
@@ -30,6 +30,8 @@ func (s statWin) nlink() uint64 { return 0 }
 func (s statWin) uid() uint32   { return 0 }
 func (s statWin) gid() uint32   { return 0 }
 func (s statWin) rdev() uint64  { return 0 }
+func (s statWin) ctime() int64  { return 0 }
+func (s statWin) flags() uint32 { return 0 }
 
 func (s statWin) size() int64 {
 	return int64(s.FileSizeLow) | (int64(s.FileSizeHigh) << 32)
@@ -13,13 +13,18 @@ import (
 
 // Stats contains a bunch of Stats counters.
 type Stats struct {
-	Files       uint64 `json:"files"`
-	Dirs        uint64 `json:"dirs"`
-	SymLinks    uint64 `json:"symlinks"`
-	Size        uint64 `json:"size"`
-	StorageSize uint64 `json:"stored_size"`
-	Transferred uint64 `json:"transferred"`
-	Errors      uint64 `json:"errors"`
+	Files        uint64 `json:"files"`
+	Dirs         uint64 `json:"dirs"`
+	SymLinks     uint64 `json:"symlinks"`
+	Size         uint64 `json:"size"`
+	StorageSize  uint64 `json:"stored_size"`
+	Transferred  uint64 `json:"transferred"`  // size of the original data processed
+	Uploaded     uint64 `json:"uploaded"`     // size of the encoded data sent to the backends
+	New          uint64 `json:"new"`          // size of data which hasn't been stored before
+	Deduplicated uint64 `json:"deduplicated"` // size of data which was already stored
+	Reused       uint64 `json:"reused"`       // size of unchanged files reused from a parent snapshot
+	Sparse       uint64 `json:"sparse"`       // size of zeros, which didn't need to be stored
+	Errors       uint64 `json:"errors"`
 }
 
 // Add accumulates other into s.
@@ -30,6 +35,11 @@ func (s *Stats) Add(other Stats) {
 	s.Size += other.Size
 	s.StorageSize += other.StorageSize
 	s.Transferred += other.Transferred
+	s.Uploaded += other.Uploaded
+	s.New += other.New
+	s.Deduplicated += other.Deduplicated
+	s.Reused += other.Reused
+	s.Sparse += other.Sparse
 	s.Errors += other.Errors
 }
 
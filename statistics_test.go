@@ -20,6 +20,7 @@ func TestStatisticsAdd(t *testing.T) {
 			Size:        i,
 			StorageSize: i,
 			Transferred: i,
+			Uploaded:    i,
 			Errors:      i,
 		}
 
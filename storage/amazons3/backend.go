@@ -9,7 +9,9 @@ package amazons3
 
 import (
 	"bytes"
+	"fmt"
 	"io/ioutil"
+	"strings"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/s3"
@@ -57,6 +59,21 @@ func (backend *AmazonS3StorageBackend) ReadFile(path string) ([]byte, error) {
 	return resultBytes, nil
 }
 
+// ReadFileRange reads length bytes starting at offset from a file.
+func (backend *AmazonS3StorageBackend) ReadFileRange(path string, offset, length uint64) ([]byte, error) {
+	result, err := backend.service.GetObject(&s3.GetObjectInput{
+		Key:    aws.String(path),
+		Bucket: aws.String(backend.bucketName),
+		Range:  aws.String(fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer result.Body.Close()
+
+	return ioutil.ReadAll(result.Body)
+}
+
 // WriteFile writes a file to the storage backend.
 func (backend *AmazonS3StorageBackend) WriteFile(path string, data []byte) (uint64, error) {
 	databuf := bytes.NewReader(data)
@@ -112,3 +129,31 @@ func (*AmazonS3StorageBackend) AvailableSpace() (uint64, error) {
 	// Amazon S3 doesn't constrain bucket size, so we treat it as unlimited storage
 	return 0, knoxite.ErrAvailableSpaceUnlimited
 }
+
+// ReadDir returns the names of all objects within a folder-like prefix.
+func (backend *AmazonS3StorageBackend) ReadDir(path string) ([]string, error) {
+	prefix := strings.TrimSuffix(path, "/") + "/"
+	input := &s3.ListObjectsV2Input{
+		Bucket:    aws.String(backend.bucketName),
+		Prefix:    aws.String(prefix),
+		Delimiter: aws.String("/"),
+	}
+
+	names := []string{}
+	for {
+		out, err := backend.service.ListObjectsV2(input)
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range out.Contents {
+			names = append(names, strings.TrimPrefix(aws.StringValue(obj.Key), prefix))
+		}
+
+		if !aws.BoolValue(out.IsTruncated) {
+			break
+		}
+		input.ContinuationToken = out.NextContinuationToken
+	}
+
+	return names, nil
+}
@@ -10,6 +10,7 @@ package azure
 import (
 	"context"
 	"fmt"
+	"io/ioutil"
 	"net/url"
 	"path"
 	"strings"
@@ -173,6 +174,23 @@ func (backend *AzureFileStorage) ReadFile(p string) ([]byte, error) {
 	return bytes, nil
 }
 
+// ReadFileRange reads length bytes starting at offset from a file on Azure
+// file storage.
+func (backend *AzureFileStorage) ReadFileRange(p string, offset, length uint64) ([]byte, error) {
+	u := backend.endpoint
+	u.Path = path.Join(u.Path, p)
+
+	fileUrl := azfile.NewFileURL(u, azfile.NewPipeline(&backend.credential, azfile.PipelineOptions{}))
+	resp, err := fileUrl.Download(context.Background(), int64(offset), int64(length), false)
+	if err != nil {
+		return nil, err
+	}
+	body := resp.Body(azfile.RetryReaderOptions{})
+	defer body.Close()
+
+	return ioutil.ReadAll(body)
+}
+
 // WriteFile writes a file on Azure file storage.
 func (backend *AzureFileStorage) WriteFile(p string, data []byte) (size uint64, err error) {
 	u := backend.endpoint
@@ -204,3 +222,29 @@ func (backend *AzureFileStorage) DeleteFile(p string) error {
 	}
 	return nil
 }
+
+// ReadDir returns the names of all files in a dir on Azure file storage.
+func (backend *AzureFileStorage) ReadDir(p string) ([]string, error) {
+	u := backend.endpoint
+	u.Path = path.Join(u.Path, p)
+
+	directoryUrl := azfile.NewDirectoryURL(u, azfile.NewPipeline(&backend.credential, azfile.PipelineOptions{}))
+
+	names := []string{}
+	for marker := (azfile.Marker{}); marker.NotDone(); {
+		list, err := directoryUrl.ListFilesAndDirectoriesSegment(context.Background(), marker, azfile.ListFilesAndDirectoriesOptions{})
+		if err != nil {
+			if serr, ok := err.(azfile.StorageError); ok && serr.ServiceCode() == azfile.ServiceCodeResourceNotFound {
+				return []string{}, nil
+			}
+			return nil, err
+		}
+
+		for _, file := range list.FileItems {
+			names = append(names, file.Name)
+		}
+		marker = list.NextMarker
+	}
+
+	return names, nil
+}
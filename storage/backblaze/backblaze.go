@@ -23,11 +23,14 @@ import (
 
 // BackblazeStorage stores data on a remote Backblaze.
 type BackblazeStorage struct {
-	url            url.URL
-	repositoryFile string
-	chunkIndexFile string
-	Bucket         *backblaze.Bucket
-	backblaze      *backblaze.B2
+	url                url.URL
+	repositoryFile     string
+	chunkIndexFile     string
+	lockFilePrefix     string
+	indexSegmentPrefix string
+	packFilePrefix     string
+	Bucket             *backblaze.Bucket
+	backblaze          *backblaze.B2
 }
 
 func init() {
@@ -72,11 +75,14 @@ func (*BackblazeStorage) NewBackend(URL url.URL) (knoxite.Backend, error) {
 		}
 	}
 	return &BackblazeStorage{
-		url:            URL,
-		repositoryFile: bucketPrefix[1] + "-repository",
-		chunkIndexFile: bucketPrefix[1] + "-chunkindex",
-		Bucket:         bucket,
-		backblaze:      cl,
+		url:                URL,
+		repositoryFile:     bucketPrefix[1] + "-repository",
+		chunkIndexFile:     bucketPrefix[1] + "-chunkindex",
+		lockFilePrefix:     bucketPrefix[1] + "-lock-",
+		indexSegmentPrefix: bucketPrefix[1] + "-index-",
+		packFilePrefix:     bucketPrefix[1] + "-pack-",
+		Bucket:             bucket,
+		backblaze:          cl,
 	}, nil
 }
 
@@ -154,6 +160,56 @@ func (backend *BackblazeStorage) DeleteChunk(shasum string, part, totalParts uin
 	return err
 }
 
+// LoadPack loads length bytes starting at offset from a pack.
+func (backend *BackblazeStorage) LoadPack(id string, offset, length uint64) ([]byte, error) {
+	_, obj, err := backend.Bucket.DownloadFileRangeByName(backend.packFilePrefix+id, &backblaze.FileRange{
+		Start: int64(offset),
+		End:   int64(offset + length - 1),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer obj.Close()
+
+	return ioutil.ReadAll(obj)
+}
+
+// StorePack stores a pack on backblaze.
+func (backend *BackblazeStorage) StorePack(id string, data []byte) (uint64, error) {
+	fileName := backend.packFilePrefix + id
+
+	files, err := backend.findLatestFileVersion(fileName)
+	if err == nil && len(files) > 0 {
+		if files[0].Size == len(data) {
+			return 0, nil
+		}
+	}
+
+	buf := bytes.NewBuffer(data)
+	metadata := make(map[string]string)
+	file, err := backend.upload(fileName, metadata, buf)
+	if err != nil {
+		return 0, err
+	}
+	return uint64(file.ContentLength), nil
+}
+
+// DeletePack deletes a pack.
+func (backend *BackblazeStorage) DeletePack(id string) error {
+	fileName := backend.packFilePrefix + id
+
+	files, err := backend.findLatestFileVersion(fileName)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return knoxite.ErrDeletePackFailed
+	}
+
+	_, err = backend.Bucket.DeleteFileVersion(fileName, files[0].ID)
+	return err
+}
+
 // LoadSnapshot loads a snapshot.
 func (backend *BackblazeStorage) LoadSnapshot(id string) ([]byte, error) {
 	_, obj, err := backend.Bucket.DownloadFileByName("snapshot-" + id)
@@ -192,6 +248,20 @@ func (backend *BackblazeStorage) SaveChunkIndex(data []byte) error {
 	return err
 }
 
+// DeleteChunkIndex deletes the chunk-index.
+func (backend *BackblazeStorage) DeleteChunkIndex() error {
+	files, err := backend.findLatestFileVersion(backend.chunkIndexFile)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return knoxite.ErrDeleteChunkIndexFailed
+	}
+
+	_, err = backend.Bucket.DeleteFileVersion(backend.chunkIndexFile, files[0].ID)
+	return err
+}
+
 // InitRepository creates a new repository.
 func (backend *BackblazeStorage) InitRepository() error {
 	var placeholder []byte
@@ -268,3 +338,121 @@ func (backend *BackblazeStorage) upload(name string, meta map[string]string, fil
 
 	return backend.Bucket.UploadFile(name, meta, file)
 }
+
+// ListLocks returns the IDs of all locks.
+func (backend *BackblazeStorage) ListLocks() ([]string, error) {
+	prefix := backend.lockFilePrefix
+
+	ids := []string{}
+	next := ""
+	for {
+		list, err := backend.Bucket.ListFileNamesWithPrefix(next, 1000, prefix, "")
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range list.Files {
+			ids = append(ids, strings.TrimPrefix(v.Name, prefix))
+		}
+
+		if list.NextFileName == "" {
+			break
+		}
+		next = list.NextFileName
+	}
+
+	return ids, nil
+}
+
+// LoadLock loads a lock.
+func (backend *BackblazeStorage) LoadLock(id string) ([]byte, error) {
+	_, obj, err := backend.Bucket.DownloadFileByName(backend.lockFilePrefix + id)
+	if err != nil {
+		return nil, err
+	}
+	defer obj.Close()
+
+	return ioutil.ReadAll(obj)
+}
+
+// SaveLock stores a lock.
+func (backend *BackblazeStorage) SaveLock(id string, data []byte) error {
+	buf := bytes.NewBuffer(data)
+	metadata := make(map[string]string)
+	_, err := backend.upload(backend.lockFilePrefix+id, metadata, buf)
+	return err
+}
+
+// DeleteLock deletes a lock.
+func (backend *BackblazeStorage) DeleteLock(id string) error {
+	fileName := backend.lockFilePrefix + id
+
+	files, err := backend.findLatestFileVersion(fileName)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return knoxite.ErrDeleteLockFailed
+	}
+
+	_, err = backend.Bucket.DeleteFileVersion(fileName, files[0].ID)
+	return err
+}
+
+// ListIndexSegments returns the IDs of all chunk-index segments.
+func (backend *BackblazeStorage) ListIndexSegments() ([]string, error) {
+	prefix := backend.indexSegmentPrefix
+
+	ids := []string{}
+	next := ""
+	for {
+		list, err := backend.Bucket.ListFileNamesWithPrefix(next, 1000, prefix, "")
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range list.Files {
+			ids = append(ids, strings.TrimPrefix(v.Name, prefix))
+		}
+
+		if list.NextFileName == "" {
+			break
+		}
+		next = list.NextFileName
+	}
+
+	return ids, nil
+}
+
+// LoadIndexSegment loads a chunk-index segment.
+func (backend *BackblazeStorage) LoadIndexSegment(id string) ([]byte, error) {
+	_, obj, err := backend.Bucket.DownloadFileByName(backend.indexSegmentPrefix + id)
+	if err != nil {
+		return nil, err
+	}
+	defer obj.Close()
+
+	return ioutil.ReadAll(obj)
+}
+
+// SaveIndexSegment stores a chunk-index segment.
+func (backend *BackblazeStorage) SaveIndexSegment(id string, data []byte) error {
+	buf := bytes.NewBuffer(data)
+	metadata := make(map[string]string)
+	_, err := backend.upload(backend.indexSegmentPrefix+id, metadata, buf)
+	return err
+}
+
+// DeleteIndexSegment deletes a chunk-index segment.
+func (backend *BackblazeStorage) DeleteIndexSegment(id string) error {
+	fileName := backend.indexSegmentPrefix + id
+
+	files, err := backend.findLatestFileVersion(fileName)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return knoxite.ErrDeleteIndexSegmentFailed
+	}
+
+	_, err = backend.Bucket.DeleteFileVersion(fileName, files[0].ID)
+	return err
+}
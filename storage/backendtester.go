@@ -207,3 +207,115 @@ func (b *BackendTest) DeleteChunkTest(t *testing.T) {
 		t.Errorf("%s: Expected error, got nil", b.Description)
 	}
 }
+
+func (b *BackendTest) LockTest(t *testing.T) {
+	rnddata := make([]byte, 256)
+	rand.Read(rnddata)
+	id := RandomSuffix()
+
+	err := b.Backend.SaveLock(id, rnddata)
+	if err != nil {
+		t.Errorf("%s: %s", b.Description, err)
+	}
+
+	ids, err := b.Backend.ListLocks()
+	if err != nil {
+		t.Errorf("%s: %s", b.Description, err)
+	}
+	found := false
+	for _, v := range ids {
+		if v == id {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("%s: Lock %s not listed in %v", b.Description, id, ids)
+	}
+
+	data, err := b.Backend.LoadLock(id)
+	if err != nil {
+		t.Errorf("%s: %s", b.Description, err)
+	}
+	if !reflect.DeepEqual(data, rnddata) {
+		t.Errorf("%s: Data mismatch", b.Description)
+	}
+
+	err = b.Backend.DeleteLock(id)
+	if err != nil {
+		t.Errorf("%s: %s", b.Description, err)
+	}
+	_, err = b.Backend.LoadLock(id)
+	if err == nil {
+		t.Errorf("%s: Expected error, got nil", b.Description)
+	}
+}
+
+func (b *BackendTest) IndexSegmentTest(t *testing.T) {
+	rnddata := make([]byte, 256)
+	rand.Read(rnddata)
+	id := RandomSuffix()
+
+	err := b.Backend.SaveIndexSegment(id, rnddata)
+	if err != nil {
+		t.Errorf("%s: %s", b.Description, err)
+	}
+
+	ids, err := b.Backend.ListIndexSegments()
+	if err != nil {
+		t.Errorf("%s: %s", b.Description, err)
+	}
+	found := false
+	for _, v := range ids {
+		if v == id {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("%s: Index segment %s not listed in %v", b.Description, id, ids)
+	}
+
+	data, err := b.Backend.LoadIndexSegment(id)
+	if err != nil {
+		t.Errorf("%s: %s", b.Description, err)
+	}
+	if !reflect.DeepEqual(data, rnddata) {
+		t.Errorf("%s: Data mismatch", b.Description)
+	}
+
+	err = b.Backend.DeleteIndexSegment(id)
+	if err != nil {
+		t.Errorf("%s: %s", b.Description, err)
+	}
+	_, err = b.Backend.LoadIndexSegment(id)
+	if err == nil {
+		t.Errorf("%s: Expected error, got nil", b.Description)
+	}
+}
+
+func (b *BackendTest) PackTest(t *testing.T) {
+	rnddata := make([]byte, 256)
+	rand.Read(rnddata)
+	id := RandomSuffix()
+
+	_, err := b.Backend.StorePack(id, rnddata)
+	if err != nil {
+		t.Errorf("%s: %s", b.Description, err)
+	}
+
+	data, err := b.Backend.LoadPack(id, 64, 128)
+	if err != nil {
+		t.Errorf("%s: %s", b.Description, err)
+	}
+	if !reflect.DeepEqual(data, rnddata[64:192]) {
+		t.Errorf("%s: Data mismatch", b.Description)
+	}
+
+	err = b.Backend.DeletePack(id)
+	if err != nil {
+		t.Errorf("%s: %s", b.Description, err)
+	}
+	_, err = b.Backend.LoadPack(id, 0, 1)
+	if err == nil {
+		t.Errorf("%s: Expected error, got nil", b.Description)
+	}
+}
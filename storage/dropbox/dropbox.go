@@ -10,8 +10,10 @@ package dropbox
 
 import (
 	"bytes"
+	"io"
 	"io/ioutil"
 	"net/url"
+	"strings"
 
 	"github.com/tj/go-dropbox"
 	"github.com/tj/go-dropy"
@@ -104,6 +106,20 @@ func (backend *DropboxStorage) ReadFile(path string) ([]byte, error) {
 	return ioutil.ReadAll(file)
 }
 
+// ReadFileRange reads length bytes starting at offset from a file on dropbox.
+// Dropbox doesn't support ranged downloads, so the entire file gets fetched.
+func (backend *DropboxStorage) ReadFileRange(path string, offset, length uint64) ([]byte, error) {
+	b, err := backend.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if offset+length > uint64(len(b)) {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	return b[offset : offset+length], nil
+}
+
 // WriteFile write files on dropbox.
 func (backend *DropboxStorage) WriteFile(path string, data []byte) (size uint64, err error) {
 	return uint64(len(data)), backend.dropy.Upload(path, bytes.NewReader(data))
@@ -113,3 +129,20 @@ func (backend *DropboxStorage) WriteFile(path string, data []byte) (size uint64,
 func (backend *DropboxStorage) DeleteFile(path string) error {
 	return backend.dropy.Delete(path)
 }
+
+// ReadDir returns the names of all files in a dir on dropbox.
+func (backend *DropboxStorage) ReadDir(path string) ([]string, error) {
+	files, err := backend.dropy.ListFiles(path)
+	if err != nil {
+		if strings.Contains(err.Error(), "not_found") {
+			return []string{}, nil
+		}
+		return nil, err
+	}
+
+	names := []string{}
+	for _, file := range files {
+		names = append(names, file.Name())
+	}
+	return names, nil
+}
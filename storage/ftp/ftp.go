@@ -12,8 +12,10 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net"
+	"net/textproto"
 	"net/url"
 	"path/filepath"
 	"strings"
@@ -143,6 +145,19 @@ func (backend *FTPStorage) ReadFile(path string) ([]byte, error) {
 	return ioutil.ReadAll(file)
 }
 
+// ReadFileRange reads length bytes starting at offset from a file on ftp.
+func (backend *FTPStorage) ReadFileRange(path string, offset, length uint64) ([]byte, error) {
+	file, err := backend.ftp.RetrFrom(path, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	b := make([]byte, length)
+	_, err = io.ReadFull(file, b)
+	return b, err
+}
+
 // WriteFile writes file to ftp.
 func (backend *FTPStorage) WriteFile(path string, data []byte) (size uint64, err error) {
 	err = backend.ftp.Stor(path, bytes.NewReader(data))
@@ -199,3 +214,22 @@ func (backend *FTPStorage) DeletePath(path string) error {
 
 	return nil
 }
+
+// ReadDir returns the names of all files in a dir on ftp.
+func (backend *FTPStorage) ReadDir(path string) ([]string, error) {
+	list, err := backend.ftp.List(path)
+	if err != nil {
+		if terr, ok := err.(*textproto.Error); ok && terr.Code == ftp.StatusFileUnavailable {
+			return []string{}, nil
+		}
+		return nil, err
+	}
+
+	names := []string{}
+	for _, l := range list {
+		if l.Type == ftp.EntryTypeFile {
+			names = append(names, l.Name)
+		}
+	}
+	return names, nil
+}
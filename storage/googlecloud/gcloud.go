@@ -17,6 +17,7 @@ import (
 	"strings"
 
 	"cloud.google.com/go/storage"
+	"google.golang.org/api/iterator"
 	"google.golang.org/api/option"
 
 	"github.com/knoxite/knoxite"
@@ -163,6 +164,25 @@ func (backend *GoogleCloudStorage) ReadFile(path string) ([]byte, error) {
 	return data, nil
 }
 
+// ReadFileRange reads length bytes starting at offset from a file on Google
+// Cloud Storage.
+func (backend *GoogleCloudStorage) ReadFileRange(path string, offset, length uint64) ([]byte, error) {
+	reader, err := backend.bucket.Object(path).NewRangeReader(context.Background(), int64(offset), int64(length))
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	err = reader.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
 // WriteFile writes a file on Google Cloud Storage.
 func (backend *GoogleCloudStorage) WriteFile(path string, data []byte) (size uint64, err error) {
 	writer := backend.bucket.Object(path).NewWriter(context.Background())
@@ -189,3 +209,31 @@ func (backend *GoogleCloudStorage) DeleteFile(path string) error {
 	}
 	return nil
 }
+
+// ReadDir returns the names of all files in a folder on Google Cloud Storage.
+func (backend *GoogleCloudStorage) ReadDir(path string) ([]string, error) {
+	prefix := strings.TrimSuffix(path, "/") + "/"
+	it := backend.bucket.Objects(context.Background(), &storage.Query{
+		Prefix:    prefix,
+		Delimiter: "/",
+	})
+
+	names := []string{}
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		// objects within sub-folders only show up with their common prefix
+		if attrs.Name == "" {
+			continue
+		}
+
+		names = append(names, strings.TrimPrefix(attrs.Name, prefix))
+	}
+
+	return names, nil
+}
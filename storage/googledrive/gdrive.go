@@ -69,6 +69,21 @@ func (backend *GoogleDriveStorage) DeleteChunk(shasum string, parts, totalParts
 	return knoxite.ErrDeleteChunkFailed
 }
 
+// LoadPack loads length bytes starting at offset from a pack.
+func (backend *GoogleDriveStorage) LoadPack(id string, offset, length uint64) ([]byte, error) {
+	return []byte{}, knoxite.ErrLoadPackFailed
+}
+
+// StorePack stores a pack on Google Drive.
+func (backend *GoogleDriveStorage) StorePack(id string, data []byte) (uint64, error) {
+	return 0, knoxite.ErrStorePackFailed
+}
+
+// DeletePack deletes a pack.
+func (backend *GoogleDriveStorage) DeletePack(id string) error {
+	return knoxite.ErrDeletePackFailed
+}
+
 // LoadSnapshot loads a snapshot.
 func (backend *GoogleDriveStorage) LoadSnapshot(id string) ([]byte, error) {
 	return []byte{}, knoxite.ErrSnapshotNotFound
@@ -89,6 +104,11 @@ func (backend *GoogleDriveStorage) SaveChunkIndex(data []byte) error {
 	return knoxite.ErrStoreChunkIndexFailed
 }
 
+// DeleteChunkIndex deletes the chunk-index.
+func (backend *GoogleDriveStorage) DeleteChunkIndex() error {
+	return knoxite.ErrDeleteChunkIndexFailed
+}
+
 // InitRepository creates a new repository.
 func (backend *GoogleDriveStorage) InitRepository() error {
 	return knoxite.ErrInvalidRepositoryURL
@@ -103,3 +123,43 @@ func (backend *GoogleDriveStorage) LoadRepository() ([]byte, error) {
 func (backend *GoogleDriveStorage) SaveRepository(data []byte) error {
 	return knoxite.ErrStoreRepositoryFailed
 }
+
+// ListLocks returns the IDs of all locks.
+func (backend *GoogleDriveStorage) ListLocks() ([]string, error) {
+	return []string{}, knoxite.ErrLoadLockFailed
+}
+
+// LoadLock loads a lock.
+func (backend *GoogleDriveStorage) LoadLock(id string) ([]byte, error) {
+	return []byte{}, knoxite.ErrLoadLockFailed
+}
+
+// SaveLock stores a lock.
+func (backend *GoogleDriveStorage) SaveLock(id string, data []byte) error {
+	return knoxite.ErrStoreLockFailed
+}
+
+// DeleteLock deletes a lock.
+func (backend *GoogleDriveStorage) DeleteLock(id string) error {
+	return knoxite.ErrDeleteLockFailed
+}
+
+// ListIndexSegments returns the IDs of all chunk-index segments.
+func (backend *GoogleDriveStorage) ListIndexSegments() ([]string, error) {
+	return []string{}, knoxite.ErrLoadIndexSegmentFailed
+}
+
+// LoadIndexSegment loads a chunk-index segment.
+func (backend *GoogleDriveStorage) LoadIndexSegment(id string) ([]byte, error) {
+	return []byte{}, knoxite.ErrLoadIndexSegmentFailed
+}
+
+// SaveIndexSegment stores a chunk-index segment.
+func (backend *GoogleDriveStorage) SaveIndexSegment(id string, data []byte) error {
+	return knoxite.ErrStoreIndexSegmentFailed
+}
+
+// DeleteIndexSegment deletes a chunk-index segment.
+func (backend *GoogleDriveStorage) DeleteIndexSegment(id string) error {
+	return knoxite.ErrDeleteIndexSegmentFailed
+}
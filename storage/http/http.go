@@ -16,6 +16,7 @@ import (
 	"net/http"
 	"net/url"
 	"strconv"
+	"strings"
 
 	"github.com/knoxite/knoxite"
 )
@@ -121,6 +122,80 @@ func (backend *HTTPStorage) DeleteChunk(shasum string, parts, totalParts uint) e
 	return knoxite.ErrDeleteChunkFailed
 }
 
+// LoadPack loads length bytes starting at offset from a pack.
+func (backend *HTTPStorage) LoadPack(id string, offset, length uint64) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, backend.URL.String()+"/pack/"+id, nil)
+	if err != nil {
+		return []byte{}, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return []byte{}, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusPartialContent {
+		return []byte{}, knoxite.ErrLoadPackFailed
+	}
+
+	return ioutil.ReadAll(res.Body)
+}
+
+// StorePack stores a pack on network.
+func (backend *HTTPStorage) StorePack(id string, data []byte) (uint64, error) {
+	bodyBuf := &bytes.Buffer{}
+	bodyWriter := multipart.NewWriter(bodyBuf)
+
+	fileWriter, err := bodyWriter.CreateFormFile("uploadfile", id)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = fileWriter.Write(data)
+	if err != nil {
+		return 0, err
+	}
+
+	contentType := bodyWriter.FormDataContentType()
+	bodyWriter.Close()
+
+	resp, err := http.Post(backend.URL.String()+"/pack", contentType, bodyBuf)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, knoxite.ErrStorePackFailed
+	}
+	_, err = ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return 0, err
+	}
+
+	return uint64(len(data)), err
+}
+
+// DeletePack deletes a pack.
+func (backend *HTTPStorage) DeletePack(id string) error {
+	req, err := http.NewRequest(http.MethodDelete, backend.URL.String()+"/pack/"+id, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return knoxite.ErrDeletePackFailed
+	}
+	return nil
+}
+
 // LoadSnapshot loads a snapshot.
 func (backend *HTTPStorage) LoadSnapshot(id string) ([]byte, error) {
 	//	fmt.Printf("Fetching snapshot from: %s.\n", backend.URL+"/snapshot/"+id)
@@ -178,6 +253,9 @@ func (backend *HTTPStorage) LoadChunkIndex() ([]byte, error) {
 	}
 	defer res.Body.Close()
 
+	if res.StatusCode != http.StatusOK {
+		return nil, knoxite.ErrLoadChunkIndexFailed
+	}
 	return ioutil.ReadAll(res.Body)
 }
 
@@ -217,6 +295,24 @@ func (backend *HTTPStorage) SaveChunkIndex(data []byte) error {
 	return err
 }
 
+// DeleteChunkIndex deletes the chunk-index.
+func (backend *HTTPStorage) DeleteChunkIndex() error {
+	req, err := http.NewRequest(http.MethodDelete, backend.URL.String()+"/chunkindex", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return knoxite.ErrDeleteChunkIndexFailed
+	}
+	return nil
+}
+
 // InitRepository creates a new repository.
 func (backend *HTTPStorage) InitRepository() error {
 	return nil
@@ -269,3 +365,171 @@ func (backend *HTTPStorage) SaveRepository(data []byte) error {
 	//	fmt.Printf("Uploaded repository: %d bytes\n", len(data))
 	return err
 }
+
+// ListLocks returns the IDs of all locks.
+func (backend *HTTPStorage) ListLocks() ([]string, error) {
+	res, err := http.Get(backend.URL.String() + "/locks")
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, knoxite.ErrLoadLockFailed
+	}
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	return strings.Fields(string(b)), nil
+}
+
+// LoadLock loads a lock.
+func (backend *HTTPStorage) LoadLock(id string) ([]byte, error) {
+	res, err := http.Get(backend.URL.String() + "/lock/" + id)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, knoxite.ErrLoadLockFailed
+	}
+	return ioutil.ReadAll(res.Body)
+}
+
+// SaveLock stores a lock.
+func (backend *HTTPStorage) SaveLock(id string, data []byte) error {
+	bodyBuf := &bytes.Buffer{}
+	bodyWriter := multipart.NewWriter(bodyBuf)
+
+	fileWriter, err := bodyWriter.CreateFormFile("uploadfile", id)
+	if err != nil {
+		return err
+	}
+
+	_, err = fileWriter.Write(data)
+	if err != nil {
+		return err
+	}
+
+	contentType := bodyWriter.FormDataContentType()
+	bodyWriter.Close()
+
+	resp, err := http.Post(backend.URL.String()+"/lock", contentType, bodyBuf)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, err = ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return knoxite.ErrStoreLockFailed
+	}
+	return nil
+}
+
+// DeleteLock deletes a lock.
+func (backend *HTTPStorage) DeleteLock(id string) error {
+	req, err := http.NewRequest(http.MethodDelete, backend.URL.String()+"/lock/"+id, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return knoxite.ErrDeleteLockFailed
+	}
+	return nil
+}
+
+// ListIndexSegments returns the IDs of all chunk-index segments.
+func (backend *HTTPStorage) ListIndexSegments() ([]string, error) {
+	res, err := http.Get(backend.URL.String() + "/indexsegments")
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, knoxite.ErrLoadIndexSegmentFailed
+	}
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	return strings.Fields(string(b)), nil
+}
+
+// LoadIndexSegment loads a chunk-index segment.
+func (backend *HTTPStorage) LoadIndexSegment(id string) ([]byte, error) {
+	res, err := http.Get(backend.URL.String() + "/indexsegment/" + id)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, knoxite.ErrLoadIndexSegmentFailed
+	}
+	return ioutil.ReadAll(res.Body)
+}
+
+// SaveIndexSegment stores a chunk-index segment.
+func (backend *HTTPStorage) SaveIndexSegment(id string, data []byte) error {
+	bodyBuf := &bytes.Buffer{}
+	bodyWriter := multipart.NewWriter(bodyBuf)
+
+	fileWriter, err := bodyWriter.CreateFormFile("uploadfile", id)
+	if err != nil {
+		return err
+	}
+
+	_, err = fileWriter.Write(data)
+	if err != nil {
+		return err
+	}
+
+	contentType := bodyWriter.FormDataContentType()
+	bodyWriter.Close()
+
+	resp, err := http.Post(backend.URL.String()+"/indexsegment", contentType, bodyBuf)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, err = ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return knoxite.ErrStoreIndexSegmentFailed
+	}
+	return nil
+}
+
+// DeleteIndexSegment deletes a chunk-index segment.
+func (backend *HTTPStorage) DeleteIndexSegment(id string) error {
+	req, err := http.NewRequest(http.MethodDelete, backend.URL.String()+"/indexsegment/"+id, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return knoxite.ErrDeleteIndexSegmentFailed
+	}
+	return nil
+}
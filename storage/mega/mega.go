@@ -11,6 +11,7 @@ package mega
 
 import (
 	"errors"
+	"io"
 	"net/url"
 	"path/filepath"
 	"strings"
@@ -150,6 +151,20 @@ func (backend *MegaStorage) ReadFile(path string) ([]byte, error) {
 	return bytes, download.Finish()
 }
 
+// ReadFileRange reads length bytes starting at offset from a file on mega.
+// Mega doesn't support ranged downloads, so the entire file gets fetched.
+func (backend *MegaStorage) ReadFileRange(path string, offset, length uint64) ([]byte, error) {
+	b, err := backend.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if offset+length > uint64(len(b)) {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	return b[offset : offset+length], nil
+}
+
 // WriteFile write files on mega.
 func (backend *MegaStorage) WriteFile(path string, data []byte) (size uint64, err error) {
 	dir, file := filepath.Split(path)
@@ -234,3 +249,25 @@ func (backend *MegaStorage) getNodeFromPath(path string) (*mega.Node, error) {
 	}
 	return nil, errors.New("file or directory not found on mega")
 }
+
+// ReadDir returns the names of all files in a dir on mega.
+func (backend *MegaStorage) ReadDir(path string) ([]string, error) {
+	dir, err := backend.getNodeFromPath(path)
+	if err != nil {
+		// the dir doesn't exist yet
+		return []string{}, nil
+	}
+
+	nodes, err := backend.mega.FS.GetChildren(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for _, node := range nodes {
+		if node.GetType() == mega.FILE {
+			names = append(names, node.GetName())
+		}
+	}
+	return names, nil
+}
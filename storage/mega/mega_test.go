@@ -84,3 +84,15 @@ func TestStorageStoreChunk(t *testing.T) {
 func TestStorageDeleteChunk(t *testing.T) {
 	backendTest.DeleteChunkTest(t)
 }
+
+func TestStorageLock(t *testing.T) {
+	backendTest.LockTest(t)
+}
+
+func TestStorageIndexSegment(t *testing.T) {
+	backendTest.IndexSegmentTest(t)
+}
+
+func TestStoragePack(t *testing.T) {
+	backendTest.PackTest(t)
+}
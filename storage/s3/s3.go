@@ -22,6 +22,12 @@ import (
 	"github.com/knoxite/knoxite"
 )
 
+const (
+	lockPrefix         = "lock-"
+	indexSegmentPrefix = "index-"
+	packPrefix         = "pack-"
+)
+
 // S3Storage stores data on a remote AmazonS3.
 type S3Storage struct {
 	url              url.URL
@@ -148,6 +154,38 @@ func (backend *S3Storage) DeleteChunk(shasum string, part, totalParts uint) erro
 	return nil
 }
 
+// LoadPack loads length bytes starting at offset from a pack.
+func (backend *S3Storage) LoadPack(id string, offset, length uint64) ([]byte, error) {
+	opts := minio.GetObjectOptions{}
+	if err := opts.SetRange(int64(offset), int64(offset+length-1)); err != nil {
+		return nil, err
+	}
+	obj, err := backend.client.GetObject(backend.chunkBucket, packPrefix+id, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer obj.Close()
+
+	return ioutil.ReadAll(obj)
+}
+
+// StorePack stores a pack on network.
+func (backend *S3Storage) StorePack(id string, data []byte) (uint64, error) {
+	if _, err := backend.client.StatObject(backend.chunkBucket, packPrefix+id, minio.StatObjectOptions{}); err == nil {
+		// Pack is already stored
+		return 0, nil
+	}
+
+	buf := bytes.NewBuffer(data)
+	i, err := backend.client.PutObject(backend.chunkBucket, packPrefix+id, buf, int64(buf.Len()), minio.PutObjectOptions{ContentType: "application/octet-stream"})
+	return uint64(i), err
+}
+
+// DeletePack deletes a pack.
+func (backend *S3Storage) DeletePack(id string) error {
+	return backend.client.RemoveObject(backend.chunkBucket, packPrefix+id)
+}
+
 // LoadSnapshot loads a snapshot.
 func (backend *S3Storage) LoadSnapshot(id string) ([]byte, error) {
 	obj, err := backend.client.GetObject(backend.snapshotBucket, id, minio.GetObjectOptions{})
@@ -184,6 +222,11 @@ func (backend *S3Storage) SaveChunkIndex(data []byte) error {
 	return err
 }
 
+// DeleteChunkIndex deletes the chunk-index.
+func (backend *S3Storage) DeleteChunkIndex() error {
+	return backend.client.RemoveObject(backend.chunkBucket, knoxite.ChunkIndexFilename)
+}
+
 // InitRepository creates a new repository.
 func (backend *S3Storage) InitRepository() error {
 	chunkBucketExist, err := backend.client.BucketExists(backend.chunkBucket)
@@ -245,3 +288,81 @@ func (backend *S3Storage) SaveRepository(data []byte) error {
 	_, err := backend.client.PutObject(backend.repositoryBucket, knoxite.RepoFilename, buf, int64(buf.Len()), minio.PutObjectOptions{ContentType: "application/octet-stream"})
 	return err
 }
+
+// ListLocks returns the IDs of all locks.
+func (backend *S3Storage) ListLocks() ([]string, error) {
+	doneCh := make(chan struct{})
+	defer close(doneCh)
+
+	ids := []string{}
+	for obj := range backend.client.ListObjectsV2(backend.repositoryBucket, lockPrefix, false, doneCh) {
+		if obj.Err != nil {
+			return nil, obj.Err
+		}
+		ids = append(ids, strings.TrimPrefix(obj.Key, lockPrefix))
+	}
+
+	return ids, nil
+}
+
+// LoadLock loads a lock.
+func (backend *S3Storage) LoadLock(id string) ([]byte, error) {
+	obj, err := backend.client.GetObject(backend.repositoryBucket, lockPrefix+id, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	defer obj.Close()
+
+	return ioutil.ReadAll(obj)
+}
+
+// SaveLock stores a lock.
+func (backend *S3Storage) SaveLock(id string, data []byte) error {
+	buf := bytes.NewBuffer(data)
+	_, err := backend.client.PutObject(backend.repositoryBucket, lockPrefix+id, buf, int64(buf.Len()), minio.PutObjectOptions{ContentType: "application/octet-stream"})
+	return err
+}
+
+// DeleteLock deletes a lock.
+func (backend *S3Storage) DeleteLock(id string) error {
+	return backend.client.RemoveObject(backend.repositoryBucket, lockPrefix+id)
+}
+
+// ListIndexSegments returns the IDs of all chunk-index segments.
+func (backend *S3Storage) ListIndexSegments() ([]string, error) {
+	doneCh := make(chan struct{})
+	defer close(doneCh)
+
+	ids := []string{}
+	for obj := range backend.client.ListObjectsV2(backend.chunkBucket, indexSegmentPrefix, false, doneCh) {
+		if obj.Err != nil {
+			return nil, obj.Err
+		}
+		ids = append(ids, strings.TrimPrefix(obj.Key, indexSegmentPrefix))
+	}
+
+	return ids, nil
+}
+
+// LoadIndexSegment loads a chunk-index segment.
+func (backend *S3Storage) LoadIndexSegment(id string) ([]byte, error) {
+	obj, err := backend.client.GetObject(backend.chunkBucket, indexSegmentPrefix+id, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	defer obj.Close()
+
+	return ioutil.ReadAll(obj)
+}
+
+// SaveIndexSegment stores a chunk-index segment.
+func (backend *S3Storage) SaveIndexSegment(id string, data []byte) error {
+	buf := bytes.NewBuffer(data)
+	_, err := backend.client.PutObject(backend.chunkBucket, indexSegmentPrefix+id, buf, int64(buf.Len()), minio.PutObjectOptions{ContentType: "application/octet-stream"})
+	return err
+}
+
+// DeleteIndexSegment deletes a chunk-index segment.
+func (backend *S3Storage) DeleteIndexSegment(id string) error {
+	return backend.client.RemoveObject(backend.chunkBucket, indexSegmentPrefix+id)
+}
@@ -10,7 +10,10 @@ package webdav
 
 import (
 	"errors"
+	"io"
+	"io/ioutil"
 	"net/url"
+	"os"
 
 	"github.com/studio-b12/gowebdav"
 
@@ -110,6 +113,22 @@ func (backend *WebDAVStorage) ReadFile(path string) ([]byte, error) {
 	return backend.Client.Read(path)
 }
 
+// ReadFileRange reads length bytes starting at offset from a file.
+func (backend *WebDAVStorage) ReadFileRange(path string, offset, length uint64) ([]byte, error) {
+	stream, err := backend.Client.ReadStream(path)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+
+	if _, err = io.CopyN(ioutil.Discard, stream, int64(offset)); err != nil {
+		return nil, err
+	}
+	b := make([]byte, length)
+	_, err = io.ReadFull(stream, b)
+	return b, err
+}
+
 // WriteFile writes a file.
 func (backend *WebDAVStorage) WriteFile(path string, data []byte) (size uint64, err error) {
 	err = backend.Client.Write(path, data, 0644)
@@ -124,3 +143,22 @@ func (backend *WebDAVStorage) Stat(path string) (uint64, error) {
 	}
 	return uint64(stat.Size()), nil
 }
+
+// ReadDir returns the names of all files in a remote dir.
+func (backend *WebDAVStorage) ReadDir(path string) ([]string, error) {
+	files, err := backend.Client.ReadDir(path)
+	if err != nil {
+		if perr, ok := err.(*os.PathError); ok && perr.Err.Error() == "404" {
+			return []string{}, nil
+		}
+		return nil, err
+	}
+
+	names := []string{}
+	for _, file := range files {
+		if !file.IsDir() {
+			names = append(names, file.Name())
+		}
+	}
+	return names, nil
+}
@@ -19,6 +19,9 @@ const (
 	ChunkIndexFilename = "index"
 	chunksDirname      = "chunks"
 	snapshotsDirname   = "snapshots"
+	locksDirname       = "locks"
+	indexDirname       = "index"
+	packsDirname       = "packs"
 )
 
 // BackendFilesystem is used to store and access data on a filesytem based backend.
@@ -29,10 +32,15 @@ type BackendFilesystem interface {
 	CreatePath(path string) error
 	// ReadFile reads a file from disk
 	ReadFile(path string) ([]byte, error)
+	// ReadFileRange reads length bytes starting at offset from a file
+	ReadFileRange(path string, offset, length uint64) ([]byte, error)
 	// WriteFile writes a file to disk
 	WriteFile(path string, data []byte) (uint64, error)
 	// DeleteFile deletes a file from disk
 	DeleteFile(path string) error
+	// ReadDir returns the names of all files in a dir. A dir which doesn't
+	// exist yet results in an empty list
+	ReadDir(path string) ([]string, error)
 }
 
 // StorageFilesystem is bridging a BackendFilesystem to a Backend interface.
@@ -40,6 +48,9 @@ type StorageFilesystem struct {
 	Path           string
 	chunkPath      string
 	snapshotPath   string
+	lockPath       string
+	indexPath      string
+	packPath       string
 	chunkIndexPath string
 	repositoryPath string
 
@@ -52,6 +63,9 @@ func NewStorageFilesystem(path string, storage BackendFilesystem) (StorageFilesy
 		Path:           path,
 		chunkPath:      filepath.Join(path, chunksDirname),
 		snapshotPath:   filepath.Join(path, snapshotsDirname),
+		lockPath:       filepath.Join(path, locksDirname),
+		indexPath:      filepath.Join(path, indexDirname),
+		packPath:       filepath.Join(path, packsDirname),
 		chunkIndexPath: filepath.Join(path, chunksDirname, ChunkIndexFilename),
 		repositoryPath: filepath.Join(path, RepoFilename),
 		storage:        &storage,
@@ -93,6 +107,38 @@ func (backend StorageFilesystem) DeleteChunk(shasum string, part, totalParts uin
 	return (*backend.storage).DeleteFile(fileName)
 }
 
+// LoadPack reads length bytes starting at offset from a pack.
+func (backend StorageFilesystem) LoadPack(id string, offset, length uint64) ([]byte, error) {
+	fileName := filepath.Join(backend.packPath, SubDirForChunk(id), id)
+
+	return (*backend.storage).ReadFileRange(fileName, offset, length)
+}
+
+// StorePack stores a pack on disk.
+func (backend StorageFilesystem) StorePack(id string, data []byte) (uint64, error) {
+	path := filepath.Join(backend.packPath, SubDirForChunk(id))
+	fileName := filepath.Join(path, id)
+
+	n, err := (*backend.storage).Stat(fileName)
+	if err == nil && n == uint64(len(data)) {
+		return 0, nil
+	}
+
+	err = (*backend.storage).CreatePath(path)
+	if err != nil {
+		return 0, err
+	}
+
+	return (*backend.storage).WriteFile(fileName, data)
+}
+
+// DeletePack deletes a pack.
+func (backend StorageFilesystem) DeletePack(id string) error {
+	fileName := filepath.Join(backend.packPath, SubDirForChunk(id), id)
+
+	return (*backend.storage).DeleteFile(fileName)
+}
+
 // LoadSnapshot loads a snapshot.
 func (backend StorageFilesystem) LoadSnapshot(id string) ([]byte, error) {
 	return (*backend.storage).ReadFile(filepath.Join(backend.snapshotPath, id))
@@ -115,13 +161,46 @@ func (backend StorageFilesystem) SaveChunkIndex(b []byte) error {
 	return err
 }
 
+// DeleteChunkIndex deletes the chunk-index.
+func (backend StorageFilesystem) DeleteChunkIndex() error {
+	return (*backend.storage).DeleteFile(backend.chunkIndexPath)
+}
+
+// ListIndexSegments returns the IDs of all chunk-index segments.
+func (backend StorageFilesystem) ListIndexSegments() ([]string, error) {
+	return (*backend.storage).ReadDir(backend.indexPath)
+}
+
+// LoadIndexSegment reads a chunk-index segment.
+func (backend StorageFilesystem) LoadIndexSegment(id string) ([]byte, error) {
+	return (*backend.storage).ReadFile(filepath.Join(backend.indexPath, id))
+}
+
+// SaveIndexSegment stores a chunk-index segment.
+func (backend StorageFilesystem) SaveIndexSegment(id string, b []byte) error {
+	// repositories created before index segments were introduced lack the
+	// index dir
+	err := (*backend.storage).CreatePath(backend.indexPath)
+	if err != nil {
+		return err
+	}
+
+	_, err = (*backend.storage).WriteFile(filepath.Join(backend.indexPath, id), b)
+	return err
+}
+
+// DeleteIndexSegment deletes a chunk-index segment.
+func (backend StorageFilesystem) DeleteIndexSegment(id string) error {
+	return (*backend.storage).DeleteFile(filepath.Join(backend.indexPath, id))
+}
+
 // InitRepository creates a new repository.
 func (backend StorageFilesystem) InitRepository() error {
 	if _, err := (*backend.storage).Stat(backend.repositoryPath); err == nil {
 		// Repo seems to already exist
 		return ErrRepositoryExists
 	}
-	paths := []string{backend.chunkPath, backend.snapshotPath}
+	paths := []string{backend.chunkPath, backend.snapshotPath, backend.lockPath, backend.indexPath, backend.packPath}
 	for _, path := range paths {
 		if _, err := (*backend.storage).Stat(path); err == nil {
 			return ErrRepositoryExists
@@ -151,6 +230,33 @@ func (backend StorageFilesystem) SaveRepository(b []byte) error {
 	return err
 }
 
+// ListLocks returns the IDs of all locks.
+func (backend StorageFilesystem) ListLocks() ([]string, error) {
+	return (*backend.storage).ReadDir(backend.lockPath)
+}
+
+// LoadLock loads a lock.
+func (backend StorageFilesystem) LoadLock(id string) ([]byte, error) {
+	return (*backend.storage).ReadFile(filepath.Join(backend.lockPath, id))
+}
+
+// SaveLock stores a lock.
+func (backend StorageFilesystem) SaveLock(id string, b []byte) error {
+	// repositories created before locking was introduced lack the lock dir
+	err := (*backend.storage).CreatePath(backend.lockPath)
+	if err != nil {
+		return err
+	}
+
+	_, err = (*backend.storage).WriteFile(filepath.Join(backend.lockPath, id), b)
+	return err
+}
+
+// DeleteLock deletes a lock.
+func (backend StorageFilesystem) DeleteLock(id string) error {
+	return (*backend.storage).DeleteFile(filepath.Join(backend.lockPath, id))
+}
+
 // SubDirForChunk files a chunk into a subdir, based on the chunks name.
 func SubDirForChunk(id string) string {
 	return filepath.Join(id[0:2], id[2:4])
@@ -77,6 +77,19 @@ func (backend StorageLocal) ReadFile(path string) ([]byte, error) {
 	return b, err
 }
 
+// ReadFileRange reads length bytes starting at offset from a file on disk.
+func (backend StorageLocal) ReadFileRange(path string, offset, length uint64) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	b := make([]byte, length)
+	_, err = f.ReadAt(b, int64(offset))
+	return b, err
+}
+
 // WriteFile writes a file to disk.
 func (backend StorageLocal) WriteFile(path string, data []byte) (size uint64, err error) {
 	err = ioutil.WriteFile(path, data, 0600)
@@ -88,3 +101,22 @@ func (backend StorageLocal) DeleteFile(path string) error {
 	// fmt.Println("Deleting:", path)
 	return os.Remove(path)
 }
+
+// ReadDir returns the names of all files in a dir.
+func (backend StorageLocal) ReadDir(path string) ([]string, error) {
+	infos, err := ioutil.ReadDir(path)
+	if os.IsNotExist(err) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for _, info := range infos {
+		if !info.IsDir() {
+			names = append(names, info.Name())
+		}
+	}
+	return names, nil
+}
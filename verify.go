@@ -61,7 +61,9 @@ func VerifyRepo(repository Repository, percentage int) (<-chan Progress, error)
 
 			err := VerifyArchive(repository, *snapshot.Archives[archiveKey])
 			if err != nil {
-				prog <- newProgressError(err)
+				pe := newProgressError(err)
+				pe.Path = archiveKey
+				prog <- pe
 			}
 
 			p.CurrentItemStats.Transferred += (*snapshot.Archives[archiveKey]).Size
@@ -124,7 +126,9 @@ func VerifyVolume(repository Repository, volumeId string, percentage int) (<-cha
 
 			err := VerifyArchive(repository, *snapshot.Archives[archiveKey])
 			if err != nil {
-				prog <- newProgressError(err)
+				pe := newProgressError(err)
+				pe.Path = archiveKey
+				prog <- pe
 			}
 
 			p.CurrentItemStats.Transferred += (*snapshot.Archives[archiveKey]).Size
@@ -173,7 +177,9 @@ func VerifySnapshot(repository Repository, snapshotId string, percentage int) (<
 
 			err := VerifyArchive(repository, *snapshot.Archives[archiveKey])
 			if err != nil {
-				prog <- newProgressError(err)
+				pe := newProgressError(err)
+				pe.Path = archiveKey
+				prog <- pe
 			}
 
 			p.CurrentItemStats.Transferred += (*snapshot.Archives[archiveKey]).Size
@@ -197,7 +203,8 @@ func VerifyArchive(repository Repository, arc Archive) error {
 		}
 
 		chunk := arc.Chunks[idx]
-		_, err = loadChunk(repository, arc, chunk)
+		// bypass the cache, the data needs to be checked in the backends
+		_, err = fetchChunk(repository, arc, chunk)
 		if err != nil {
 			return err
 		}
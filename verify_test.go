@@ -20,16 +20,16 @@ var verifyTestCases = []struct {
 	{func(dir string) error { return nil }, 0, 256},
 	{func(dir string) error { return nil }, 0, -256},
 	{func(dir string) error {
-		// What does happen if all chunks are deleted?
-		return os.RemoveAll(filepath.Join(dir, "chunks"))
+		// What does happen if all packs are deleted?
+		return os.RemoveAll(filepath.Join(dir, "packs"))
 	}, 2, 100},
 	{func(dir string) error {
 		// What does happen if all snapshots are deleted?
 		return os.RemoveAll(filepath.Join(dir, "snapshots"))
 	}, 1, 100},
 	{func(dir string) error {
-		// What does happen if a specific chunk is deleted?
-		layer0, err := ioutil.ReadDir(filepath.Join(dir, "chunks"))
+		// What does happen if a specific pack is deleted?
+		layer0, err := ioutil.ReadDir(filepath.Join(dir, "packs"))
 		if err != nil {
 			return err
 		}
@@ -37,7 +37,7 @@ var verifyTestCases = []struct {
 			return errors.New("files expected")
 		}
 
-		layer1, err := ioutil.ReadDir(filepath.Join(dir, "chunks", layer0[0].Name()))
+		layer1, err := ioutil.ReadDir(filepath.Join(dir, "packs", layer0[0].Name()))
 		if err != nil {
 			return err
 		}
@@ -46,7 +46,7 @@ var verifyTestCases = []struct {
 			return errors.New("files expected")
 		}
 
-		layer2, err := ioutil.ReadDir(filepath.Join(dir, "chunks", layer0[0].Name(), layer1[0].Name()))
+		layer2, err := ioutil.ReadDir(filepath.Join(dir, "packs", layer0[0].Name(), layer1[0].Name()))
 		if err != nil {
 			return err
 		}
@@ -55,7 +55,7 @@ var verifyTestCases = []struct {
 			return errors.New("files expected")
 		}
 
-		os.Remove(filepath.Join(dir, "chunks", layer0[0].Name(), layer1[0].Name(), layer2[0].Name()))
+		os.Remove(filepath.Join(dir, "packs", layer0[0].Name(), layer1[0].Name(), layer2[0].Name()))
 
 		return nil
 
@@ -114,6 +114,7 @@ func TestVerifyRepo(t *testing.T) {
 				Pedantic:    false,
 				DataParts:   1,
 				ParityParts: 0,
+				PackSize:    1, // every chunk gets its own pack
 			}
 
 			progress := snapshot.Add(r, &index, opts)
@@ -226,6 +227,7 @@ func TestVerifyVolume(t *testing.T) {
 				Pedantic:    false,
 				DataParts:   1,
 				ParityParts: 0,
+				PackSize:    1, // every chunk gets its own pack
 			}
 
 			progress := snapshot.Add(r, &index, opts)
@@ -340,6 +342,7 @@ func TestVerifySnapshot(t *testing.T) {
 				Pedantic:    false,
 				DataParts:   1,
 				ParityParts: 0,
+				PackSize:    1, // every chunk gets its own pack
 			}
 
 			progress := snapshot.Add(r, &index, opts)
@@ -71,3 +71,12 @@ func (v *Volume) LoadSnapshot(id string, repository *Repository) (*Snapshot, err
 
 	return &Snapshot{}, ErrSnapshotNotFound
 }
+
+// LatestSnapshot loads the most recently added snapshot of a volume.
+func (v *Volume) LatestSnapshot(repository *Repository) (*Snapshot, error) {
+	if len(v.Snapshots) == 0 {
+		return &Snapshot{}, ErrSnapshotNotFound
+	}
+
+	return v.LoadSnapshot(v.Snapshots[len(v.Snapshots)-1], repository)
+}
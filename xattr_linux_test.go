@@ -0,0 +1,131 @@
+/*
+ * knoxite
+ *     Copyright (c) 2016-2021, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package knoxite
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestXAttrs(t *testing.T) {
+	testPassword := "this_is_a_password"
+	name := "user.knoxite.test"
+	value := []byte("some value")
+
+	srcdir, err := ioutil.TempDir("", "knoxite.source")
+	if err != nil {
+		t.Errorf("Failed creating temporary dir for source: %s", err)
+		return
+	}
+	defer os.RemoveAll(srcdir)
+
+	path := filepath.Join(srcdir, "file")
+	err = ioutil.WriteFile(path, []byte("content"), 0644)
+	if err != nil {
+		t.Errorf("Failed writing test file: %s", err)
+		return
+	}
+	err = unix.Setxattr(path, name, value, 0)
+	if errors.Is(err, unix.ENOTSUP) || errors.Is(err, unix.EOPNOTSUPP) {
+		t.Skip("File system doesn't support extended attributes")
+	}
+	if err != nil {
+		t.Errorf("Failed setting extended attribute: %s", err)
+		return
+	}
+
+	dir, err := ioutil.TempDir("", "knoxite")
+	if err != nil {
+		t.Errorf("Failed creating temporary dir for repository: %s", err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	r, err := NewRepository(dir, testPassword)
+	if err != nil {
+		t.Errorf("Failed creating repository: %s", err)
+		return
+	}
+	index, err := OpenChunkIndex(&r)
+	if err != nil {
+		t.Errorf("Failed opening chunk-index: %s", err)
+		return
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Errorf("Failed getting working dir: %s", err)
+		return
+	}
+
+	snapshot, _ := NewSnapshot("test_snapshot")
+	progress := snapshot.Add(r, &index, StoreOptions{
+		CWD:       wd,
+		Paths:     []string{path},
+		Encrypt:   EncryptionAES,
+		DataParts: 1,
+	})
+	for p := range progress {
+		if p.Error != nil {
+			t.Errorf("Failed adding to snapshot: %s", p.Error)
+			return
+		}
+	}
+
+	var arc *Archive
+	for _, a := range snapshot.Archives {
+		if filepath.Join(wd, a.Path) == path || a.Path == path {
+			arc = a
+		}
+	}
+	if arc == nil {
+		t.Errorf("Expected the snapshot to contain %s, got %v", path, snapshot.Archives)
+		return
+	}
+	if !bytes.Equal(arc.XAttrs[name], value) {
+		t.Errorf("Expected extended attribute %s to be %q, got %q", name, value, arc.XAttrs[name])
+	}
+
+	for _, noXAttrs := range []bool{false, true} {
+		targetdir, err := ioutil.TempDir("", "knoxite.target")
+		if err != nil {
+			t.Errorf("Failed creating temporary dir for restore: %s", err)
+			return
+		}
+		defer os.RemoveAll(targetdir)
+
+		progress, err := DecodeSnapshotWithOptions(r, snapshot, targetdir, RestoreOptions{NoXAttrs: noXAttrs})
+		if err != nil {
+			t.Errorf("Failed restoring snapshot: %s", err)
+			return
+		}
+		for p := range progress {
+			if p.Error != nil {
+				t.Errorf("Failed restoring snapshot: %s", p.Error)
+			}
+		}
+
+		attrs, err := readXAttrs(filepath.Join(targetdir, arc.Path))
+		if err != nil {
+			t.Errorf("Failed reading extended attributes: %s", err)
+			return
+		}
+		if noXAttrs && attrs[name] != nil {
+			t.Errorf("Expected extended attribute %s to be skipped, got %q", name, attrs[name])
+		}
+		if !noXAttrs && !bytes.Equal(attrs[name], value) {
+			t.Errorf("Expected extended attribute %s to be %q, got %q", name, value, attrs[name])
+		}
+	}
+}
@@ -0,0 +1,23 @@
+//go:build !linux && !darwin && !freebsd && !netbsd
+// +build !linux,!darwin,!freebsd,!netbsd
+
+/*
+ * knoxite
+ *     Copyright (c) 2016-2021, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package knoxite
+
+// readXAttrs returns the extended attributes of path, which aren't supported
+// on this platform.
+func readXAttrs(path string) (map[string][]byte, error) {
+	return nil, nil
+}
+
+// writeXAttrs sets the extended attributes of path, which aren't supported
+// on this platform, so they get skipped.
+func writeXAttrs(path string, attrs map[string][]byte) error {
+	return nil
+}
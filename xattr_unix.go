@@ -0,0 +1,74 @@
+//go:build linux || darwin || freebsd || netbsd
+// +build linux darwin freebsd netbsd
+
+/*
+ * knoxite
+ *     Copyright (c) 2016-2021, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package knoxite
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// readXAttrs returns the extended attributes of path. On Linux they also
+// contain POSIX ACLs, SELinux labels and file capabilities. Paths on file
+// systems without support for extended attributes don't have any.
+func readXAttrs(path string) (map[string][]byte, error) {
+	size, err := unix.Llistxattr(path, nil)
+	if err != nil || size == 0 {
+		return nil, ignoreXAttrsUnsupported(err)
+	}
+	buf := make([]byte, size)
+	size, err = unix.Llistxattr(path, buf)
+	if err != nil {
+		return nil, ignoreXAttrsUnsupported(err)
+	}
+
+	attrs := make(map[string][]byte)
+	for _, name := range strings.Split(string(buf[:size]), "\x00") {
+		if name == "" {
+			continue
+		}
+
+		size, err := unix.Lgetxattr(path, name, nil)
+		if err != nil {
+			return nil, err
+		}
+		value := make([]byte, size)
+		size, err = unix.Lgetxattr(path, name, value)
+		if err != nil {
+			return nil, err
+		}
+		attrs[name] = value[:size]
+	}
+
+	return attrs, nil
+}
+
+// writeXAttrs sets the extended attributes of path. They get skipped if the
+// file system doesn't support extended attributes.
+func writeXAttrs(path string, attrs map[string][]byte) error {
+	for name, value := range attrs {
+		err := unix.Lsetxattr(path, name, value, 0)
+		if err = ignoreXAttrsUnsupported(err); err != nil {
+			return fmt.Errorf("setting extended attribute %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+func ignoreXAttrsUnsupported(err error) error {
+	if errors.Is(err, unix.ENOTSUP) || errors.Is(err, unix.EOPNOTSUPP) {
+		return nil
+	}
+	return err
+}